@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultAPIEventsLimit is the amount of history records returned
+// by the events endpoint when request has no limit
+const DefaultAPIEventsLimit = 50
+
+// MaxAPIEventsLimit is the largest amount of history records
+// returned by the events endpoint
+const MaxAPIEventsLimit = 1000
+
+// API is an authenticated HTTP API which lets local scripts and game
+// servers talk to the bot without going through Discord
+type API struct {
+	master *Master
+	server *Server
+
+	mutex sync.RWMutex
+	token string
+}
+
+// APIMessage is a message posted through the API. Channel is one of the
+// configured channels: log, event or status
+type APIMessage struct {
+	Channel string                  `json:"channel"`
+	Content string                  `json:"content"`
+	Embed   *discordgo.MessageEmbed `json:"embed"`
+}
+
+// APIHealth describes state of the bot
+type APIHealth struct {
+	Status     string              `json:"status"`
+	Version    string              `json:"version"`
+	Uptime     string              `json:"uptime"`
+	Subsystems []APISubsystem      `json:"subsystems"`
+	Published  uint64              `json:"published"`
+	Queues     []SubscriptionStats `json:"queues"`
+	// Duplicates are dropped webhook deliveries by source
+	Duplicates map[string]uint64 `json:"duplicates"`
+}
+
+// APISubsystem is a startup result of a subsystem
+type APISubsystem struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	State    string `json:"state"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+func (a *API) Init(conf APIConfig, httpc HTTPConfig, master *Master) error {
+	log.Infof("Initializing admin API")
+	if master == nil {
+		return fmt.Errorf("nil master")
+	}
+	a.master = master
+	a.SetToken(conf.Token)
+
+	a.server = new(Server)
+	err := a.server.Init(HTTPConfig{
+		Address:      conf.Address,
+		Port:         conf.Port,
+		Plain:        true,
+		ReadTimeout:  httpc.ReadTimeout,
+		WriteTimeout: httpc.WriteTimeout,
+	}, TLSConfig{})
+	if err != nil {
+		return err
+	}
+
+	routes := []Route{
+		{Name: "api.projects", Path: "/api/projects", Handler: a.auth(a.handleProjects)},
+		{Name: "api.messages", Path: "/api/messages", Handler: a.auth(a.handleMessages)},
+		{Name: "api.health", Path: "/api/health", Handler: a.auth(a.handleHealth)},
+		{Name: "api.events", Path: "/api/events", Handler: a.auth(a.handleEvents)},
+		{Name: "api.status", Path: "/api/status", Handler: a.auth(a.handleStatus)},
+	}
+	for _, route := range routes {
+		if err := a.server.Register(route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetToken replaces token expected from API clients
+func (a *API) SetToken(token string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.token = token
+}
+
+// Run serves API requests until Stop is called
+func (a *API) Run() error {
+	return a.server.Run()
+}
+
+// Stop stops accepting new requests and waits for active ones
+func (a *API) Stop(ctx context.Context) error {
+	return a.server.Stop(ctx)
+}
+
+// auth rejects requests without a valid bearer token
+func (a *API) auth(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mutex.RLock()
+		token := a.token
+		a.mutex.RUnlock()
+
+		header := r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(header, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func (a *API) handleProjects(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		projects, err := a.master.Projects()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondJSON(w, http.StatusOK, projects)
+	case http.MethodPost:
+		var request struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err.Error()))
+			return
+		}
+		if err := validateProject(request.URL); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		project, err := a.master.AddProject(request.URL)
+		if err == ErrProjectExists {
+			respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		respondJSON(w, http.StatusCreated, project)
+	case http.MethodDelete:
+		err := a.master.RemoveProject(r.URL.Query().Get("url"))
+		switch err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case ErrProjectNotFound:
+			respondError(w, http.StatusNotFound, err.Error())
+		case ErrProjectConfigured:
+			respondError(w, http.StatusConflict, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, err.Error())
+		}
+	default:
+		respondMethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func (a *API) handleMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	discord := a.master.Discord
+	if discord == nil {
+		respondError(w, http.StatusServiceUnavailable, "discord is not available")
+		return
+	}
+
+	var message APIMessage
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %s", err.Error()))
+		return
+	}
+	if message.Content == "" && message.Embed == nil {
+		respondError(w, http.StatusBadRequest, "content or embed is required")
+		return
+	}
+	if len(message.Content) > 2000 {
+		respondError(w, http.StatusBadRequest, "content is longer than 2000 characters")
+		return
+	}
+
+	var channelID string
+	switch message.Channel {
+	case "log":
+		channelID = discord.logChannel()
+	case "event", "":
+		channelID = discord.eventChannel()
+	case "status":
+		channelID = discord.statusChannel()
+	default:
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("unknown channel '%s'", message.Channel))
+		return
+	}
+
+	msg, err := discord.sendComplex(channelID, message.Content, message.Embed)
+	if err != nil {
+		respondError(w, http.StatusBadGateway, fmt.Sprintf("Failed to send message: %s", err.Error()))
+		return
+	}
+	respondJSON(w, http.StatusCreated, MessageRef{ChannelID: msg.ChannelID, MessageID: msg.ID})
+}
+
+func (a *API) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	m := a.master
+	health := APIHealth{
+		Status:     "ok",
+		Version:    AppVersion,
+		Subsystems: []APISubsystem{},
+		Published:  m.Bus.Published(),
+		Queues:     m.Bus.Stats(),
+		Duplicates: m.Deliveries.Duplicates(),
+	}
+	if m.Status != nil {
+		health.Uptime = m.Status.GetUptime()
+	}
+	if m.Startup != nil {
+		for _, result := range m.Startup.Results {
+			subsystem := APISubsystem{
+				Name:     result.Name,
+				Required: result.Required,
+				State:    result.State.String(),
+				Duration: result.Duration.String(),
+			}
+			if result.Error != nil {
+				subsystem.Error = result.Error.Error()
+			}
+			if result.State != SubsystemStarted {
+				health.Status = "degraded"
+			}
+			health.Subsystems = append(health.Subsystems, subsystem)
+		}
+	}
+	respondJSON(w, http.StatusOK, health)
+}
+
+func (a *API) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if a.master.Storage == nil {
+		respondError(w, http.StatusServiceUnavailable, "storage is not available")
+		return
+	}
+
+	limit := DefaultAPIEventsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l <= 0 {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit '%s'", value))
+			return
+		}
+		limit = l
+	}
+	if limit > MaxAPIEventsLimit {
+		limit = MaxAPIEventsLimit
+	}
+
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid since '%s': expected RFC 3339 time", value))
+			return
+		}
+		since = t
+	}
+
+	events, err := a.master.Storage.Events(since, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if events == nil {
+		events = []*EventRecord{}
+	}
+	respondJSON(w, http.StatusOK, events)
+}
+
+func (a *API) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if a.master.Status == nil {
+		respondError(w, http.StatusServiceUnavailable, "status subsystem is not running")
+		return
+	}
+	if err := a.master.Status.UpdateStatus(); err != nil {
+		respondError(w, http.StatusBadGateway, fmt.Sprintf("Failed to update status: %s", err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Errorf("Failed to write response: %s", err.Error())
+	}
+}
+
+func respondError(w http.ResponseWriter, status int, message string) {
+	respondJSON(w, status, map[string]string{"message": message})
+}
+
+func respondMethodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	respondError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAPI(t *testing.T) (*API, func()) {
+	storage, cleanup := testStorage(t)
+	m := &Master{
+		Config:  &Config{Projects: []string{"github.com/savageking-io/eveleve"}},
+		Bus:     new(Bus),
+		Storage: storage,
+	}
+	m.Bus.Init()
+	m.syncProjects(m.Config.Projects)
+
+	api := &API{master: m}
+	api.SetToken("0123456789abcdef")
+	return api, cleanup
+}
+
+func apiRequest(api *API, handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer 0123456789abcdef")
+	w := httptest.NewRecorder()
+	api.auth(handler).ServeHTTP(w, r)
+	return w
+}
+
+func TestAPI_Auth(t *testing.T) {
+	api, cleanup := testAPI(t)
+	defer cleanup()
+
+	for _, header := range []string{"", "Bearer", "Bearer wrong", "Basic 0123456789abcdef"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/projects", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		api.auth(api.handleProjects).ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization '%s': status = %d, want %d", header, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	w := apiRequest(api, api.handleProjects, http.MethodGet, "/api/projects", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Valid token: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAPI_Projects(t *testing.T) {
+	api, cleanup := testAPI(t)
+	defer cleanup()
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/api/projects", `{"url": "github.com/savageking-io/evelengine"}`, http.StatusCreated},
+		{http.MethodPost, "/api/projects", `{"url": "github.com/savageking-io/evelengine"}`, http.StatusConflict},
+		{http.MethodPost, "/api/projects", `{"url": "github.com/savageking-io/eveleve"}`, http.StatusConflict},
+		{http.MethodPost, "/api/projects", `{"url": "gitlab.com/owner/repo"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/projects", `{"url": `, http.StatusBadRequest},
+		{http.MethodDelete, "/api/projects?url=github.com/savageking-io/eveleve", "", http.StatusConflict},
+		{http.MethodDelete, "/api/projects?url=github.com/owner/unknown", "", http.StatusNotFound},
+		{http.MethodPut, "/api/projects", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := apiRequest(api, api.handleProjects, tt.method, tt.target, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s %s %s: status = %d, want %d: %s", tt.method, tt.target, tt.body, w.Code, tt.status, w.Body.String())
+		}
+	}
+
+	list := func() []ProjectData {
+		w := apiRequest(api, api.handleProjects, http.MethodGet, "/api/projects", "")
+		projects := []ProjectData{}
+		if err := json.NewDecoder(w.Body).Decode(&projects); err != nil {
+			t.Fatalf("Failed to decode projects: %s", err.Error())
+		}
+		return projects
+	}
+
+	projects := list()
+	if len(projects) != 2 || projects[0].URL != "github.com/savageking-io/evelengine" || !projects[0].Runtime() ||
+		projects[1].URL != "github.com/savageking-io/eveleve" || projects[1].Runtime() {
+		t.Errorf("Unexpected projects: %+v", projects)
+	}
+
+	w := apiRequest(api, api.handleProjects, http.MethodDelete, "/api/projects?url=github.com/savageking-io/evelengine", "")
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Remove: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if projects := list(); len(projects) != 1 {
+		t.Errorf("Project was not removed: %+v", projects)
+	}
+}
+
+func TestAPI_Events(t *testing.T) {
+	api, cleanup := testAPI(t)
+	defer cleanup()
+
+	start := time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		api.master.Storage.AddEvent(&EventRecord{Time: start.Add(time.Duration(i) * time.Hour), Source: "github", Type: "push"})
+	}
+
+	tests := []struct {
+		target string
+		status int
+		count  int
+	}{
+		{"/api/events", http.StatusOK, 5},
+		{"/api/events?limit=2", http.StatusOK, 2},
+		{"/api/events?since=2020-05-11T02:30:00Z", http.StatusOK, 2},
+		{"/api/events?limit=-1", http.StatusBadRequest, 0},
+		{"/api/events?since=yesterday", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := apiRequest(api, api.handleEvents, http.MethodGet, tt.target, "")
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.target, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		events := []*EventRecord{}
+		if err := json.NewDecoder(w.Body).Decode(&events); err != nil {
+			t.Fatalf("%s: failed to decode events: %s", tt.target, err.Error())
+		}
+		if len(events) != tt.count {
+			t.Errorf("%s: %d events, want %d", tt.target, len(events), tt.count)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/go-playground/webhooks.v5/github"
+)
+
+const (
+	PullRequestOpen   = "open"
+	PullRequestDraft  = "draft"
+	PullRequestMerged = "merged"
+	PullRequestClosed = "closed"
+)
+
+// PullRequestCard is the state of a pull request shown on the board.
+// Message points to the Discord message which is edited on every change
+type PullRequestCard struct {
+	Project      string `json:"project"`
+	Number       int64  `json:"number"`
+	Title        string `json:"title"`
+	URL          string `json:"url"`
+	Author       string `json:"author"`
+	AuthorIcon   string `json:"author_icon,omitempty"`
+	AuthorURL    string `json:"author_url,omitempty"`
+	Head         string `json:"head"`
+	Base         string `json:"base"`
+	State        string `json:"state"`
+	Commits      int64  `json:"commits"`
+	Additions    int64  `json:"additions"`
+	Deletions    int64  `json:"deletions"`
+	ChangedFiles int64  `json:"changed_files"`
+	// Reviewers are requested reviewers who haven't reviewed yet
+	Reviewers []string `json:"reviewers,omitempty"`
+	// Reviews keeps the latest verdict of every reviewer
+	Reviews map[string]string `json:"reviews,omitempty"`
+	CI      string            `json:"ci,omitempty"`
+	CIURL   string            `json:"ci_url,omitempty"`
+	Updated time.Time         `json:"updated"`
+	Message MessageRef        `json:"message"`
+}
+
+// Key identifies pull request in the storage
+func (c *PullRequestCard) Key() string {
+	return fmt.Sprintf("%s#%d", c.Project, c.Number)
+}
+
+// applyPullRequest updates card from a pull_request event
+func (c *PullRequestCard) applyPullRequest(p *github.PullRequestPayload) {
+	pr := &p.PullRequest
+	c.Project = p.Repository.FullName
+	c.Number = pr.Number
+	c.Title = pr.Title
+	c.URL = pr.HTMLURL
+	c.Author = pr.User.Login
+	c.AuthorIcon = pr.User.AvatarURL
+	c.AuthorURL = pr.User.HTMLURL
+	c.Head = pr.Head.Ref
+	c.Base = pr.Base.Ref
+	c.Commits = pr.Commits
+	c.Additions = pr.Additions
+	c.Deletions = pr.Deletions
+	c.ChangedFiles = pr.ChangedFiles
+
+	switch {
+	case pr.Merged:
+		c.State = PullRequestMerged
+	case pr.State == "closed":
+		c.State = PullRequestClosed
+	case pr.Draft:
+		c.State = PullRequestDraft
+	default:
+		c.State = PullRequestOpen
+	}
+
+	switch p.Action {
+	case "review_requested":
+		if p.RequestedReviewer != nil && !containsString(c.Reviewers, p.RequestedReviewer.Login) {
+			c.Reviewers = append(c.Reviewers, p.RequestedReviewer.Login)
+		}
+	case "review_request_removed":
+		if p.RequestedReviewer != nil {
+			c.Reviewers = removeString(c.Reviewers, p.RequestedReviewer.Login)
+		}
+	case "synchronize":
+		// New commits are not built yet
+		c.CI = ""
+		c.CIURL = ""
+	}
+}
+
+// applyReview updates card from a pull_request_review event. Comments
+// don't replace approval or requested changes of the same reviewer
+func (c *PullRequestCard) applyReview(p *github.PullRequestReviewPayload) {
+	c.Project = p.Repository.FullName
+	c.Number = p.PullRequest.Number
+	if c.Title == "" {
+		c.Title = p.PullRequest.Title
+		c.URL = p.PullRequest.HTMLURL
+	}
+	if c.Reviews == nil {
+		c.Reviews = make(map[string]string)
+	}
+
+	login := p.Review.User.Login
+	state := strings.ToLower(p.Review.State)
+	switch p.Action {
+	case "submitted":
+		c.Reviewers = removeString(c.Reviewers, login)
+		if state == "commented" && c.Reviews[login] != "" {
+			return
+		}
+		c.Reviews[login] = state
+	case "dismissed":
+		delete(c.Reviews, login)
+	}
+}
+
+// applyBuild updates CI status of the card from a Travis CI build
+func (c *PullRequestCard) applyBuild(p *TravisPacket) {
+	c.CI = strings.ToLower(p.StatusMessage)
+	c.CIURL = p.BuildURL
+}
+
+// embed describes pull request state
+func (c *PullRequestCard) embed() *discordgo.MessageEmbed {
+	color := colorOpened
+	switch c.State {
+	case PullRequestDraft:
+		color = colorDraft
+	case PullRequestMerged:
+		color = colorMerged
+	case PullRequestClosed:
+		color = colorClosed
+	}
+
+	reviews := []string{}
+	approved, changes := 0, 0
+	for login, state := range c.Reviews {
+		switch state {
+		case "approved":
+			approved++
+		case "changes_requested":
+			changes++
+		}
+		reviews = append(reviews, fmt.Sprintf("%s: %s", login, strings.Replace(state, "_", " ", -1)))
+	}
+	sort.Strings(reviews)
+	for _, login := range c.Reviewers {
+		reviews = append(reviews, login+": review requested")
+	}
+	if changes > 0 && c.State == PullRequestOpen {
+		color = colorWarning
+	}
+
+	review := "no reviews yet"
+	if len(reviews) > 0 {
+		review = truncateLines(reviews, maxEmbedField)
+	}
+	ci := "no builds yet"
+	if c.CI != "" {
+		ci = c.CI
+		if c.CIURL != "" {
+			ci = fmt.Sprintf("[%s](%s)", c.CI, c.CIURL)
+		}
+	}
+
+	msg := &discordgo.MessageEmbed{
+		Title:       truncateText(fmt.Sprintf("#%d %s", c.Number, c.Title), maxEmbedTitle),
+		URL:         c.URL,
+		Color:       color,
+		Description: fmt.Sprintf("%s wants to merge `%s` into `%s` of %s", c.Author, c.Head, c.Base, c.Project),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "State", Value: c.State, Inline: true},
+			{Name: "Approvals", Value: fmt.Sprintf("%d approved, %d requested changes", approved, changes), Inline: true},
+			{Name: "CI", Value: ci, Inline: true},
+			{Name: "Changes", Value: fmt.Sprintf("+%d / -%d in %d files, %d commits", c.Additions, c.Deletions, c.ChangedFiles, c.Commits)},
+			{Name: "Reviews", Value: review},
+		},
+		Timestamp: c.Updated.Format(time.RFC3339),
+	}
+	if c.Author != "" {
+		msg.Author = githubAuthor(c.Author, c.AuthorIcon, c.AuthorURL)
+	}
+	return msg
+}
+
+// PullRequestBoard keeps a single message per pull request and edits it
+// as the pull request moves from opened to merged or closed
+type PullRequestBoard struct {
+	discord *Discord
+	storage Storage
+	links   *GitHubLinks
+
+	// mutex serializes updates from GitHub and Travis subscriptions
+	mutex sync.Mutex
+}
+
+func (b *PullRequestBoard) Init(discord *Discord, storage Storage, bus *Bus) error {
+	log.Infof("Initializing Pull Request Board")
+	if discord == nil {
+		return fmt.Errorf("nil discord")
+	}
+	if storage == nil {
+		return fmt.Errorf("nil storage")
+	}
+	if bus == nil {
+		return fmt.Errorf("nil bus")
+	}
+	b.discord = discord
+	b.storage = storage
+
+	for _, source := range []EventSource{SourceGitHub, SourceTravis} {
+		if _, err := bus.Subscribe(source, "board", 0, b.handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetLinks makes board mention requested reviewers and assignees linked
+// to Discord users
+func (b *PullRequestBoard) SetLinks(links *GitHubLinks) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.links = links
+}
+
+// Handles reports whether GitHub events of this type are shown on the
+// board instead of the event channel
+func (b *PullRequestBoard) Handles(event GitHubEventType) bool {
+	if !b.enabled() {
+		return false
+	}
+	return event == PullRequest || event == PullRequestReview
+}
+
+// enabled reports whether board channel is configured
+func (b *PullRequestBoard) enabled() bool {
+	return b.discord != nil && b.discord.boardChannel() != ""
+}
+
+func (b *PullRequestBoard) handle(e Event) error {
+	if !b.enabled() {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var card *PullRequestCard
+	var err error
+	switch {
+	case e.GitHub != nil && e.GitHub.event == PullRequest:
+		p := &e.GitHub.pullRequest
+		if card, err = b.card(p.Repository.FullName, p.PullRequest.Number, true); err != nil {
+			return err
+		}
+		card.applyPullRequest(p)
+	case e.GitHub != nil && e.GitHub.event == PullRequestReview:
+		p := &e.GitHub.pullRequestReview
+		if card, err = b.card(p.Repository.FullName, p.PullRequest.Number, true); err != nil {
+			return err
+		}
+		card.applyReview(p)
+	case e.Travis != nil && e.Travis.PullRequest:
+		p := e.Travis
+		project := p.Repository.OwnerName + "/" + p.Repository.Name
+		if card, err = b.card(project, int64(p.PullRequestNumber), false); err != nil || card == nil {
+			return err
+		}
+		card.applyBuild(p)
+	default:
+		return nil
+	}
+
+	card.Updated = e.Time
+	if err := b.publish(card); err != nil {
+		return err
+	}
+
+	// Edited messages don't notify anybody, mentions are sent separately
+	if b.links != nil && e.GitHub != nil {
+		if mentions := b.links.Mentions(githubMentions(e.GitHub)); mentions != "" {
+			text := fmt.Sprintf("%s %s #%d %s <%s>", mentions, card.Project, card.Number, card.Title, card.URL)
+			if err := b.discord.sendMessage(text, card.Message.ChannelID); err != nil {
+				return fmt.Errorf("Failed to mention users of pull request %s: %s", card.Key(), err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// card loads pull request from the storage. New card is returned for
+// unknown pull requests when create is set
+func (b *PullRequestBoard) card(project string, number int64, create bool) (*PullRequestCard, error) {
+	card, err := b.storage.PullRequest(fmt.Sprintf("%s#%d", project, number))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load pull request: %s", err.Error())
+	}
+	if card == nil && create {
+		card = &PullRequestCard{Project: project, Number: number, State: PullRequestOpen}
+	}
+	return card, nil
+}
+
+// publish edits message of the pull request. New message is posted when
+// there's no message yet, it was removed or board channel has changed
+func (b *PullRequestBoard) publish(card *PullRequestCard) error {
+	msg := card.embed()
+	channelID := b.discord.boardChannel()
+
+	posted := false
+	if card.Message.MessageID != "" && card.Message.ChannelID == channelID {
+		_, err := b.discord.editEmbed(channelID, card.Message.MessageID, msg)
+		if err == nil {
+			posted = true
+		} else {
+			log.Warnf("Failed to edit message of pull request %s: %s", card.Key(), err.Error())
+		}
+	}
+	if !posted {
+		newMsg, err := b.discord.sendEmbed(channelID, msg)
+		if err != nil {
+			return fmt.Errorf("Failed to post pull request %s: %s", card.Key(), err.Error())
+		}
+		card.Message = MessageRef{ChannelID: channelID, MessageID: newMsg.ID}
+	}
+
+	if err := b.storage.SavePullRequest(*card); err != nil {
+		return fmt.Errorf("Failed to save pull request %s: %s", card.Key(), err.Error())
+	}
+	return nil
+}
+
+func removeString(list []string, value string) []string {
+	result := list[:0]
+	for _, item := range list {
+		if item != value {
+			result = append(result, item)
+		}
+	}
+	return result
+}
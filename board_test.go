@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPullRequestCard(t *testing.T) {
+	card := new(PullRequestCard)
+	pullRequest := func(action, state string, merged bool, reviewer string) {
+		e := parseGitHubEvent(t, PullRequest, `{
+			"action": "`+action+`",
+			"pull_request": {
+				"number": 7, "title": "Add bus", "state": "`+state+`", "merged": `+strconv.FormatBool(merged)+`,
+				"html_url": "https://github.com/savageking-io/eveleve/pull/7", "user": {"login": "author"},
+				"commits": 2, "additions": 10, "deletions": 3, "changed_files": 1,
+				"head": {"ref": "bus"}, "base": {"ref": "master"}
+			},
+			"requested_reviewer": {"login": "`+reviewer+`"},
+			"repository": {"full_name": "savageking-io/eveleve"}
+		}`)
+		card.applyPullRequest(&e.pullRequest)
+	}
+	review := func(login, state string) {
+		e := parseGitHubEvent(t, PullRequestReview, `{
+			"action": "submitted",
+			"review": {"state": "`+state+`", "user": {"login": "`+login+`"}},
+			"pull_request": {"number": 7},
+			"repository": {"full_name": "savageking-io/eveleve"}
+		}`)
+		card.applyReview(&e.pullRequestReview)
+	}
+
+	pullRequest("opened", "open", false, "")
+	if card.Key() != "savageking-io/eveleve#7" || card.State != PullRequestOpen {
+		t.Fatalf("Wrong card after opening: %+v", card)
+	}
+
+	pullRequest("review_requested", "open", false, "alice")
+	pullRequest("review_requested", "open", false, "bob")
+	if len(card.Reviewers) != 2 {
+		t.Errorf("Wrong reviewers: %v", card.Reviewers)
+	}
+
+	review("alice", "changes_requested")
+	review("alice", "commented")
+	if card.Reviews["alice"] != "changes_requested" || len(card.Reviewers) != 1 {
+		t.Errorf("Comment replaced verdict: %v %v", card.Reviews, card.Reviewers)
+	}
+	if msg := card.embed(); msg.Color != colorWarning {
+		t.Errorf("Requested changes are not highlighted: %x", msg.Color)
+	}
+
+	card.applyBuild(&TravisPacket{StatusMessage: "Passed", BuildURL: "https://travis-ci.com/build/1"})
+	review("alice", "APPROVED")
+	review("bob", "approved")
+
+	msg := card.embed()
+	fields := make(map[string]string)
+	for _, field := range msg.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["Approvals"] != "2 approved, 0 requested changes" {
+		t.Errorf("Wrong approvals: %s", fields["Approvals"])
+	}
+	if fields["CI"] != "[passed](https://travis-ci.com/build/1)" {
+		t.Errorf("Wrong CI: %s", fields["CI"])
+	}
+	if fields["Reviews"] != "alice: approved\nbob: approved" {
+		t.Errorf("Wrong reviews: %q", fields["Reviews"])
+	}
+
+	pullRequest("synchronize", "open", false, "")
+	if card.CI != "" {
+		t.Errorf("CI status was not reset by new commits: %s", card.CI)
+	}
+
+	pullRequest("closed", "closed", true, "")
+	msg = card.embed()
+	if card.State != PullRequestMerged || msg.Color != colorMerged {
+		t.Errorf("Wrong merged state: %s %x", card.State, msg.Color)
+	}
+	if !strings.HasPrefix(msg.Title, "#7 Add bus") || msg.URL != "https://github.com/savageking-io/eveleve/pull/7" {
+		t.Errorf("Wrong title or URL: %s %s", msg.Title, msg.URL)
+	}
+}
+
+func TestPullRequestBoard_Handles(t *testing.T) {
+	board := &PullRequestBoard{discord: new(Discord)}
+	if board.Handles(PullRequest) || board.Handles(PullRequestReview) {
+		t.Errorf("Board without channel takes pull requests from notifications")
+	}
+	board.discord.BoardChannel = "123456789012345678"
+	if !board.Handles(PullRequest) || !board.Handles(PullRequestReview) || board.Handles(Issue) {
+		t.Errorf("Board with channel handles wrong events")
+	}
+}
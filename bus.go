@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// EventSource identifies the subsystem that published an event on the bus
+type EventSource uint8
+
+const (
+	SourceGitHub  EventSource = iota
+	SourceTravis  EventSource = iota
+	SourceDiscord EventSource = iota
+)
+
+func (s EventSource) String() string {
+	switch s {
+	case SourceGitHub:
+		return "github"
+	case SourceTravis:
+		return "travis"
+	case SourceDiscord:
+		return "discord"
+	}
+	return "unknown"
+}
+
+// MarshalText makes sources readable in JSON documents
+func (s EventSource) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// DefaultQueueSize is the amount of events a subscriber can hold
+// before publishers start to experience backpressure
+const DefaultQueueSize = 64
+
+// Event is a single message passed through the bus. Exactly one
+// of the payload fields is set depending on the Source
+type Event struct {
+	Source  EventSource
+	Time    time.Time
+	GitHub  *GitHubEvent
+	Travis  *TravisPacket
+	Command *Command
+}
+
+// EventHandler processes events delivered to a subscription
+type EventHandler func(Event) error
+
+// Subscription is a named consumer of events from a single source
+type Subscription struct {
+	Name      string
+	Source    EventSource
+	queue     chan Event
+	handler   EventHandler
+	delivered uint64
+	dropped   uint64
+}
+
+// SubscriptionStats describes current state of a subscription queue
+type SubscriptionStats struct {
+	Name      string
+	Source    EventSource
+	Depth     int
+	Capacity  int
+	Delivered uint64
+	Dropped   uint64
+}
+
+// Bus is an internal publish/subscribe hub. Sources publish events
+// without blocking and every subscriber consumes its own bounded queue
+// in a dedicated goroutine
+type Bus struct {
+	mutex         sync.RWMutex
+	subscriptions map[EventSource][]*Subscription
+	published     uint64
+	wg            sync.WaitGroup
+	closed        bool
+}
+
+func (b *Bus) Init() error {
+	log.Infof("Initializing Event Bus")
+	b.subscriptions = make(map[EventSource][]*Subscription)
+	return nil
+}
+
+// Subscribe registers handler for events of the given source. Handler
+// is called sequentially from a goroutine owned by the subscription
+func (b *Bus) Subscribe(source EventSource, name string, size int, handler EventHandler) (*Subscription, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("nil handler")
+	}
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return nil, fmt.Errorf("bus is closed")
+	}
+
+	sub := &Subscription{
+		Name:    name,
+		Source:  source,
+		queue:   make(chan Event, size),
+		handler: handler,
+	}
+	b.subscriptions[source] = append(b.subscriptions[source], sub)
+
+	b.wg.Add(1)
+	go b.consume(sub)
+
+	log.Debugf("%s subscribed to %s events", name, source)
+	return sub, nil
+}
+
+func (b *Bus) consume(sub *Subscription) {
+	defer b.wg.Done()
+	for event := range sub.queue {
+		if err := sub.handler(event); err != nil {
+			log.Errorf("%s failed to handle %s event: %s", sub.Name, event.Source, err.Error())
+		}
+		atomic.AddUint64(&sub.delivered, 1)
+	}
+}
+
+// Publish delivers event to every subscriber of its source. It never
+// blocks: when a subscriber queue is full the event is dropped for that
+// subscriber. Error is returned to signal backpressure only when no
+// subscriber took the event
+func (b *Bus) Publish(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if b.closed {
+		return fmt.Errorf("bus is closed")
+	}
+
+	atomic.AddUint64(&b.published, 1)
+
+	var dropped []string
+	for _, sub := range b.subscriptions[event.Source] {
+		select {
+		case sub.queue <- event:
+			if depth := len(sub.queue); depth > cap(sub.queue)*3/4 {
+				log.Warnf("Event queue of %s is almost full: %d/%d", sub.Name, depth, cap(sub.queue))
+			}
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+			dropped = append(dropped, sub.Name)
+		}
+	}
+
+	if len(dropped) == 0 {
+		return nil
+	}
+	log.Warnf("%s event dropped by %v: queue is full", event.Source, dropped)
+	// Event reached other subscribers, sending it again would duplicate it
+	if len(dropped) < len(b.subscriptions[event.Source]) {
+		return nil
+	}
+	return fmt.Errorf("queue is full for %v", dropped)
+}
+
+// Close stops accepting new events and waits until every subscriber
+// handles the events left in its queue or the context expires
+func (b *Bus) Close(ctx context.Context) error {
+	b.mutex.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, subs := range b.subscriptions {
+			for _, sub := range subs {
+				close(sub.queue)
+			}
+		}
+	}
+	b.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d events were not handled: %s", b.QueueDepth(), ctx.Err().Error())
+	}
+}
+
+// Published returns total amount of events published on the bus
+func (b *Bus) Published() uint64 {
+	return atomic.LoadUint64(&b.published)
+}
+
+// Stats returns queue depth and counters of every subscription
+func (b *Bus) Stats() []SubscriptionStats {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	result := []SubscriptionStats{}
+	for _, source := range []EventSource{SourceGitHub, SourceTravis, SourceDiscord} {
+		for _, sub := range b.subscriptions[source] {
+			result = append(result, SubscriptionStats{
+				Name:      sub.Name,
+				Source:    sub.Source,
+				Depth:     len(sub.queue),
+				Capacity:  cap(sub.queue),
+				Delivered: atomic.LoadUint64(&sub.delivered),
+				Dropped:   atomic.LoadUint64(&sub.dropped),
+			})
+		}
+	}
+	return result
+}
+
+// QueueDepth returns total amount of events waiting to be handled
+func (b *Bus) QueueDepth() int {
+	depth := 0
+	for _, s := range b.Stats() {
+		depth += s.Depth
+	}
+	return depth
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBus_Publish(t *testing.T) {
+	bus := new(Bus)
+	bus.Init()
+
+	received := make(chan Event, 1)
+	if _, err := bus.Subscribe(SourceTravis, "test", 1, func(e Event) error {
+		received <- e
+		return nil
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %s", err.Error())
+	}
+
+	packet := &TravisPacket{ID: 42}
+	if err := bus.Publish(Event{Source: SourceTravis, Travis: packet}); err != nil {
+		t.Fatalf("Publish failed: %s", err.Error())
+	}
+	if err := bus.Publish(Event{Source: SourceGitHub}); err != nil {
+		t.Errorf("Publish without subscribers failed: %s", err.Error())
+	}
+
+	select {
+	case e := <-received:
+		if e.Travis == nil || e.Travis.ID != 42 {
+			t.Errorf("Received unexpected event: %+v", e)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("Event time is not set")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Event was not delivered")
+	}
+
+	if bus.Published() != 2 {
+		t.Errorf("Published() = %d, want 2", bus.Published())
+	}
+}
+
+func TestBus_Backpressure(t *testing.T) {
+	bus := new(Bus)
+	bus.Init()
+
+	release := make(chan struct{})
+	if _, err := bus.Subscribe(SourceGitHub, "slow", 1, func(e Event) error {
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %s", err.Error())
+	}
+
+	// First event is taken by the handler, second one waits in the queue
+	bus.Publish(Event{Source: SourceGitHub})
+	deadline := time.Now().Add(time.Second)
+	for bus.QueueDepth() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := bus.Publish(Event{Source: SourceGitHub}); err != nil {
+		t.Fatalf("Publish to a queue with free space failed: %s", err.Error())
+	}
+	if err := bus.Publish(Event{Source: SourceGitHub}); err == nil {
+		t.Errorf("Publish to a full queue succeeded")
+	}
+
+	stats := bus.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("Stats() returned %d entries, want 1", len(stats))
+	}
+	if stats[0].Depth != 1 || stats[0].Capacity != 1 || stats[0].Dropped != 1 {
+		t.Errorf("Unexpected stats: %+v", stats[0])
+	}
+
+	// Event taken by another subscriber must not be sent again
+	if _, err := bus.Subscribe(SourceGitHub, "fast", 8, func(e Event) error { return nil }); err != nil {
+		t.Fatalf("Subscribe failed: %s", err.Error())
+	}
+	if err := bus.Publish(Event{Source: SourceGitHub}); err != nil {
+		t.Errorf("Publish taken by one of subscribers failed: %s", err.Error())
+	}
+	close(release)
+}
+
+func TestBus_Close(t *testing.T) {
+	bus := new(Bus)
+	bus.Init()
+
+	handled := 0
+	if _, err := bus.Subscribe(SourceTravis, "test", 8, func(e Event) error {
+		time.Sleep(time.Millisecond)
+		handled++
+		return nil
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %s", err.Error())
+	}
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(Event{Source: SourceTravis})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := bus.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %s", err.Error())
+	}
+	if handled != 5 {
+		t.Errorf("%d events handled before close, want 5", handled)
+	}
+	if err := bus.Publish(Event{Source: SourceTravis}); err == nil {
+		t.Errorf("Publish to a closed bus succeeded")
+	}
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// CommandPrefix starts every text command
+const CommandPrefix = "!"
+
+type CommandArgType uint8
+
+const (
+	// ArgString is a single word or a quoted string
+	ArgString CommandArgType = iota
+	// ArgInt is an integer number
+	ArgInt CommandArgType = iota
+	// ArgText takes the rest of the message and must be the last argument
+	ArgText CommandArgType = iota
+)
+
+// CommandCompleter suggests argument values starting from a partial value
+type CommandCompleter func(value string) []string
+
+// CommandArg describes a single command argument
+type CommandArg struct {
+	Name        string
+	Type        CommandArgType
+	Optional    bool
+	Description string
+	// Complete is used by slash commands to autocomplete argument
+	Complete CommandCompleter
+}
+
+// CommandHandler performs a command. Returned error is replied to the author
+type CommandHandler func(ctx *CommandContext) error
+
+// CommandDef describes a command registered in the router. A command
+// with subcommands may have no handler of its own
+type CommandDef struct {
+	Name        string
+	Aliases     []string
+	Usage       string
+	Args        []CommandArg
+	Subcommands []*CommandDef
+	Handler     CommandHandler
+	// Admin commands without own permission rules are accepted
+	// in the log channel only
+	Admin bool
+
+	parent *CommandDef
+}
+
+// Path returns full command name including parent commands
+func (c *CommandDef) Path() string {
+	if c.parent != nil {
+		return c.parent.Path() + " " + c.Name
+	}
+	return c.Name
+}
+
+// Syntax returns command line with argument placeholders, e.g.
+// !projects add <url> [note...]
+func (c *CommandDef) Syntax() string {
+	parts := []string{CommandPrefix + c.Path()}
+	if len(c.Subcommands) > 0 && c.Handler == nil {
+		parts = append(parts, "<subcommand>")
+	}
+	for _, arg := range c.Args {
+		name := arg.Name
+		if arg.Type == ArgText {
+			name += "..."
+		}
+		if arg.Optional {
+			parts = append(parts, "["+name+"]")
+		} else {
+			parts = append(parts, "<"+name+">")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c *CommandDef) subcommand(name string) *CommandDef {
+	for _, sub := range c.Subcommands {
+		if sub.matches(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (c *CommandDef) matches(name string) bool {
+	if strings.EqualFold(c.Name, name) {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandError is an error caused by the command message itself.
+// Usage of the command is shown together with the error
+type CommandError struct {
+	Def     *CommandDef
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
+
+// CommandContext is passed to command handlers
+type CommandContext struct {
+	Command *Command
+	Def     *CommandDef
+
+	router  *CommandRouter
+	args    map[string]interface{}
+	replied bool
+}
+
+// Has reports whether optional argument was given
+func (c *CommandContext) Has(name string) bool {
+	_, ok := c.args[name]
+	return ok
+}
+
+// String returns value of a string or text argument
+func (c *CommandContext) String(name string) string {
+	value, _ := c.args[name].(string)
+	return value
+}
+
+// Int returns value of an integer argument
+func (c *CommandContext) Int(name string) int64 {
+	value, _ := c.args[name].(int64)
+	return value
+}
+
+// Reply sends text into the channel where command was received
+func (c *CommandContext) Reply(text string) error {
+	c.replied = true
+	return c.router.reply(c.Command, text, nil)
+}
+
+// ReplyEmbed sends embed into the channel where command was received
+func (c *CommandContext) ReplyEmbed(embed *discordgo.MessageEmbed) error {
+	c.replied = true
+	return c.router.reply(c.Command, "", embed)
+}
+
+// CommandRouter parses commands received from Discord and passes
+// them to registered handlers
+type CommandRouter struct {
+	mutex       sync.RWMutex
+	commands    []*CommandDef
+	permissions *Permissions
+
+	// send delivers replies, it's replaced in tests
+	send func(channelID, text string, embed *discordgo.MessageEmbed) error
+}
+
+// Init registers help command and starts receiving commands from the bus.
+// Every command is allowed to everyone when permissions are nil
+func (r *CommandRouter) Init(discord *Discord, bus *Bus, permissions *Permissions) error {
+	if discord == nil {
+		return fmt.Errorf("nil discord")
+	}
+	if bus == nil {
+		return fmt.Errorf("nil bus")
+	}
+	r.send = discord.reply
+	r.permissions = permissions
+	if err := r.registerHelp(); err != nil {
+		return err
+	}
+
+	_, err := bus.Subscribe(SourceDiscord, "commands", 0, func(e Event) error {
+		log.Tracef("New Discord Command: %+v", e.Command)
+		return r.Handle(e.Command)
+	})
+	return err
+}
+
+// Register adds a command. Names and aliases must be unique
+func (r *CommandRouter) Register(def *CommandDef) error {
+	if err := validateCommandDef(def); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	names := append([]string{def.Name}, def.Aliases...)
+	for _, name := range names {
+		if existing := r.find(name); existing != nil {
+			return fmt.Errorf("command name %s is already used by %s", name, existing.Name)
+		}
+	}
+	r.commands = append(r.commands, def)
+	return nil
+}
+
+func validateCommandDef(def *CommandDef) error {
+	// Slash commands accept lower case names only
+	if def.Name == "" || strings.IndexFunc(def.Name, unicode.IsSpace) >= 0 || strings.ToLower(def.Name) != def.Name {
+		return fmt.Errorf("invalid command name '%s'", def.Name)
+	}
+	if def.Handler == nil && len(def.Subcommands) == 0 {
+		return fmt.Errorf("command %s has no handler", def.Name)
+	}
+	for i, arg := range def.Args {
+		if arg.Name == "" || strings.ToLower(arg.Name) != arg.Name {
+			return fmt.Errorf("command %s: invalid argument name '%s'", def.Name, arg.Name)
+		}
+		if arg.Type == ArgText && i != len(def.Args)-1 {
+			return fmt.Errorf("command %s: text argument %s must be the last one", def.Name, arg.Name)
+		}
+		if i > 0 && def.Args[i-1].Optional && !arg.Optional {
+			return fmt.Errorf("command %s: required argument %s follows an optional one", def.Name, arg.Name)
+		}
+	}
+	for _, sub := range def.Subcommands {
+		sub.parent = def
+		if err := validateCommandDef(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commands returns registered commands sorted by name
+func (r *CommandRouter) Commands() []*CommandDef {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	result := append([]*CommandDef{}, r.commands...)
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Lookup returns command by name or alias
+func (r *CommandRouter) Lookup(name string) *CommandDef {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.find(name)
+}
+
+func (r *CommandRouter) find(name string) *CommandDef {
+	for _, def := range r.commands {
+		if def.matches(name) {
+			return def
+		}
+	}
+	return nil
+}
+
+// Handle parses and performs a command. Problems with the command are
+// replied to the author, only failures to reply are returned
+func (r *CommandRouter) Handle(command *Command) error {
+	if command == nil {
+		return fmt.Errorf("nil command")
+	}
+	if command.Cmd == "" {
+		tokens, offsets, err := splitCommandOffsets(command.Text)
+		if err != nil {
+			return r.reply(command, fmt.Sprintf("Error: %s", err.Error()), nil)
+		}
+		if len(tokens) == 0 {
+			return nil
+		}
+		command.Cmd = tokens[0]
+		command.Params = tokens[1:]
+		command.rest = []string{}
+		for _, offset := range offsets[1:] {
+			command.rest = append(command.rest, strings.TrimRightFunc(command.Text[offset:], unicode.IsSpace))
+		}
+	}
+
+	name := strings.TrimPrefix(command.Cmd, CommandPrefix)
+	def := r.Lookup(name)
+	if def == nil {
+		return r.reply(command, fmt.Sprintf("Unknown command %s%s. Type %shelp to see available commands",
+			CommandPrefix, name, CommandPrefix), nil)
+	}
+
+	ctx, err := r.parse(command, def)
+	if err != nil {
+		text := fmt.Sprintf("Error: %s", err.Error())
+		if cmdErr, ok := err.(*CommandError); ok {
+			text += fmt.Sprintf("\nUsage: `%s`", cmdErr.Def.Syntax())
+		}
+		return r.reply(command, text, nil)
+	}
+
+	if r.permissions != nil {
+		if err := r.permissions.Check(ctx.Def, command); err != nil {
+			return r.reply(command, fmt.Sprintf("Error: %s", err.Error()), nil)
+		}
+	}
+
+	if err := ctx.Def.Handler(ctx); err != nil {
+		log.Errorf("Command %s from %s failed: %s", ctx.Def.Path(), command.AuthorID, err.Error())
+		return r.reply(command, fmt.Sprintf("Error: %s", err.Error()), nil)
+	}
+	if command.Reply != nil && !ctx.replied {
+		// Interaction stays in "thinking" state until something is replied
+		return r.reply(command, "Done", nil)
+	}
+	return nil
+}
+
+// parse finds subcommand and converts parameters into typed arguments
+func (r *CommandRouter) parse(command *Command, def *CommandDef) (*CommandContext, error) {
+	params := command.Params
+	rest := command.rest
+	for len(def.Subcommands) > 0 && len(params) > 0 {
+		sub := def.subcommand(params[0])
+		if sub == nil {
+			break
+		}
+		def = sub
+		params = params[1:]
+		if len(rest) > 0 {
+			rest = rest[1:]
+		}
+	}
+	if def.Handler == nil {
+		if len(params) > 0 {
+			return nil, &CommandError{Def: def, Message: fmt.Sprintf("unknown subcommand '%s'", params[0])}
+		}
+		return nil, &CommandError{Def: def, Message: "subcommand is required"}
+	}
+
+	ctx := &CommandContext{
+		Command: command,
+		Def:     def,
+		router:  r,
+		args:    make(map[string]interface{}),
+	}
+	if command.Options != nil {
+		if len(params) > 0 {
+			return nil, &CommandError{Def: def, Message: "too many arguments"}
+		}
+		return ctx, ctx.setOptions(command.Options)
+	}
+	for i, arg := range def.Args {
+		if i >= len(params) {
+			if arg.Optional {
+				break
+			}
+			return nil, &CommandError{Def: def, Message: fmt.Sprintf("missing argument %s", arg.Name)}
+		}
+		if arg.Type == ArgText {
+			// Text keeps quotes and spaces of the message
+			if i < len(rest) {
+				ctx.args[arg.Name] = rest[i]
+			} else {
+				ctx.args[arg.Name] = strings.Join(params[i:], " ")
+			}
+			return ctx, nil
+		}
+		if err := ctx.set(arg, params[i]); err != nil {
+			return nil, err
+		}
+	}
+	if len(params) > len(def.Args) {
+		return nil, &CommandError{Def: def, Message: "too many arguments"}
+	}
+	return ctx, nil
+}
+
+// setOptions takes arguments by name, which is how slash commands pass them
+func (c *CommandContext) setOptions(options map[string]string) error {
+	for _, arg := range c.Def.Args {
+		value, ok := options[arg.Name]
+		if !ok {
+			if arg.Optional {
+				continue
+			}
+			return &CommandError{Def: c.Def, Message: fmt.Sprintf("missing argument %s", arg.Name)}
+		}
+		if err := c.set(arg, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CommandContext) set(arg CommandArg, value string) error {
+	switch arg.Type {
+	case ArgString, ArgText:
+		c.args[arg.Name] = value
+	case ArgInt:
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return &CommandError{Def: c.Def, Message: fmt.Sprintf("argument %s must be a number: '%s'", arg.Name, value)}
+		}
+		c.args[arg.Name] = number
+	}
+	return nil
+}
+
+func (r *CommandRouter) reply(command *Command, text string, embed *discordgo.MessageEmbed) error {
+	if command.Reply != nil {
+		return command.Reply(text, embed)
+	}
+	if r.send == nil {
+		return fmt.Errorf("no reply destination")
+	}
+	return r.send(command.ChannelID, text, embed)
+}
+
+func (r *CommandRouter) registerHelp() error {
+	return r.Register(&CommandDef{
+		Name:    "help",
+		Aliases: []string{"commands"},
+		Usage:   "Show available commands or details about a single command",
+		Args:    []CommandArg{{Name: "command", Type: ArgText, Optional: true}},
+		Handler: r.help,
+	})
+}
+
+func (r *CommandRouter) help(ctx *CommandContext) error {
+	if !ctx.Has("command") {
+		lines := []string{"Available commands:"}
+		for _, def := range r.Commands() {
+			lines = append(lines, fmt.Sprintf("`%s` %s", def.Syntax(), def.Usage))
+		}
+		lines = append(lines, fmt.Sprintf("Type `%shelp <command>` for details", CommandPrefix))
+		return ctx.Reply(strings.Join(lines, "\n"))
+	}
+
+	path, _ := splitCommand(ctx.String("command"))
+	if len(path) == 0 {
+		return fmt.Errorf("empty command name")
+	}
+	def := r.Lookup(strings.TrimPrefix(path[0], CommandPrefix))
+	if def == nil {
+		return fmt.Errorf("unknown command %s", path[0])
+	}
+	for _, name := range path[1:] {
+		sub := def.subcommand(name)
+		if sub == nil {
+			return fmt.Errorf("%s has no subcommand %s", def.Path(), name)
+		}
+		def = sub
+	}
+	return ctx.Reply(commandHelp(def))
+}
+
+// commandHelp describes command, its arguments and subcommands
+func commandHelp(def *CommandDef) string {
+	lines := []string{fmt.Sprintf("`%s`", def.Syntax())}
+	if def.Usage != "" {
+		lines = append(lines, def.Usage)
+	}
+	if len(def.Aliases) > 0 {
+		lines = append(lines, "Aliases: "+strings.Join(def.Aliases, ", "))
+	}
+	for _, arg := range def.Args {
+		if arg.Description != "" {
+			lines = append(lines, fmt.Sprintf("  %s: %s", arg.Name, arg.Description))
+		}
+	}
+	if len(def.Subcommands) > 0 {
+		lines = append(lines, "Subcommands:")
+		for _, sub := range def.Subcommands {
+			lines = append(lines, fmt.Sprintf("  `%s` %s", sub.Syntax(), sub.Usage))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// splitCommand splits message into words. Words in double quotes are
+// kept together and backslash escapes the next character. Single quotes
+// are left alone because they are common in plain text
+func splitCommand(text string) ([]string, error) {
+	result, _, err := splitCommandOffsets(text)
+	return result, err
+}
+
+// splitCommandOffsets also returns byte offset in text where every word
+// starts, including its opening quote
+func splitCommandOffsets(text string) ([]string, []int, error) {
+	result := []string{}
+	offsets := []int{}
+	var word strings.Builder
+	var quote rune
+	inWord := false
+	escaped := false
+
+	for i, c := range text {
+		if !inWord && !unicode.IsSpace(c) {
+			offsets = append(offsets, i)
+		}
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"':
+			quote = c
+			inWord = true
+		case unicode.IsSpace(c):
+			if inWord {
+				result = append(result, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, nil, fmt.Errorf("unterminated quote")
+	}
+	if escaped {
+		word.WriteRune('\\')
+	}
+	if inWord {
+		result = append(result, word.String())
+	}
+	return result, offsets, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+		err  bool
+	}{
+		{"!help", []string{"!help"}, false},
+		{"  !projects   add  github.com/owner/repo ", []string{"!projects", "add", "github.com/owner/repo"}, false},
+		{`!say "hello world" again`, []string{"!say", "hello world", "again"}, false},
+		{`!say "" empty`, []string{"!say", "", "empty"}, false},
+		{`!say say\ \"hi\"`, []string{"!say", `say "hi"`}, false},
+		{"!say don't", []string{"!say", "don't"}, false},
+		{`!say "unterminated`, nil, true},
+		{"", []string{}, false},
+	}
+	for _, tt := range tests {
+		got, err := splitCommand(tt.text)
+		if (err != nil) != tt.err {
+			t.Errorf("splitCommand(%q) error = %v, want error %v", tt.text, err, tt.err)
+			continue
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCommandRouter_Handle(t *testing.T) {
+	var replies []string
+	router := new(CommandRouter)
+	router.send = func(channelID, text string, embed *discordgo.MessageEmbed) error {
+		replies = append(replies, text)
+		return nil
+	}
+	if err := router.registerHelp(); err != nil {
+		t.Fatalf("Failed to register help: %s", err.Error())
+	}
+
+	err := router.Register(&CommandDef{
+		Name:    "projects",
+		Aliases: []string{"p"},
+		Usage:   "Manage projects",
+		Subcommands: []*CommandDef{
+			{
+				Name: "add",
+				Args: []CommandArg{{Name: "url"}, {Name: "note", Type: ArgText, Optional: true}},
+				Handler: func(ctx *CommandContext) error {
+					return ctx.Reply("added " + ctx.String("url") + " " + ctx.String("note"))
+				},
+			},
+			{
+				Name: "top",
+				Args: []CommandArg{{Name: "count", Type: ArgInt}},
+				Handler: func(ctx *CommandContext) error {
+					if ctx.Int("count") > 10 {
+						return fmt.Errorf("test failure")
+					}
+					return ctx.Reply("ok")
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register command: %s", err.Error())
+	}
+	if err := router.Register(&CommandDef{Name: "top", Aliases: []string{"p"}, Handler: func(*CommandContext) error { return nil }}); err == nil {
+		t.Errorf("Command with a duplicate alias was registered")
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`!projects add github.com/owner/repo "first project"`, `added github.com/owner/repo "first project"`},
+		{"!projects add github.com/owner/repo  two  spaces ", "added github.com/owner/repo two  spaces"},
+		{`!P ADD github.com/owner/repo two words`, "added github.com/owner/repo two words"},
+		{"!projects add", "Error: missing argument url\nUsage: `!projects add <url> [note...]`"},
+		{"!projects top ten", "Error: argument count must be a number: 'ten'"},
+		{"!projects top 11", "Error: test failure"},
+		{"!projects top 1 2", "Error: too many arguments"},
+		{"!projects remove", "Error: unknown subcommand 'remove'\nUsage: `!projects <subcommand>`"},
+		{"!projects", "Error: subcommand is required"},
+		{"!unknown", "Unknown command !unknown"},
+		{`!projects add "repo`, "Error: unterminated quote"},
+		{"!help", "`!projects <subcommand>` Manage projects"},
+		{"!help p add", "`!projects add <url> [note...]`"},
+	}
+	for _, tt := range tests {
+		replies = nil
+		if err := router.Handle(&Command{Text: tt.text}); err != nil {
+			t.Errorf("%s: Handle failed: %s", tt.text, err.Error())
+			continue
+		}
+		if len(replies) != 1 || !strings.Contains(replies[0], tt.want) {
+			t.Errorf("%s: replies = %q, want %q", tt.text, replies, tt.want)
+		}
+	}
+}
+
+func TestCommandRouter_Options(t *testing.T) {
+	router := new(CommandRouter)
+	var got string
+	err := router.Register(&CommandDef{
+		Name: "restart",
+		Args: []CommandArg{{Name: "project"}, {Name: "build", Type: ArgInt, Optional: true}},
+		Handler: func(ctx *CommandContext) error {
+			got = fmt.Sprintf("%s %d %v", ctx.String("project"), ctx.Int("build"), ctx.Has("build"))
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register command: %s", err.Error())
+	}
+
+	var replies []string
+	reply := func(text string, embed *discordgo.MessageEmbed) error {
+		replies = append(replies, text)
+		return nil
+	}
+
+	router.Handle(&Command{Cmd: "restart", Options: map[string]string{"project": "eveleve", "build": "7"}, Reply: reply})
+	if got != "eveleve 7 true" {
+		t.Errorf("Handler got %s", got)
+	}
+	// Interaction waits for a response even if handler replied nothing
+	if len(replies) != 1 || replies[0] != "Done" {
+		t.Errorf("replies = %q, want Done", replies)
+	}
+
+	replies = nil
+	router.Handle(&Command{Cmd: "restart", Options: map[string]string{"build": "7"}, Reply: reply})
+	if len(replies) != 1 || !strings.Contains(replies[0], "missing argument project") {
+		t.Errorf("replies = %q, want missing argument error", replies)
+	}
+}
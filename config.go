@@ -5,29 +5,81 @@ import (
 	log "github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
 	"io/ioutil"
+	"time"
 )
 
 type Config struct {
-	TLS         TLSConfig     `yaml:"tls"`
-	GitHub      GitHubConfig  `yaml:"github"`
-	Travis      TravisConfig  `yaml:"travis"`
-	Discord     DiscordConfig `yaml:"discord"`
-	Git         GitConfig     `yaml:"git"`
-	ID          string        `yaml:"id"`
-	Description string        `yaml:"description"`
-	Projects    []string      `yaml:"projects"`
+	HTTP     HTTPConfig     `yaml:"http"`
+	TLS      TLSConfig      `yaml:"tls"`
+	GitHub   GitHubConfig   `yaml:"github"`
+	Travis   TravisConfig   `yaml:"travis"`
+	Discord  DiscordConfig  `yaml:"discord"`
+	Git      GitConfig      `yaml:"git"`
+	Shutdown ShutdownConfig `yaml:"shutdown"`
+	Storage  StorageConfig  `yaml:"storage"`
+	API      APIConfig      `yaml:"api"`
+	Push     PushConfig     `yaml:"push"`
+
+	Permissions PermissionsConfig `yaml:"permissions"`
+	ID          string            `yaml:"id"`
+	Description string            `yaml:"description"`
+	Projects    []string          `yaml:"projects"`
+	// Routes send notifications into channels other than event channel
+	Routes []RoutingRule `yaml:"routes"`
+	// Digests summarize event history on schedule
+	Digests []DigestConfig `yaml:"digests"`
+
+	Notifications map[string]NotificationConfig `yaml:"notifications"`
+}
+
+// HTTPConfig describes listener shared by all webhook receivers
+type HTTPConfig struct {
+	Address string `yaml:"address"`
+	Port    uint16 `yaml:"port"`
+	// Plain disables TLS when it is terminated by a reverse proxy
+	Plain bool `yaml:"plain"`
+	// TrustProxy makes request log use X-Forwarded-For header
+	TrustProxy   bool          `yaml:"trust_proxy"`
+	MaxBodySize  int64         `yaml:"max_body_size"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
 }
 
 type GitHubConfig struct {
-	Port   uint16 `yaml:"port"`
-	URI    string `yaml:"uri"`
-	Secret string `yaml:"secret"`
+	URI         string `yaml:"uri"`
+	Secret      string `yaml:"secret"`
+	MaxBodySize int64  `yaml:"max_body_size"`
+	// Secrets override Secret for matching projects
+	Secrets []ProjectSecret `yaml:"secrets"`
+	API     GitHubAPIConfig `yaml:"api"`
+}
+
+// GitHubAPIConfig enables commands which act on GitHub. Token is used
+// when set, GitHub App credentials otherwise
+type GitHubAPIConfig struct {
+	URL            string        `yaml:"url"`
+	Token          string        `yaml:"token"`
+	AppID          int64         `yaml:"app_id"`
+	InstallationID int64         `yaml:"installation_id"`
+	PrivateKey     string        `yaml:"private_key"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+// Enabled reports whether any credentials are configured
+func (c GitHubAPIConfig) Enabled() bool {
+	return c.Token != "" || c.AppID != 0
+}
+
+// ProjectSecret is a webhook secret of projects matching patterns
+type ProjectSecret struct {
+	Projects []string `yaml:"projects"`
+	Secret   string   `yaml:"secret"`
 }
 
 type TravisConfig struct {
-	Port uint16 `yaml:"port"`
-	URI  string `yaml:"uri"`
-	API  string `yaml:"api"`
+	URI         string `yaml:"uri"`
+	API         string `yaml:"api"`
+	MaxBodySize int64  `yaml:"max_body_size"`
 }
 
 type GitConfig struct {
@@ -39,6 +91,117 @@ type DiscordConfig struct {
 	LogChannel    string `yaml:"log_channel"`
 	EventChannel  string `yaml:"event_channel"`
 	StatusChannel string `yaml:"status_channel"`
+	// BoardChannel keeps a single message per pull request. Board is
+	// disabled when it's empty
+	BoardChannel string `yaml:"board_channel"`
+	// Guilds where slash commands are registered. Commands are
+	// registered globally when the list is empty
+	Guilds []string `yaml:"guilds"`
+}
+
+// ShutdownConfig limits how long every shutdown stage may take
+type ShutdownConfig struct {
+	HTTPTimeout    time.Duration `yaml:"http_timeout"`
+	DrainTimeout   time.Duration `yaml:"drain_timeout"`
+	DiscordTimeout time.Duration `yaml:"discord_timeout"`
+}
+
+// StorageConfig describes local database with bot state
+type StorageConfig struct {
+	Path string `yaml:"path"`
+	// Retention limits how long event history is kept
+	Retention time.Duration `yaml:"retention"`
+	// Deliveries is amount of webhook deliveries remembered to drop
+	// duplicates
+	Deliveries int `yaml:"deliveries"`
+}
+
+// PermissionsConfig maps commands to rules. Commands are named by their
+// full path, e.g. "projects add". Rule of a parent command applies to
+// subcommands without own rules
+type PermissionsConfig struct {
+	Default  CommandPermission            `yaml:"default"`
+	Commands map[string]CommandPermission `yaml:"commands"`
+}
+
+// CommandPermission allows command when nothing from Deny matches and
+// both author and channel match Allow. Empty lists in Allow match everything
+type CommandPermission struct {
+	Allow    PermissionRule `yaml:"allow"`
+	Deny     PermissionRule `yaml:"deny"`
+	Cooldown time.Duration  `yaml:"cooldown"`
+}
+
+// PermissionRule lists Discord IDs of roles, users and channels
+type PermissionRule struct {
+	Roles    []string `yaml:"roles"`
+	Users    []string `yaml:"users"`
+	Channels []string `yaml:"channels"`
+}
+
+// PushConfig controls notifications about pushes
+type PushConfig struct {
+	// Window merges pushes to the same branch into a single notification
+	// until the branch is quiet for the window. Every push is sent right
+	// away when it's zero
+	Window time.Duration `yaml:"window"`
+	// Filters hide pushes and commits from notifications
+	Filters []PushFilter `yaml:"filters"`
+}
+
+// PushFilter applies to pushes of matching projects, every project when
+// there are no patterns. Commits which don't pass are left out of the
+// notification, push without commits left is not announced
+type PushFilter struct {
+	Projects []string `yaml:"projects"`
+	// Branches announced, every branch when empty
+	Branches       []string `yaml:"branches"`
+	IgnoreBranches []string `yaml:"ignore_branches"`
+	// IgnoreAuthors are GitHub logins, names or emails. Pushes sent by
+	// them are not announced at all
+	IgnoreAuthors []string `yaml:"ignore_authors"`
+	// SkipMarkers hide commits with one of them in the message
+	SkipMarkers []string `yaml:"skip_markers"`
+	// Paths keep commits changing at least one matching file
+	Paths []string `yaml:"paths"`
+	// IgnorePaths hide commits changing matching files only
+	IgnorePaths []string `yaml:"ignore_paths"`
+}
+
+// DigestConfig describes a development digest posted on schedule
+type DigestConfig struct {
+	Name string `yaml:"name"`
+	// Schedule is a cron expression, e.g. "0 9 * * mon"
+	Schedule string `yaml:"schedule"`
+	// Period covered by the digest, a day by default
+	Period time.Duration `yaml:"period"`
+	// Channel defaults to the event channel
+	Channel string `yaml:"channel"`
+	// Projects limit digest to matching projects
+	Projects []string `yaml:"projects"`
+}
+
+// RoutingRule sends matching notifications into channels. Empty lists
+// match everything. Projects, branches and labels are glob patterns
+type RoutingRule struct {
+	Name     string   `yaml:"name"`
+	Projects []string `yaml:"projects"`
+	// Events are GitHub event names, e.g. push or pull_request, and
+	// build for Travis CI builds
+	Events   []string `yaml:"events"`
+	Actions  []string `yaml:"actions"`
+	Branches []string `yaml:"branches"`
+	Labels   []string `yaml:"labels"`
+	Channels []string `yaml:"channels"`
+}
+
+// APIConfig describes admin API for local scripts and game servers.
+// API is disabled when port is not set
+type APIConfig struct {
+	Address string `yaml:"address"`
+	Port    uint16 `yaml:"port"`
+	// Token is expected in the Authorization: Bearer header
+	Token string `yaml:"token"`
 }
 
 type TLSConfig struct {
@@ -47,16 +210,67 @@ type TLSConfig struct {
 }
 
 func (c *Config) Init(filename string) error {
+	return c.load(filename, yaml.Unmarshal)
+}
+
+// InitStrict works like Init but fails on unknown fields
+func (c *Config) InitStrict(filename string) error {
+	return c.load(filename, yaml.UnmarshalStrict)
+}
+
+func (c *Config) load(filename string, unmarshal func([]byte, interface{}) error) error {
 	log.Infof("Reading configuration from %s", filename)
 	yamlFile, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return fmt.Errorf("Config not found: %s", err.Error())
 	}
 
-	err = yaml.Unmarshal(yamlFile, c)
+	err = unmarshal(yamlFile, c)
 	if err != nil {
 		return fmt.Errorf("Couldn't parse yaml: %s", err.Error())
 	}
 
+	c.setDefaults()
 	return nil
 }
+
+func (c *Config) setDefaults() {
+	if c.HTTP.ReadTimeout == 0 {
+		c.HTTP.ReadTimeout = time.Second * 30
+	}
+	if c.HTTP.WriteTimeout == 0 {
+		c.HTTP.WriteTimeout = time.Second * 30
+	}
+	if c.Shutdown.HTTPTimeout == 0 {
+		c.Shutdown.HTTPTimeout = time.Second * 10
+	}
+	if c.Shutdown.DrainTimeout == 0 {
+		c.Shutdown.DrainTimeout = time.Second * 30
+	}
+	if c.Shutdown.DiscordTimeout == 0 {
+		c.Shutdown.DiscordTimeout = time.Second * 10
+	}
+	if c.Storage.Path == "" {
+		c.Storage.Path = "/var/lib/eveleve/eveleve.db"
+	}
+	if c.Storage.Retention == 0 {
+		c.Storage.Retention = time.Hour * 24 * 90
+	}
+	if c.Storage.Deliveries == 0 {
+		c.Storage.Deliveries = 10000
+	}
+	if c.API.Address == "" {
+		c.API.Address = "127.0.0.1"
+	}
+	if c.GitHub.API.URL == "" {
+		c.GitHub.API.URL = "https://api.github.com"
+	}
+	if c.GitHub.API.Timeout == 0 {
+		c.GitHub.API.Timeout = time.Second * 10
+	}
+	for i := range c.Digests {
+		if c.Digests[i].Period == 0 {
+			c.Digests[i].Period = time.Hour * 24
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+// DefaultConfig is an annotated configuration template printed
+// by the default-config command
+const DefaultConfig = `# EvelEve configuration file
+
+# Bot identity, used in logs only
+id: eveleve
+description: Discord Bot for Indie Game Developers
+
+discord:
+  # Bot token from the Discord Developer Portal
+  token: "YOUR_BOT_TOKEN"
+  # Channel for service messages. Admin commands are accepted here
+  log_channel: "000000000000000000"
+  # Channel for GitHub and Travis CI notifications
+  event_channel: "000000000000000000"
+  # Channel with a single status message which is updated periodically
+  status_channel: "000000000000000000"
+  # Channel with a single message per pull request which is edited as
+  # the pull request is reviewed, built and merged. When empty, pull
+  # requests are posted as other events, following routes and notifications
+  board_channel: ""
+  # Guilds where slash commands are registered instantly. When empty,
+  # commands are registered globally and may take up to an hour to appear
+  guilds: []
+
+http:
+  # Listener shared by GitHub and Travis CI webhook receivers
+  address: ""
+  port: 1280
+  # Serve plain HTTP when TLS is terminated by a reverse proxy
+  plain: false
+  # Log client address from X-Forwarded-For header
+  trust_proxy: false
+  # Request body limit in bytes, used when receiver has no own limit
+  max_body_size: 1048576
+  read_timeout: 30s
+  write_timeout: 30s
+
+# Certificate used when http.plain is false
+tls:
+  cert: /etc/eveleve/cert.pem
+  key: /etc/eveleve/key.pem
+
+github:
+  # URI of the GitHub webhook receiver
+  uri: "/github"
+  # Secret configured in the repository webhook settings
+  secret: ""
+  # Secrets of projects which don't use the secret above. The first entry
+  # matching the project is used, projects are written as in the list of
+  # projects below
+  secrets: []
+  #  - projects: ["github.com/savageking-io/*"]
+  #    secret: ""
+  # GitHub payloads can be large, e.g. pushes with many commits
+  max_body_size: 26214400
+  # GitHub REST API used by !issue, !pr and !release commands. The commands
+  # are disabled unless a token or GitHub App credentials are set
+  api:
+    url: "https://api.github.com"
+    # Fine-grained personal access token with issues and pull requests access
+    token: ""
+    # GitHub App installed into the repositories, used when token is empty
+    app_id: 0
+    installation_id: 0
+    # PEM file with the private key of the GitHub App
+    private_key: ""
+    timeout: 10s
+
+travis:
+  # URI of the Travis CI webhook receiver
+  uri: "/travis"
+  # Travis API endpoint used to fetch public key for signature verification
+  api: "https://api.travis-ci.org/config"
+  max_body_size: 1048576
+
+shutdown:
+  # Time to finish active webhook requests
+  http_timeout: 10s
+  # Time to deliver already received events to Discord
+  drain_timeout: 30s
+  # Time to post the offline message and disconnect from Discord
+  discord_timeout: 10s
+
+storage:
+  # Database with projects, status message and event history
+  path: /var/lib/eveleve/eveleve.db
+  # How long event history is kept
+  retention: 2160h
+  # Amount of GitHub deliveries and Travis CI build states remembered to
+  # drop redelivered webhooks
+  deliveries: 10000
+
+api:
+  # Admin API for build scripts and game servers. Disabled when port is 0
+  address: 127.0.0.1
+  port: 0
+  # Clients send it in the "Authorization: Bearer <token>" header
+  token: ""
+
+permissions:
+  # Rule for commands which have no own rule. Admin commands, like reload,
+  # are accepted in the log channel only unless they have own rule
+  default:
+    allow:
+      roles: []
+      users: []
+      channels: []
+    deny:
+      roles: []
+      users: []
+      channels: []
+  # Rules by command name, e.g. "projects" or "projects add". Own rule
+  # of an admin command replaces the log channel restriction
+  commands:
+    help:
+      # Minimum time between two uses of the command by the same user
+      cooldown: 5s
+
+push:
+  # Pushes to the same branch are sent as a single notification once
+  # the branch has no new pushes for this time, but no later than five
+  # times this time after the first push. Set to 0 to send every push
+  # right away
+  window: 1m
+  # Filters hide pushes of matching projects, every project when there
+  # are no projects. Pushes to branches not listed in branches or listed
+  # in ignore_branches and pushes sent by ignored authors are not
+  # announced. Commits of ignored authors, with a skip marker in the
+  # message, changing no file from paths or only files from ignore_paths
+  # are left out. Patterns accept * and ?, ** matches any number of
+  # directories
+  filters: []
+  #  - projects: [savageking-io/*]
+  #    ignore_branches: ["wip/*", "dependabot/**"]
+  #    ignore_authors: ["dependabot[bot]"]
+  #    skip_markers: ["[skip discord]"]
+  #    ignore_paths: [".travis.yml", ".github/**", "**/*.md"]
+
+# Notifications matching a route are sent into its channels instead of
+# the event channel. Every matching route is used. Empty lists match
+# everything, projects, branches and labels accept * and ? wildcards.
+# Events: push, issues, issue_comment, commit_comment, fork, milestone,
+# pull_request, pull_request_review, pull_request_review_comment,
+# release, repository_vulnerability_alert, security_advisory and build
+routes: []
+#  - name: security
+#    events: [repository_vulnerability_alert, security_advisory]
+#    channels: ["000000000000000000"]
+#  - name: announcements
+#    events: [release]
+#    channels: ["000000000000000000"]
+#  - name: eveleve
+#    projects: [savageking-io/eveleve]
+#    branches: [master, "release/*"]
+#    channels: ["000000000000000000"]
+
+# Digests summarize commits, issues, merged pull requests, releases, CI
+# pass rate and top contributors on schedule. Schedule is a cron
+# expression "minute hour day-of-month month day-of-week" or one of
+# @hourly, @daily, @weekly and @monthly. Period is covered by the digest,
+# channel defaults to the event channel, projects accept * wildcards
+digests: []
+#  - name: Daily digest
+#    schedule: "0 9 * * *"
+#    period: 24h
+#  - name: Weekly digest
+#    schedule: "0 18 * * fri"
+#    period: 168h
+#    channel: "000000000000000000"
+#    projects: [savageking-io/*]
+
+# Embed templates by event name, e.g. "push", or by event and action,
+# e.g. "issues.opened". Texts are Go templates, see text/template, with
+#   .Event   - event summary: Type, Action, Project, Branch, Actor,
+#              Number, Title, URL, Commits, Authors, Labels, Result, Merged
+#   .Payload - webhook payload as sent by GitHub or Travis CI
+#   .Default - built-in embed: Title, URL, Description, Color, Fields...
+# and functions truncate, join, lower, upper and firstLine. Empty texts
+# keep built-in values, configured fields replace built-in fields
+notifications: {}
+#  issues.opened:
+#    title: "[{{ .Event.Project }}] {{ .Default.Title }}"
+#    color: 0x2cbe4e
+#    fields:
+#      - name: Labels
+#        value: '{{ join ", " .Event.Labels }}'
+#        inline: true
+#  build:
+#    description: "{{ .Event.Result }}: {{ truncate 200 .Payload.Message }}"
+#    footer:
+#      text: "Build #{{ .Event.Number }} on {{ .Event.Branch }}"
+
+# Repositories allowed to send webhooks: github.com/owner/repository,
+# globs like github.com/owner/* or regular expressions in slashes like
+# /^github\.com/owner/eve/. Entries starting with ! deny matching
+# repositories, e.g. !github.com/owner/private-*
+projects:
+  - github.com/savageking-io/eveleve
+`
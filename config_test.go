@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eveleve")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	conf := new(Config)
+	if err := yaml.UnmarshalStrict([]byte(DefaultConfig), conf); err != nil {
+		t.Fatalf("Default config can't be parsed: %s", err.Error())
+	}
+	conf.setDefaults()
+
+	conf.TLS.Cert = filepath.Join(dir, "cert.pem")
+	conf.TLS.Key = filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(conf.TLS.Cert, []byte{}, 0600)
+	ioutil.WriteFile(conf.TLS.Key, []byte{}, 0600)
+
+	if err := conf.Validate(); err != nil {
+		t.Errorf("Default config is invalid: %s", err.Error())
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	conf := new(Config)
+	if err := yaml.Unmarshal([]byte(DefaultConfig), conf); err != nil {
+		t.Fatalf("Default config can't be parsed: %s", err.Error())
+	}
+	conf.Discord.EventChannel = "#events"
+	conf.GitHub.URI = "github"
+	conf.Travis.URI = conf.GitHub.URI
+	conf.Projects = append(conf.Projects, "gitlab.com/owner/repo", "github.com/owner")
+
+	err := conf.Validate()
+	if err == nil {
+		t.Fatalf("Validate() succeeded on invalid config")
+	}
+	errs, ok := err.(ConfigErrors)
+	if !ok {
+		t.Fatalf("Validate() returned %T, want ConfigErrors", err)
+	}
+
+	want := []string{
+		"discord.event_channel",
+		"github.uri",
+		"travis.uri must start",
+		"tls.cert",
+		"tls.key",
+		"must be different",
+		"projects[1]",
+		"projects[2]",
+	}
+	if len(errs) != len(want) {
+		t.Errorf("Validate() returned %d errors, want %d: %v", len(errs), len(want), errs)
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range errs {
+			if strings.Contains(e, w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("No error mentions %s: %v", w, errs)
+		}
+	}
+}
+
+func TestMaster_InitConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	// Configuration written before http section was added
+	data := "discord:\n  token: token\ngithub:\n  port: 8080\n"
+	if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write config: %s", err.Error())
+	}
+
+	m := &Master{ConfigFile: filename}
+	err := m.InitConfig()
+	if err == nil || !strings.Contains(err.Error(), "http.port is not set") {
+		t.Errorf("InitConfig() error = %v, want invalid configuration", err)
+	}
+	if m.Config != nil {
+		t.Errorf("Invalid configuration was kept")
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// snowflake matches Discord IDs of users, channels, roles and guilds
+var snowflake = regexp.MustCompile(`^[0-9]{17,20}$`)
+
+// ConfigErrors is a list of problems found during configuration validation
+type ConfigErrors []string
+
+func (e ConfigErrors) Error() string {
+	return strings.Join(e, "; ")
+}
+
+func (e *ConfigErrors) add(format string, args ...interface{}) {
+	*e = append(*e, fmt.Sprintf(format, args...))
+}
+
+// Validate checks every configuration field and returns ConfigErrors
+// describing all problems found
+func (c *Config) Validate() error {
+	errs := ConfigErrors{}
+
+	c.validateDiscord(&errs)
+	c.validateHTTP(&errs)
+	c.validateGitHub(&errs)
+	c.validateTravis(&errs)
+	c.validateAPI(&errs)
+	c.validatePermissions(&errs)
+	c.validateRoutes(&errs)
+	c.validateNotifications(&errs)
+	c.validateDigests(&errs)
+
+	for i, project := range c.Projects {
+		if _, err := parseProjectPattern(project); err != nil {
+			errs.add("projects[%d]: %s", i, err.Error())
+		}
+	}
+
+	if c.Shutdown.HTTPTimeout < 0 || c.Shutdown.DrainTimeout < 0 || c.Shutdown.DiscordTimeout < 0 {
+		errs.add("shutdown timeouts can't be negative")
+	}
+
+	if c.Push.Window < 0 {
+		errs.add("push.window can't be negative")
+	}
+	for i, filter := range c.Push.Filters {
+		for _, patterns := range [][]string{filter.Projects, filter.Branches, filter.IgnoreBranches, filter.Paths, filter.IgnorePaths} {
+			for _, pattern := range patterns {
+				if err := validateGlob(pattern); err != nil {
+					errs.add("push.filters[%d] has invalid pattern '%s': %s", i, pattern, err.Error())
+				}
+			}
+		}
+	}
+
+	if c.Storage.Retention < 0 {
+		errs.add("storage.retention can't be negative")
+	}
+	if c.Storage.Deliveries < 0 {
+		errs.add("storage.deliveries can't be negative")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Config) validateDiscord(errs *ConfigErrors) {
+	if c.Discord.Token == "" {
+		errs.add("discord.token is empty")
+	}
+	validateChannel(errs, "discord.log_channel", c.Discord.LogChannel)
+	validateChannel(errs, "discord.event_channel", c.Discord.EventChannel)
+	validateChannel(errs, "discord.status_channel", c.Discord.StatusChannel)
+	if c.Discord.BoardChannel != "" {
+		validateChannel(errs, "discord.board_channel", c.Discord.BoardChannel)
+	}
+	for i, guild := range c.Discord.Guilds {
+		if !snowflake.MatchString(guild) {
+			errs.add("discord.guilds[%d] is not a valid Discord guild ID: '%s'", i, guild)
+		}
+	}
+}
+
+func (c *Config) validateHTTP(errs *ConfigErrors) {
+	if c.HTTP.Port == 0 {
+		errs.add("http.port is not set")
+	}
+	if c.HTTP.MaxBodySize < 0 {
+		errs.add("http.max_body_size can't be negative")
+	}
+	if !c.HTTP.Plain {
+		c.validateTLS(errs)
+	}
+}
+
+func (c *Config) validateGitHub(errs *ConfigErrors) {
+	validateURI(errs, "github.uri", c.GitHub.URI)
+	if c.GitHub.MaxBodySize < 0 {
+		errs.add("github.max_body_size can't be negative")
+	}
+	for i, secret := range c.GitHub.Secrets {
+		if secret.Secret == "" {
+			errs.add("github.secrets[%d].secret is empty", i)
+		}
+		if len(secret.Projects) == 0 {
+			errs.add("github.secrets[%d] has no projects", i)
+		}
+		for _, project := range secret.Projects {
+			if _, err := parseProjectPattern(project); err != nil {
+				errs.add("github.secrets[%d]: %s", i, err.Error())
+			}
+		}
+	}
+
+	api := c.GitHub.API
+	if u, err := url.ParseRequestURI(api.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		errs.add("github.api.url must be a http(s) URL: '%s'", api.URL)
+	}
+	if api.Timeout < 0 {
+		errs.add("github.api.timeout can't be negative")
+	}
+	if api.Token == "" && (api.AppID != 0 || api.InstallationID != 0 || api.PrivateKey != "") {
+		if api.AppID == 0 {
+			errs.add("github.api.app_id is not set")
+		}
+		if api.InstallationID == 0 {
+			errs.add("github.api.installation_id is not set")
+		}
+		validateFile(errs, "github.api.private_key", api.PrivateKey)
+	}
+}
+
+func (c *Config) validateTravis(errs *ConfigErrors) {
+	validateURI(errs, "travis.uri", c.Travis.URI)
+	if c.Travis.URI == c.GitHub.URI {
+		errs.add("travis.uri and github.uri must be different")
+	}
+	if c.Travis.MaxBodySize < 0 {
+		errs.add("travis.max_body_size can't be negative")
+	}
+	if u, err := url.ParseRequestURI(c.Travis.API); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		errs.add("travis.api must be a http(s) URL: '%s'", c.Travis.API)
+	}
+}
+
+func (c *Config) validateAPI(errs *ConfigErrors) {
+	if c.API.Port == 0 {
+		return
+	}
+	if c.API.Port == c.HTTP.Port {
+		errs.add("api.port and http.port must be different")
+	}
+	if len(c.API.Token) < 16 {
+		errs.add("api.token must be at least 16 characters long")
+	}
+}
+
+func (c *Config) validatePermissions(errs *ConfigErrors) {
+	validatePermission(errs, "permissions.default", c.Permissions.Default)
+	for name, permission := range c.Permissions.Commands {
+		validatePermission(errs, fmt.Sprintf("permissions.commands[%s]", name), permission)
+	}
+}
+
+func validatePermission(errs *ConfigErrors, name string, permission CommandPermission) {
+	if permission.Cooldown < 0 {
+		errs.add("%s.cooldown can't be negative", name)
+	}
+	for kind, rule := range map[string]PermissionRule{"allow": permission.Allow, "deny": permission.Deny} {
+		for _, ids := range [][]string{rule.Roles, rule.Users, rule.Channels} {
+			for _, id := range ids {
+				if !snowflake.MatchString(id) {
+					errs.add("%s.%s has invalid Discord ID '%s'", name, kind, id)
+				}
+			}
+		}
+	}
+}
+
+func (c *Config) validateRoutes(errs *ConfigErrors) {
+	events := routingEvents()
+	for i, rule := range c.Routes {
+		name := fmt.Sprintf("routes[%d]", i)
+		if rule.Name != "" {
+			name = fmt.Sprintf("routes[%s]", rule.Name)
+		}
+		if len(rule.Channels) == 0 {
+			errs.add("%s has no channels", name)
+		}
+		for _, id := range rule.Channels {
+			if !snowflake.MatchString(id) {
+				errs.add("%s has invalid Discord channel ID '%s'", name, id)
+			}
+		}
+		for _, event := range rule.Events {
+			if !containsString(events, event) {
+				errs.add("%s has unknown event '%s'", name, event)
+			}
+		}
+		for _, patterns := range [][]string{rule.Projects, rule.Branches, rule.Labels} {
+			for _, pattern := range patterns {
+				if err := validateGlob(pattern); err != nil {
+					errs.add("%s has invalid pattern '%s': %s", name, pattern, err.Error())
+				}
+			}
+		}
+	}
+}
+
+func (c *Config) validateNotifications(errs *ConfigErrors) {
+	events := routingEvents()
+	for key, conf := range c.Notifications {
+		event := strings.SplitN(key, ".", 2)[0]
+		if !containsString(events, event) {
+			errs.add("notifications[%s]: unknown event '%s'", key, event)
+		}
+		if _, err := compileTemplate(key, conf); err != nil {
+			errs.add("notifications[%s]: %s", key, err.Error())
+		}
+	}
+}
+
+func (c *Config) validateDigests(errs *ConfigErrors) {
+	for i, digest := range c.Digests {
+		name := fmt.Sprintf("digests[%d]", i)
+		if digest.Name != "" {
+			name = fmt.Sprintf("digests[%s]", digest.Name)
+		}
+		if _, err := ParseCron(digest.Schedule); err != nil {
+			errs.add("%s has invalid schedule '%s': %s", name, digest.Schedule, err.Error())
+		}
+		if digest.Period < 0 {
+			errs.add("%s period can't be negative", name)
+		}
+		if digest.Channel != "" {
+			validateChannel(errs, name+".channel", digest.Channel)
+		}
+		for _, pattern := range digest.Projects {
+			if err := validateGlob(pattern); err != nil {
+				errs.add("%s has invalid pattern '%s': %s", name, pattern, err.Error())
+			}
+		}
+	}
+}
+
+func (c *Config) validateTLS(errs *ConfigErrors) {
+	validateFile(errs, "tls.cert", c.TLS.Cert)
+	validateFile(errs, "tls.key", c.TLS.Key)
+}
+
+func validateChannel(errs *ConfigErrors, name, id string) {
+	if id == "" {
+		errs.add("%s is empty", name)
+		return
+	}
+	if !snowflake.MatchString(id) {
+		errs.add("%s is not a valid Discord channel ID: '%s'", name, id)
+	}
+}
+
+func validateURI(errs *ConfigErrors, name, uri string) {
+	if !strings.HasPrefix(uri, "/") {
+		errs.add("%s must start with '/': '%s'", name, uri)
+	}
+}
+
+func validateFile(errs *ConfigErrors, name, filename string) {
+	if filename == "" {
+		errs.add("%s is empty", name)
+		return
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		errs.add("%s: %s", name, err.Error())
+		return
+	}
+	if info.IsDir() {
+		errs.add("%s: %s is a directory", name, filename)
+	}
+}
+
+func validateProject(project string) error {
+	if !strings.HasPrefix(project, "github.com/") {
+		return fmt.Errorf("'%s' is not a GitHub project", project)
+	}
+	parts := strings.Split(strings.TrimPrefix(project, "github.com/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("'%s' must look like github.com/owner/repository", project)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronSchedule_Next(t *testing.T) {
+	// Wednesday
+	now := time.Date(2020, time.May, 13, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@hourly", time.Date(2020, time.May, 13, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, time.May, 14, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, time.May, 13, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * mon", time.Date(2020, time.May, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 18 * * 1-5", time.Date(2020, time.May, 13, 18, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, time.May, 17, 0, 0, 0, 0, time.UTC)},
+		{"30 10 1 jun *", time.Date(2020, time.June, 1, 10, 30, 0, 0, time.UTC)},
+		// Day of month or Friday
+		{"0 0 20 * fri", time.Date(2020, time.May, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 feb *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %s", test.spec, err.Error())
+			continue
+		}
+		if got := schedule.Next(now); !got.Equal(test.want) {
+			t.Errorf("%q: next = %s, want %s", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParseCron_Errors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "* * * * someday"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) accepted invalid expression", spec)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Deliveries remembers received webhooks to drop redeliveries and retries
+type Deliveries struct {
+	storage Storage
+	limit   int
+
+	mutex      sync.Mutex
+	duplicates map[EventSource]uint64
+}
+
+func (d *Deliveries) Init(storage Storage, limit int) error {
+	if storage == nil {
+		return fmt.Errorf("nil storage")
+	}
+	if limit <= 0 {
+		return fmt.Errorf("delivery limit must be positive")
+	}
+	d.storage = storage
+	d.limit = limit
+	d.duplicates = make(map[EventSource]uint64)
+	return nil
+}
+
+// Seen records delivery of the source and reports whether it was received
+// before. Deliveries are never dropped when storage fails
+func (d *Deliveries) Seen(source EventSource, id string) bool {
+	if d == nil || id == "" {
+		return false
+	}
+	seen, err := d.storage.AddDelivery(source.String()+":"+id, d.limit)
+	if err != nil {
+		log.Errorf("Failed to record %s delivery %s: %s", source, id, err.Error())
+		return false
+	}
+	if seen {
+		d.mutex.Lock()
+		d.duplicates[source]++
+		d.mutex.Unlock()
+		log.Infof("Dropping duplicate %s delivery %s", source, id)
+	}
+	return seen
+}
+
+// Forget removes delivery which failed to be handled, so retries of the
+// sender are accepted
+func (d *Deliveries) Forget(source EventSource, id string) {
+	if d == nil || id == "" {
+		return
+	}
+	if err := d.storage.RemoveDelivery(source.String() + ":" + id); err != nil {
+		log.Errorf("Failed to forget %s delivery %s: %s", source, id, err.Error())
+	}
+}
+
+// Duplicates returns amount of dropped deliveries by source
+func (d *Deliveries) Duplicates() map[string]uint64 {
+	result := make(map[string]uint64)
+	if d == nil {
+		return result
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for source, count := range d.duplicates {
+		result[source.String()] = count
+	}
+	return result
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeliveries_Seen(t *testing.T) {
+	storage, cleanup := testStorage(t)
+	defer cleanup()
+	deliveries := new(Deliveries)
+	if err := deliveries.Init(storage, 2); err != nil {
+		t.Fatalf("Init: %s", err.Error())
+	}
+
+	for _, id := range []string{"1", "2"} {
+		if deliveries.Seen(SourceGitHub, id) {
+			t.Errorf("new delivery %s is a duplicate", id)
+		}
+	}
+	if !deliveries.Seen(SourceGitHub, "1") {
+		t.Errorf("repeated delivery is not a duplicate")
+	}
+	if deliveries.Seen(SourceTravis, "1") {
+		t.Errorf("delivery of another source is a duplicate")
+	}
+	if deliveries.Seen(SourceGitHub, "") {
+		t.Errorf("delivery without ID is a duplicate")
+	}
+
+	// Only the latest two deliveries are kept
+	deliveries.Seen(SourceGitHub, "3")
+	deliveries.Seen(SourceGitHub, "4")
+	if deliveries.Seen(SourceGitHub, "1") {
+		t.Errorf("old delivery is still kept")
+	}
+
+	// Forgotten delivery is accepted again
+	deliveries.Seen(SourceGitHub, "5")
+	deliveries.Forget(SourceGitHub, "5")
+	if deliveries.Seen(SourceGitHub, "5") {
+		t.Errorf("forgotten delivery is a duplicate")
+	}
+
+	if duplicates := deliveries.Duplicates(); duplicates["github"] != 1 || duplicates["travis"] != 0 {
+		t.Errorf("duplicates = %v", duplicates)
+	}
+}
+
+func TestGitHub_HandleRedelivery(t *testing.T) {
+	storage, cleanup := testStorage(t)
+	defer cleanup()
+	deliveries := new(Deliveries)
+	deliveries.Init(storage, 10)
+
+	bus := new(Bus)
+	bus.Init()
+	g := &GitHub{Bus: bus, Deliveries: deliveries}
+	g.SetProjects([]string{"github.com/savageking-io/eveleve"})
+	if err := g.SetSecret(""); err != nil {
+		t.Fatalf("SetSecret: %s", err.Error())
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "github", "issues_opened.json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %s", err.Error())
+	}
+	deliveryIDs := []struct {
+		id     string
+		status int
+	}{
+		{"72d3162e-cc78-11e3-81ab-4c9367dc0958", 202},
+		{"72d3162e-cc78-11e3-81ab-4c9367dc0958", 200},
+		{"8a4b5c80-cc78-11e3-9fa1-4c9367dc0958", 202},
+	}
+	deliver := func(id string) int {
+		r := httptest.NewRequest("POST", "/github", bytes.NewReader(data))
+		r.Header.Set("X-GitHub-Event", "issues")
+		r.Header.Set("X-GitHub-Delivery", id)
+		w := httptest.NewRecorder()
+		g.Handle(w, r)
+		return w.Code
+	}
+	for _, d := range deliveryIDs {
+		if status := deliver(d.id); status != d.status {
+			t.Errorf("delivery %s: status = %d, want %d", d.id, status, d.status)
+		}
+	}
+
+	// Delivery which failed is accepted when it's delivered again
+	g.SetProjects([]string{"github.com/savageking-io/evelengine"})
+	if status := deliver("9c1b7e00-cc78-11e3-8a1e-4c9367dc0958"); status != 404 {
+		t.Errorf("delivery of unknown project: status = %d, want 404", status)
+	}
+	g.SetProjects([]string{"github.com/savageking-io/eveleve"})
+	if status := deliver("9c1b7e00-cc78-11e3-8a1e-4c9367dc0958"); status != 202 {
+		t.Errorf("redelivery of failed delivery: status = %d, want 202", status)
+	}
+
+	if published := bus.Published(); published != 3 {
+		t.Errorf("published %d events, want 3", published)
+	}
+	if duplicates := deliveries.Duplicates(); duplicates["github"] != 1 {
+		t.Errorf("duplicates = %v", duplicates)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxDigestContributors is the length of the top contributors list
+const maxDigestContributors = 5
+
+// Digests posts summaries of the event history on schedule
+type Digests struct {
+	discord *Discord
+	storage Storage
+
+	mutex  sync.Mutex
+	timers []*time.Timer
+	// generation invalidates timers of replaced digests which are firing
+	// while SetDigests runs
+	generation int
+}
+
+func (d *Digests) Init(discord *Discord, storage Storage) error {
+	log.Infof("Initializing Digests")
+	if discord == nil {
+		return fmt.Errorf("nil discord")
+	}
+	if storage == nil {
+		return fmt.Errorf("nil storage")
+	}
+	d.discord = discord
+	d.storage = storage
+	return nil
+}
+
+// SetDigests replaces scheduled digests. Digests with invalid schedule
+// are skipped, configuration validation reports them before they get here
+func (d *Digests) SetDigests(digests []DigestConfig) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stop()
+
+	for _, conf := range digests {
+		schedule, err := ParseCron(conf.Schedule)
+		if err != nil {
+			log.Errorf("Failed to parse schedule of digest %s: %s", conf.Name, err.Error())
+			continue
+		}
+		d.schedule(d.generation, conf, schedule)
+	}
+}
+
+// Stop cancels every scheduled digest
+func (d *Digests) Stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stop()
+}
+
+func (d *Digests) stop() {
+	for _, timer := range d.timers {
+		timer.Stop()
+	}
+	d.timers = nil
+	d.generation++
+}
+
+// schedule starts timer of the next digest post. Must be called with
+// mutex locked
+func (d *Digests) schedule(generation int, conf DigestConfig, schedule *CronSchedule) {
+	if generation != d.generation {
+		return
+	}
+	now := time.Now()
+	next := schedule.Next(now)
+	if next.IsZero() {
+		log.Warnf("Digest %s is never posted: schedule '%s' matches nothing", conf.Name, conf.Schedule)
+		return
+	}
+	log.Debugf("Next digest %s at %s", conf.Name, next)
+
+	d.timers = append(d.timers, time.AfterFunc(next.Sub(now), func() {
+		if err := d.post(conf); err != nil {
+			log.Errorf("Failed to post digest %s: %s", conf.Name, err.Error())
+		}
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		d.schedule(generation, conf, schedule)
+	}))
+}
+
+func (d *Digests) post(conf DigestConfig) error {
+	now := time.Now()
+	msg, err := d.Build(conf.Name, conf.Projects, now.Add(-conf.Period), now)
+	if err != nil {
+		return err
+	}
+	channel := conf.Channel
+	if channel == "" {
+		channel = d.discord.eventChannel()
+	}
+	_, err = d.discord.sendEmbed(channel, msg)
+	return err
+}
+
+// Build describes events of projects matching patterns between since and
+// until. Every project is included when there are no patterns
+func (d *Digests) Build(title string, projects []string, since, until time.Time) (*discordgo.MessageEmbed, error) {
+	events, err := d.storage.Events(since, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load event history: %s", err.Error())
+	}
+	records := []*EventRecord{}
+	for _, record := range events {
+		if !record.Time.Before(until) {
+			continue
+		}
+		if len(projects) > 0 && !matchAny(projects, record.Project) && !matchAny(projects, "github.com/"+record.Project) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return digestEmbed(title, records, since, until), nil
+}
+
+// projectDigest counts events of a single project
+type projectDigest struct {
+	project  string
+	commits  int
+	opened   int
+	closed   int
+	merged   int
+	builds   int
+	passed   int
+	releases []string
+}
+
+func (p *projectDigest) activity() int {
+	return p.commits + p.opened + p.closed + p.merged + p.builds + len(p.releases)
+}
+
+func (p *projectDigest) summary() string {
+	lines := []string{}
+	if p.commits > 0 {
+		lines = append(lines, plural(p.commits, "commit"))
+	}
+	if p.opened > 0 || p.closed > 0 {
+		lines = append(lines, fmt.Sprintf("%s opened, %d closed", plural(p.opened, "issue"), p.closed))
+	}
+	if p.merged > 0 {
+		lines = append(lines, plural(p.merged, "pull request")+" merged")
+	}
+	if len(p.releases) > 0 {
+		lines = append(lines, "Released "+strings.Join(p.releases, ", "))
+	}
+	if p.builds > 0 {
+		lines = append(lines, fmt.Sprintf("CI: %d%% of %s passed", p.passed*100/p.builds, plural(p.builds, "build")))
+	}
+	if len(lines) == 0 {
+		return "no activity"
+	}
+	return truncateText(strings.Join(lines, "\n"), maxEmbedField)
+}
+
+// digestEmbed summarizes history records per project
+func digestEmbed(title string, records []*EventRecord, since, until time.Time) *discordgo.MessageEmbed {
+	if title == "" {
+		title = "Development digest"
+	}
+	projects := map[string]*projectDigest{}
+	contributors := map[string]int{}
+	for _, r := range records {
+		if r.Project == "" {
+			continue
+		}
+		p, ok := projects[r.Project]
+		if !ok {
+			p = &projectDigest{project: r.Project}
+			projects[r.Project] = p
+		}
+
+		switch {
+		case r.Type == Push.String():
+			p.commits += r.Commits
+			for _, author := range r.Authors {
+				contributors[author]++
+			}
+		case r.Type == Issue.String() && r.Action == "opened":
+			p.opened++
+		case r.Type == Issue.String() && r.Action == "closed":
+			p.closed++
+		case r.Type == PullRequest.String() && r.Action == "closed" && r.Merged:
+			p.merged++
+		case r.Type == Release.String() && r.Action == "published":
+			p.releases = append(p.releases, r.Title)
+		case r.Type == "build":
+			switch r.Result {
+			case "passed", "fixed":
+				p.builds++
+				p.passed++
+			case "failed", "broken", "still failing", "errored":
+				p.builds++
+			}
+		}
+	}
+
+	list := []*projectDigest{}
+	for _, p := range projects {
+		if p.activity() > 0 {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].activity() != list[j].activity() {
+			return list[i].activity() > list[j].activity()
+		}
+		return list[i].project < list[j].project
+	})
+
+	msg := &discordgo.MessageEmbed{
+		Title:       title,
+		Color:       colorGitHub,
+		Description: fmt.Sprintf("From %s to %s", since.Format("Jan 2 15:04"), until.Format("Jan 2 15:04")),
+		Timestamp:   until.Format(time.RFC3339),
+	}
+	if len(list) == 0 {
+		msg.Description += "\nNo activity"
+		return msg
+	}
+
+	// Room for contributors and the list of projects left out
+	for i, p := range list {
+		if i == maxEmbedFields-2 && len(list) > maxEmbedFields-1 {
+			msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+				Name:  "…",
+				Value: fmt.Sprintf("and %s more", plural(len(list)-i, "project")),
+			})
+			break
+		}
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: p.project, Value: p.summary()})
+	}
+
+	authors := []string{}
+	for author := range contributors {
+		authors = append(authors, author)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if contributors[authors[i]] != contributors[authors[j]] {
+			return contributors[authors[i]] > contributors[authors[j]]
+		}
+		return authors[i] < authors[j]
+	})
+	if len(authors) > maxDigestContributors {
+		authors = authors[:maxDigestContributors]
+	}
+	if len(authors) > 0 {
+		lines := []string{}
+		for _, author := range authors {
+			lines = append(lines, fmt.Sprintf("%s: %s", author, plural(contributors[author], "commit")))
+		}
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Top contributors", Value: strings.Join(lines, "\n")})
+	}
+	return msg
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// digestCommands returns !digest command family
+func (m *Master) digestCommands() *CommandDef {
+	return &CommandDef{
+		Name:  "digest",
+		Usage: "Development digests",
+		Subcommands: []*CommandDef{
+			{
+				Name:  "now",
+				Usage: "Post digest of the last period right away",
+				Args: []CommandArg{{
+					Name:        "project",
+					Optional:    true,
+					Description: "Project URL, owner/repository or repository name",
+					Complete:    m.completeProject,
+				}},
+				Handler: m.commandDigestNow,
+			},
+		},
+	}
+}
+
+// commandDigestNow uses period of the first configured digest, a week
+// when there are no digests
+func (m *Master) commandDigestNow(ctx *CommandContext) error {
+	if m.Digests == nil {
+		return fmt.Errorf("digests are not available")
+	}
+	m.reloadMutex.Lock()
+	conf := DigestConfig{Period: time.Hour * 24 * 7}
+	if m.Config != nil && len(m.Config.Digests) > 0 {
+		conf = m.Config.Digests[0]
+	}
+	m.reloadMutex.Unlock()
+
+	if ctx.Has("project") {
+		project, err := m.FindProject(ctx.String("project"))
+		if err != nil {
+			return err
+		}
+		conf.Projects = []string{project.URL}
+	}
+
+	now := time.Now()
+	msg, err := m.Digests.Build(conf.Name, conf.Projects, now.Add(-conf.Period), now)
+	if err != nil {
+		return err
+	}
+	return ctx.ReplyEmbed(msg)
+}
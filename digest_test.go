@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestEmbed(t *testing.T) {
+	until := time.Date(2020, time.May, 15, 18, 0, 0, 0, time.UTC)
+	since := until.Add(-time.Hour * 24 * 7)
+	records := []*EventRecord{
+		{Type: "push", Project: "savageking-io/eveleve", Commits: 2, Authors: []string{"savageking", "vozgua"}},
+		{Type: "push", Project: "savageking-io/eveleve", Commits: 1, Authors: []string{"savageking"}},
+		{Type: "issues", Action: "opened", Project: "savageking-io/eveleve"},
+		{Type: "issues", Action: "opened", Project: "savageking-io/eveleve"},
+		{Type: "issues", Action: "closed", Project: "savageking-io/eveleve"},
+		{Type: "pull_request", Action: "closed", Merged: true, Project: "savageking-io/eveleve"},
+		{Type: "pull_request", Action: "closed", Project: "savageking-io/eveleve"},
+		{Type: "release", Action: "published", Title: "v1.0.0", Project: "savageking-io/eveleve"},
+		{Type: "build", Result: "passed", Project: "savageking-io/eveleve"},
+		{Type: "build", Result: "fixed", Project: "savageking-io/eveleve"},
+		{Type: "build", Result: "failed", Project: "savageking-io/eveleve"},
+		{Type: "build", Result: "pending", Project: "savageking-io/eveleve"},
+		{Type: "build", Result: "passed", Project: "savageking-io/evelengine"},
+		{Type: "issue_comment", Project: "savageking-io/quiet"},
+	}
+
+	msg := digestEmbed("Weekly digest", records, since, until)
+	if msg.Title != "Weekly digest" {
+		t.Errorf("title = %q", msg.Title)
+	}
+	if len(msg.Fields) != 3 {
+		t.Fatalf("fields = %d, want 3", len(msg.Fields))
+	}
+	if msg.Fields[0].Name != "savageking-io/eveleve" || msg.Fields[1].Name != "savageking-io/evelengine" {
+		t.Errorf("projects = %q, %q", msg.Fields[0].Name, msg.Fields[1].Name)
+	}
+	want := "3 commits\n2 issues opened, 1 closed\n1 pull request merged\nReleased v1.0.0\nCI: 66% of 3 builds passed"
+	if msg.Fields[0].Value != want {
+		t.Errorf("summary = %q, want %q", msg.Fields[0].Value, want)
+	}
+	if want := "savageking: 2 commits\nvozgua: 1 commit"; msg.Fields[2].Value != want {
+		t.Errorf("contributors = %q, want %q", msg.Fields[2].Value, want)
+	}
+
+	msg = digestEmbed("", nil, since, until)
+	if len(msg.Fields) != 0 || !strings.Contains(msg.Description, "No activity") {
+		t.Errorf("empty digest = %+v", msg)
+	}
+}
@@ -5,11 +5,28 @@ import (
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
 	"strings"
+	"sync"
 )
 
+// Command is a message addressed to the bot. Text is the original
+// message, Cmd and Params are filled by the command router. Slash
+// commands set Cmd, subcommand path in Params and named Options
 type Command struct {
-	Cmd    string
-	Params []string
+	Text      string
+	Cmd       string
+	Params    []string
+	Options   map[string]string
+	ChannelID string
+	GuildID   string
+	AuthorID  string
+	// Roles of the author, empty in direct messages
+	Roles []string
+	// Reply replaces channel message for commands which need another
+	// kind of response, e.g. interactions
+	Reply func(text string, embed *discordgo.MessageEmbed) error `json:"-"`
+
+	// rest is the message text starting with every parameter
+	rest []string
 }
 
 type Discord struct {
@@ -17,18 +34,22 @@ type Discord struct {
 	LogChannel    string
 	EventChannel  string
 	StatusChannel string
+	BoardChannel  string
 	Session       *discordgo.Session
-	Commands      chan Command
+	Bus           *Bus
+
+	mutex sync.RWMutex
 }
 
-func (d *Discord) Init(config DiscordConfig) error {
+func (d *Discord) Init(config DiscordConfig, bus *Bus) error {
 	var err error
-	d.Commands = make(chan Command)
 	log.Infof("Initializing Discord Bot")
+	if bus == nil {
+		return fmt.Errorf("nil bus")
+	}
+	d.Bus = bus
 	d.Token = config.Token
-	d.LogChannel = config.LogChannel
-	d.EventChannel = config.EventChannel
-	d.StatusChannel = config.StatusChannel
+	d.SetChannels(config)
 
 	d.Session, err = discordgo.New("Bot " + d.Token)
 	if err != nil {
@@ -51,34 +72,104 @@ func (d *Discord) Init(config DiscordConfig) error {
 	return nil
 }
 
+// SetChannels updates channels used for logs, events and status
+func (d *Discord) SetChannels(config DiscordConfig) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.LogChannel = config.LogChannel
+	d.EventChannel = config.EventChannel
+	d.StatusChannel = config.StatusChannel
+	d.BoardChannel = config.BoardChannel
+}
+
+func (d *Discord) logChannel() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.LogChannel
+}
+
+func (d *Discord) eventChannel() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.EventChannel
+}
+
+func (d *Discord) statusChannel() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.StatusChannel
+}
+
+func (d *Discord) boardChannel() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.BoardChannel
+}
+
+// Close disconnects the bot from Discord
+func (d *Discord) Close() error {
+	log.Infof("Closing Discord session")
+	return d.Session.Close()
+}
+
 func (d *Discord) messageCreate(s *discordgo.Session, msg *discordgo.MessageCreate) {
-	parts := strings.Split(msg.Content, " ")
-	if len(msg.Content) == 0 {
+	if msg.Author == nil || msg.Author.Bot || msg.Author.ID == s.State.User.ID {
 		return
 	}
-	if len(parts) == 0 {
+	text := strings.TrimSpace(msg.Content)
+	if !strings.HasPrefix(text, CommandPrefix) || len(text) == len(CommandPrefix) {
 		return
 	}
 
-	if parts[0][0] == '!' {
-		var c Command
-		c.Cmd = parts[0]
-		if len(parts) > 1 {
-			c.Params = parts[1:]
-		}
-		d.Commands <- c
+	c := &Command{
+		Text:      text,
+		ChannelID: msg.ChannelID,
+		GuildID:   msg.GuildID,
+		AuthorID:  msg.Author.ID,
+	}
+	if msg.Member != nil {
+		c.Roles = msg.Member.Roles
+	}
+	if err := d.Bus.Publish(Event{Source: SourceDiscord, Command: c}); err != nil {
+		log.Errorf("Failed to publish Discord command: %s", err.Error())
 	}
 }
 
 func (d *Discord) sendLog(text string) {
-	d.sendMessage(text, d.LogChannel)
+	d.sendMessage(text, d.logChannel())
 }
 
 func (d *Discord) sendEvent(text string) {
-	d.sendMessage(text, d.EventChannel)
+	d.sendMessage(text, d.eventChannel())
+}
+
+// reply sends text or embed into a channel
+func (d *Discord) reply(channelID, text string, embed *discordgo.MessageEmbed) error {
+	if embed != nil {
+		_, err := d.sendComplex(channelID, text, embed)
+		return err
+	}
+	return d.sendMessage(text, channelID)
 }
 
-func (d *Discord) sendMessage(text, channelID string) {
+func (d *Discord) sendMessage(text, channelID string) error {
+	if d.Session == nil {
+		return fmt.Errorf("discord session is not open")
+	}
+	var result error
+	for _, str := range splitMessage(text) {
+		_, err := d.Session.ChannelMessageSend(channelID, str)
+		if err != nil {
+			log.Errorf("Failed to send message to %s: %s", channelID, err.Error())
+			result = err
+		}
+	}
+	return result
+}
+
+// splitMessage splits text by lines into parts which fit into a
+// single Discord message
+func splitMessage(text string) []string {
 	buffer := []string{}
 
 	// Discord can receive message up to 2000 characters long.
@@ -97,13 +188,7 @@ func (d *Discord) sendMessage(text, channelID string) {
 	} else {
 		buffer = append(buffer, text)
 	}
-
-	for _, str := range buffer {
-		_, err := d.Session.ChannelMessageSend(channelID, str)
-		if err != nil {
-			log.Errorf("Failed to send message to %s: %s", channelID, err.Error())
-		}
-	}
+	return buffer
 }
 
 func (d *Discord) sendEmbed(channelID string, data *discordgo.MessageEmbed) (*discordgo.Message, error) {
@@ -111,6 +196,14 @@ func (d *Discord) sendEmbed(channelID string, data *discordgo.MessageEmbed) (*di
 	return d.Session.ChannelMessageSendEmbed(channelID, data)
 }
 
+// sendComplex posts a message with optional text and embed
+func (d *Discord) sendComplex(channelID, content string, embed *discordgo.MessageEmbed) (*discordgo.Message, error) {
+	return d.Session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: content,
+		Embed:   embed,
+	})
+}
+
 func (d *Discord) editEmbed(channelID, msgID string, data *discordgo.MessageEmbed) (*discordgo.Message, error) {
 	return d.Session.ChannelMessageEditEmbed(channelID, msgID, data)
 }
@@ -1,19 +1,39 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	//	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/go-playground/webhooks.v5/github"
 	"net/http"
+	"sync"
 )
 
+// ErrUnknownProject is returned for events of projects which are not
+// allowed to send webhooks
+var ErrUnknownProject = errors.New("unknown repository")
+
 // GitHub listens for github hooks and performs actions
 type GitHub struct {
-	Port     uint16 // Port for webhooks
-	Events   chan GitHubEvent
+	Bus      *Bus
 	Discord  *Discord
 	Projects []string
+	// Deliveries drop redelivered webhooks, optional
+	Deliveries *Deliveries
+
+	mutex    sync.RWMutex
+	hook     *github.Webhook
+	patterns []*projectPattern
+	secrets  []projectSecret
+}
+
+// projectSecret is a webhook parser of projects with own secret
+type projectSecret struct {
+	patterns []*projectPattern
+	hook     *github.Webhook
 }
 
 type GitHubEventType uint8
@@ -33,6 +53,37 @@ const (
 	Security           GitHubEventType = iota
 )
 
+// String returns event name as sent in X-GitHub-Event header
+func (t GitHubEventType) String() string {
+	switch t {
+	case CommitComment:
+		return "commit_comment"
+	case Fork:
+		return "fork"
+	case Issue:
+		return "issues"
+	case IssueComment:
+		return "issue_comment"
+	case Milestone:
+		return "milestone"
+	case PullRequest:
+		return "pull_request"
+	case PullRequestReview:
+		return "pull_request_review"
+	case PullRequestComment:
+		return "pull_request_review_comment"
+	case Push:
+		return "push"
+	case Vulnerability:
+		return "repository_vulnerability_alert"
+	case Release:
+		return "release"
+	case Security:
+		return "security_advisory"
+	}
+	return "unknown"
+}
+
 type GitHubEvent struct {
 	event              GitHubEventType
 	commitComment      github.CommitCommentPayload
@@ -47,88 +98,306 @@ type GitHubEvent struct {
 	vulnerability      github.RepositoryVulnerabilityAlertPayload
 	release            github.ReleasePayload
 	security           github.SecurityAdvisoryPayload
+	// repository of payloads which don't declare it, "owner/repository"
+	repository string
 }
 
-//func (g *GitHub) Init(port uint16, cert, key string) error {
-func (g *GitHub) Init(ghc GitHubConfig, tlsc TLSConfig) error {
-	log.Infof("Preparing GitHub webhook listener at port %d", ghc.Port)
-	g.Port = ghc.Port
-	g.Events = make(chan GitHubEvent)
+// Payload returns webhook payload of the event
+func (e *GitHubEvent) Payload() interface{} {
+	switch e.event {
+	case CommitComment:
+		return e.commitComment
+	case Fork:
+		return e.fork
+	case Issue:
+		return e.issue
+	case IssueComment:
+		return e.issueComment
+	case Milestone:
+		return e.milestone
+	case PullRequest:
+		return e.pullRequest
+	case PullRequestReview:
+		return e.pullRequestReview
+	case PullRequestComment:
+		return e.pullRequestComment
+	case Push:
+		return e.push
+	case Vulnerability:
+		return e.vulnerability
+	case Release:
+		return e.release
+	case Security:
+		return e.security
+	}
+	return nil
+}
 
-	hook, _ := github.New(github.Options.Secret(ghc.Secret))
+// openIssues returns amount of open issues and pull requests in the
+// repository for events which include repository details
+func (e *GitHubEvent) openIssues() (int64, bool) {
+	switch e.event {
+	case CommitComment:
+		return e.commitComment.Repository.OpenIssuesCount, true
+	case Fork:
+		return e.fork.Repository.OpenIssuesCount, true
+	case Issue:
+		return e.issue.Repository.OpenIssuesCount, true
+	case IssueComment:
+		return e.issueComment.Repository.OpenIssuesCount, true
+	case Milestone:
+		return e.milestone.Repository.OpenIssuesCount, true
+	case PullRequest:
+		return e.pullRequest.Repository.OpenIssuesCount, true
+	case PullRequestReview:
+		return e.pullRequestReview.Repository.OpenIssuesCount, true
+	case PullRequestComment:
+		return e.pullRequestComment.Repository.OpenIssuesCount, true
+	case Push:
+		return e.push.Repository.OpenIssuesCount, true
+	case Release:
+		return e.release.Repository.OpenIssuesCount, true
+	}
+	return 0, false
+}
 
-	http.HandleFunc(ghc.URI, func(w http.ResponseWriter, r *http.Request) {
-		payload, err := hook.Parse(r, github.ReleaseEvent, github.PushEvent,
-			github.CommitCommentEvent, github.IssuesEvent, github.IssueCommentEvent,
-			github.ForkEvent, github.MilestoneEvent, github.PullRequestEvent,
-			github.PullRequestReviewEvent, github.RepositoryVulnerabilityAlertEvent,
-			github.SecurityAdvisoryEvent)
-		if err != nil {
-			if err == github.ErrEventNotFound {
-				log.Infof("Received payload for a different event: %+v", err.Error())
-			}
+func (g *GitHub) Init(ghc GitHubConfig, server *Server, bus *Bus) error {
+	log.Infof("Preparing GitHub webhook receiver")
+	if server == nil {
+		return fmt.Errorf("nil http server")
+	}
+	if bus == nil {
+		return fmt.Errorf("nil bus")
+	}
+	g.Bus = bus
+
+	if err := g.SetSecret(ghc.Secret); err != nil {
+		return err
+	}
+	if err := g.SetSecrets(ghc.Secrets); err != nil {
+		return err
+	}
+
+	return server.Register(Route{
+		Name:        "github",
+		Path:        ghc.URI,
+		MaxBodySize: ghc.MaxBodySize,
+		Handler:     http.HandlerFunc(g.Handle),
+	})
+}
+
+// Handle receives GitHub webhook requests. Accepted events get 202,
+// redeliveries and events which are not announced get 200
+func (g *GitHub) Handle(w http.ResponseWriter, r *http.Request) {
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	// Secret depends on the repository, so body is read before the
+	// signature is verified
+	body, err := ioutil.ReadAll(r.Body)
+	if bodyTooLarge(err) {
+		respondError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	repository := payloadRepository(body)
+	payload, err := g.webhook(repository).Parse(r, github.ReleaseEvent, github.PushEvent,
+		github.CommitCommentEvent, github.IssuesEvent, github.IssueCommentEvent,
+		github.ForkEvent, github.MilestoneEvent, github.PullRequestEvent,
+		github.PullRequestReviewEvent, github.PullRequestReviewCommentEvent,
+		github.RepositoryVulnerabilityAlertEvent,
+		github.SecurityAdvisoryEvent)
+	if err == github.ErrEventNotFound {
+		log.Infof("Ignoring GitHub %s event", r.Header.Get("X-GitHub-Event"))
+		respondJSON(w, http.StatusOK, map[string]string{"message": "event ignored"})
+		return
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		switch err {
+		case github.ErrMissingHubSignatureHeader, github.ErrHMACVerificationFailed:
+			status = http.StatusUnauthorized
+		case github.ErrInvalidHTTPMethod:
+			status = http.StatusMethodNotAllowed
 		}
-		switch payload.(type) {
-		case github.CommitCommentPayload:
-			g.CommitComment(payload.(github.CommitCommentPayload))
-		case github.ForkPayload:
-			g.Fork(payload.(github.ForkPayload))
-		case github.IssuesPayload:
-			g.Issue(payload.(github.IssuesPayload))
-		case github.IssueCommentPayload:
-			g.IssueComment(payload.(github.IssueCommentPayload))
-		case github.MilestonePayload:
-			g.Milestone(payload.(github.MilestonePayload))
-		case github.PushPayload:
-			g.Push(payload.(github.PushPayload))
-		case github.PullRequestPayload:
-			g.PullRequest(payload.(github.PullRequestPayload))
-		case github.PullRequestReviewPayload:
-			g.PullRequestReview(payload.(github.PullRequestReviewPayload))
-		case github.PullRequestReviewCommentPayload:
-			g.PullRequestComment(payload.(github.PullRequestReviewCommentPayload))
-		case github.RepositoryVulnerabilityAlertPayload:
-			g.Vulnerability(payload.(github.RepositoryVulnerabilityAlertPayload))
-		case github.ReleasePayload:
-			g.Release(payload.(github.ReleasePayload))
-		case github.SecurityAdvisoryPayload:
-			g.SecurityAdvisory(payload.(github.SecurityAdvisoryPayload))
+		log.Warnf("Rejected GitHub delivery %s: %s", delivery, err.Error())
+		if g.Discord != nil {
+			g.Discord.sendLog(fmt.Sprintf("Rejected GitHub webhook delivery %s: %s", delivery, err.Error()))
 		}
-	})
-	go http.ListenAndServeTLS(fmt.Sprintf(":%d", g.Port), tlsc.Cert, tlsc.Key, nil)
+		respondError(w, status, err.Error())
+		return
+	}
+
+	// Redeliveries keep ID of the original delivery
+	if g.Deliveries.Seen(SourceGitHub, delivery) {
+		respondJSON(w, http.StatusOK, map[string]string{"message": "duplicate delivery"})
+		return
+	}
+
+	if err := g.dispatch(payload, repository); err != nil {
+		// Retry or manual redelivery of the failed delivery is accepted
+		g.Deliveries.Forget(SourceGitHub, delivery)
+		if err == ErrUnknownProject {
+			respondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Errorf("Failed to publish GitHub delivery %s: %s", delivery, err.Error())
+		respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusAccepted, map[string]string{"message": "accepted"})
+}
+
+// dispatch publishes parsed payload on the bus. Publishing never blocks,
+// error is returned when no event queue had free space
+func (g *GitHub) dispatch(payload interface{}, repository string) error {
+	switch p := payload.(type) {
+	case github.CommitCommentPayload:
+		return g.CommitComment(p)
+	case github.ForkPayload:
+		return g.Fork(p)
+	case github.IssuesPayload:
+		return g.Issue(p)
+	case github.IssueCommentPayload:
+		return g.IssueComment(p)
+	case github.MilestonePayload:
+		return g.Milestone(p)
+	case github.PushPayload:
+		return g.Push(p)
+	case github.PullRequestPayload:
+		return g.PullRequest(p)
+	case github.PullRequestReviewPayload:
+		return g.PullRequestReview(p)
+	case github.PullRequestReviewCommentPayload:
+		return g.PullRequestComment(p)
+	case github.RepositoryVulnerabilityAlertPayload:
+		return g.Vulnerability(p, repository)
+	case github.ReleasePayload:
+		return g.Release(p)
+	case github.SecurityAdvisoryPayload:
+		return g.SecurityAdvisory(p)
+	}
+	return fmt.Errorf("unexpected payload %T", payload)
+}
+
+// SetSecret replaces the secret used to verify webhook signatures
+func (g *GitHub) SetSecret(secret string) error {
+	hook, err := newWebhook(secret)
+	if err != nil {
+		return err
+	}
+	g.setWebhook(hook)
 	return nil
 }
 
-func (g *GitHub) SetProjects(projects []string) {
-	url := "github.com/"
-	g.Projects = g.Projects[:0]
-	log.Infof("Setting GitHub projects")
-	for _, project := range projects {
-		if project[0:len(url)] == url {
-			g.Projects = append(g.Projects, project[len(url):])
-			log.Infof("Adding project %s", project[len(url):])
-			continue
+// SetSecrets replaces secrets of projects which don't use the global one.
+// The first entry matching the project is used
+func (g *GitHub) SetSecrets(secrets []ProjectSecret) error {
+	result, err := newProjectSecrets(secrets)
+	if err != nil {
+		return err
+	}
+	g.setProjectSecrets(result)
+	return nil
+}
+
+func (g *GitHub) setWebhook(hook *github.Webhook) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.hook = hook
+}
+
+func (g *GitHub) setProjectSecrets(secrets []projectSecret) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.secrets = secrets
+}
+
+// newWebhook creates parser which verifies signatures with the secret
+func newWebhook(secret string) (*github.Webhook, error) {
+	hook, err := github.New(github.Options.Secret(secret))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create webhook parser: %s", err.Error())
+	}
+	return hook, nil
+}
+
+func newProjectSecrets(secrets []ProjectSecret) ([]projectSecret, error) {
+	result := []projectSecret{}
+	for _, secret := range secrets {
+		hook, err := newWebhook(secret.Secret)
+		if err != nil {
+			return nil, err
 		}
-		log.Infof("Ignoring not a GitHub project: %s", project)
+		result = append(result, projectSecret{patterns: parseProjectPatterns(secret.Projects), hook: hook})
 	}
-	log.Infof("%d projects added in total", len(g.Projects))
+	return result, nil
+}
+
+// webhook returns parser with the secret of the project
+func (g *GitHub) webhook(project string) *github.Webhook {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	if project != "" {
+		for _, secret := range g.secrets {
+			if allowProject(secret.patterns, project) {
+				return secret.hook
+			}
+		}
+	}
+	return g.hook
+}
+
+// SetProjects replaces list of projects allowed to send webhooks. Every
+// entry is a URL, a glob or a regular expression, see projectPattern
+func (g *GitHub) SetProjects(projects []string) {
+	patterns := parseProjectPatterns(projects)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.Projects = []string{}
+	for _, p := range patterns {
+		g.Projects = append(g.Projects, p.entry)
+	}
+	g.patterns = patterns
+	log.Infof("%d GitHub projects allowed", len(g.Projects))
 }
 
 func (g *GitHub) addNotificationSubsystem(d *Discord) {
 	g.Discord = d
 }
 
-func (g *GitHub) Release(payload github.ReleasePayload) {
+func (g *GitHub) publish(event *GitHubEvent) error {
+	return g.Bus.Publish(Event{
+		Source: SourceGitHub,
+		GitHub: event,
+	})
+}
 
+func (g *GitHub) Release(p github.ReleasePayload) error {
+	if g.verifyProject(p.Repository.FullName) != nil {
+		log.Warnf("Payload came from unverified project: %+v", p)
+		if g.Discord != nil {
+			g.Discord.sendLog("Repository event from unverified project")
+		}
+		return ErrUnknownProject
+	}
+	event := &GitHubEvent{
+		event:   Release,
+		release: p,
+	}
+	return g.publish(event)
 }
 
 func (g *GitHub) verifyProject(name string) error {
-	for _, project := range g.Projects {
-		if project == name {
-			return nil
-		}
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	if allowProject(g.patterns, name) {
+		return nil
 	}
-	return fmt.Errorf("Unknown repository")
+	return ErrUnknownProject
 }
 
 func (g *GitHub) Push(payload github.PushPayload) error {
@@ -137,7 +406,7 @@ func (g *GitHub) Push(payload github.PushPayload) error {
 		if g.Discord != nil {
 			g.Discord.sendLog("Repository event from unverified project")
 		}
-		return fmt.Errorf("Unknown repository")
+		return ErrUnknownProject
 	}
 
 	event := &GitHubEvent{
@@ -145,8 +414,7 @@ func (g *GitHub) Push(payload github.PushPayload) error {
 		push:  payload,
 	}
 
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
 func (g *GitHub) CommitComment(p github.CommitCommentPayload) error {
@@ -155,15 +423,14 @@ func (g *GitHub) CommitComment(p github.CommitCommentPayload) error {
 		if g.Discord != nil {
 			g.Discord.sendLog("Repository event from unverified project")
 		}
-		return fmt.Errorf("unknown repository")
+		return ErrUnknownProject
 	}
 
 	event := &GitHubEvent{
 		event:         CommitComment,
 		commitComment: p,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
 func (g *GitHub) Fork(p github.ForkPayload) error {
@@ -172,14 +439,13 @@ func (g *GitHub) Fork(p github.ForkPayload) error {
 		if g.Discord != nil {
 			g.Discord.sendLog("Repository event from unverified project")
 		}
-		return fmt.Errorf("unknown repository")
+		return ErrUnknownProject
 	}
 	event := &GitHubEvent{
 		event: Fork,
 		fork:  p,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
 func (g *GitHub) Issue(p github.IssuesPayload) error {
@@ -188,14 +454,13 @@ func (g *GitHub) Issue(p github.IssuesPayload) error {
 		if g.Discord != nil {
 			g.Discord.sendLog("Repository event from unverified project")
 		}
-		return fmt.Errorf("unknown repository")
+		return ErrUnknownProject
 	}
 	event := &GitHubEvent{
 		event: Issue,
 		issue: p,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
 func (g *GitHub) IssueComment(p github.IssueCommentPayload) error {
@@ -204,14 +469,13 @@ func (g *GitHub) IssueComment(p github.IssueCommentPayload) error {
 		if g.Discord != nil {
 			g.Discord.sendLog("Repository event from unverified project")
 		}
-		return fmt.Errorf("unknown repository")
+		return ErrUnknownProject
 	}
 	event := &GitHubEvent{
 		event:        IssueComment,
 		issueComment: p,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
 func (g *GitHub) Milestone(p github.MilestonePayload) error {
@@ -220,14 +484,13 @@ func (g *GitHub) Milestone(p github.MilestonePayload) error {
 		if g.Discord != nil {
 			g.Discord.sendLog("Repository event from unverified project")
 		}
-		return fmt.Errorf("unknown repository")
+		return ErrUnknownProject
 	}
 	event := &GitHubEvent{
 		event:     Milestone,
 		milestone: p,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
 func (g *GitHub) PullRequest(p github.PullRequestPayload) error {
@@ -236,14 +499,13 @@ func (g *GitHub) PullRequest(p github.PullRequestPayload) error {
 		if g.Discord != nil {
 			g.Discord.sendLog("Repository event from unverified project")
 		}
-		return fmt.Errorf("unknown repository")
+		return ErrUnknownProject
 	}
 	event := &GitHubEvent{
 		event:       PullRequest,
 		pullRequest: p,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
 func (g *GitHub) PullRequestReview(p github.PullRequestReviewPayload) error {
@@ -252,14 +514,13 @@ func (g *GitHub) PullRequestReview(p github.PullRequestReviewPayload) error {
 		if g.Discord != nil {
 			g.Discord.sendLog("Repository event from unverified project")
 		}
-		return fmt.Errorf("unknown repository")
+		return ErrUnknownProject
 	}
 	event := &GitHubEvent{
 		event:             PullRequestReview,
 		pullRequestReview: p,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
 func (g *GitHub) PullRequestComment(p github.PullRequestReviewCommentPayload) error {
@@ -268,23 +529,31 @@ func (g *GitHub) PullRequestComment(p github.PullRequestReviewCommentPayload) er
 		if g.Discord != nil {
 			g.Discord.sendLog("Repository event from unverified project")
 		}
-		return fmt.Errorf("unknown repository")
+		return ErrUnknownProject
 	}
 	event := &GitHubEvent{
 		event:              PullRequestComment,
 		pullRequestComment: p,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
-func (g *GitHub) Vulnerability(p github.RepositoryVulnerabilityAlertPayload) error {
+// Vulnerability takes repository from the raw payload, the parsed
+// payload doesn't keep it
+func (g *GitHub) Vulnerability(p github.RepositoryVulnerabilityAlertPayload, repository string) error {
+	if g.verifyProject(repository) != nil {
+		log.Warnf("Payload came from unverified project: %+v", p)
+		if g.Discord != nil {
+			g.Discord.sendLog("Repository event from unverified project")
+		}
+		return ErrUnknownProject
+	}
 	event := &GitHubEvent{
 		event:         Vulnerability,
 		vulnerability: p,
+		repository:    repository,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
 
 func (g *GitHub) SecurityAdvisory(p github.SecurityAdvisoryPayload) error {
@@ -292,6 +561,5 @@ func (g *GitHub) SecurityAdvisory(p github.SecurityAdvisoryPayload) error {
 		event:    Security,
 		security: p,
 	}
-	g.Events <- *event
-	return nil
+	return g.publish(event)
 }
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrGitHubAPIDisabled is returned when no GitHub API credentials are configured
+var ErrGitHubAPIDisabled = fmt.Errorf("GitHub API is not configured")
+
+// GitHubAPIError is a non-successful response of GitHub API
+type GitHubAPIError struct {
+	Status  int
+	Message string
+}
+
+func (e *GitHubAPIError) Error() string {
+	if e.Status == http.StatusNotFound {
+		return "not found on GitHub"
+	}
+	return fmt.Sprintf("GitHub API responded with %d: %s", e.Status, e.Message)
+}
+
+type GitHubUser struct {
+	Login     string `json:"login"`
+	AvatarURL string `json:"avatar_url"`
+	HTMLURL   string `json:"html_url"`
+}
+
+type GitHubLabel struct {
+	Name string `json:"name"`
+}
+
+type GitHubIssue struct {
+	Number   int64         `json:"number"`
+	Title    string        `json:"title"`
+	Body     string        `json:"body"`
+	State    string        `json:"state"`
+	HTMLURL  string        `json:"html_url"`
+	Comments int64         `json:"comments"`
+	User     GitHubUser    `json:"user"`
+	Labels   []GitHubLabel `json:"labels"`
+}
+
+type GitHubPullRequest struct {
+	Number    int64      `json:"number"`
+	Title     string     `json:"title"`
+	HTMLURL   string     `json:"html_url"`
+	Draft     bool       `json:"draft"`
+	CreatedAt time.Time  `json:"created_at"`
+	User      GitHubUser `json:"user"`
+	Head      struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+type GitHubRelease struct {
+	TagName     string     `json:"tag_name"`
+	Name        string     `json:"name"`
+	Body        string     `json:"body"`
+	HTMLURL     string     `json:"html_url"`
+	Prerelease  bool       `json:"prerelease"`
+	PublishedAt time.Time  `json:"published_at"`
+	Author      GitHubUser `json:"author"`
+	Assets      []struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// GitHubAPI is a client of GitHub REST API. It authenticates with
+// a token or as a GitHub App installation
+type GitHubAPI struct {
+	client *http.Client
+
+	mutex   sync.Mutex
+	config  GitHubAPIConfig
+	key     *rsa.PrivateKey
+	token   string
+	expires time.Time
+}
+
+func (g *GitHubAPI) Init(config GitHubAPIConfig) error {
+	log.Infof("Initializing GitHub API client")
+	g.client = new(http.Client)
+	return g.SetConfig(config)
+}
+
+// SetConfig replaces credentials. Installation token of the previous
+// configuration is dropped
+func (g *GitHubAPI) SetConfig(config GitHubAPIConfig) error {
+	key, err := appKey(config)
+	if err != nil {
+		return err
+	}
+	g.setConfig(config, key)
+	return nil
+}
+
+// appKey loads private key of GitHub App, nil is returned when token
+// is used instead
+func appKey(config GitHubAPIConfig) (*rsa.PrivateKey, error) {
+	if config.Token != "" || config.AppID == 0 {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(config.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read GitHub App private key: %s", err.Error())
+	}
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse GitHub App private key: %s", err.Error())
+	}
+	return key, nil
+}
+
+func (g *GitHubAPI) setConfig(config GitHubAPIConfig, key *rsa.PrivateKey) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.config = config
+	g.key = key
+	g.token = ""
+	g.expires = time.Time{}
+	if !config.Enabled() {
+		log.Infof("GitHub API client is disabled")
+	}
+}
+
+// Enabled reports whether credentials are configured
+func (g *GitHubAPI) Enabled() bool {
+	if g == nil {
+		return false
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.config.Enabled()
+}
+
+// CreateIssue opens an issue in repository "owner/repository"
+func (g *GitHubAPI) CreateIssue(repo, title, body string) (*GitHubIssue, error) {
+	issue := new(GitHubIssue)
+	request := map[string]string{"title": title, "body": body}
+	if err := g.do(http.MethodPost, "/repos/"+repo+"/issues", request, issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// Issue returns an issue or a pull request by number
+func (g *GitHubAPI) Issue(repo string, number int64) (*GitHubIssue, error) {
+	issue := new(GitHubIssue)
+	if err := g.do(http.MethodGet, fmt.Sprintf("/repos/%s/issues/%d", repo, number), nil, issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// CloseIssue closes an issue or a pull request
+func (g *GitHubAPI) CloseIssue(repo string, number int64) (*GitHubIssue, error) {
+	issue := new(GitHubIssue)
+	request := map[string]string{"state": "closed"}
+	if err := g.do(http.MethodPatch, fmt.Sprintf("/repos/%s/issues/%d", repo, number), request, issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// AddLabels adds labels to an issue or a pull request and returns all
+// of its labels
+func (g *GitHubAPI) AddLabels(repo string, number int64, labels []string) ([]GitHubLabel, error) {
+	result := []GitHubLabel{}
+	request := map[string][]string{"labels": labels}
+	if err := g.do(http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/labels", repo, number), request, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// PullRequests returns open pull requests, newest first
+func (g *GitHubAPI) PullRequests(repo string) ([]GitHubPullRequest, error) {
+	result := []GitHubPullRequest{}
+	if err := g.do(http.MethodGet, "/repos/"+repo+"/pulls?state=open&per_page=25", nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// LatestRelease returns the latest published release which is not
+// a pre-release
+func (g *GitHubAPI) LatestRelease(repo string) (*GitHubRelease, error) {
+	release := new(GitHubRelease)
+	if err := g.do(http.MethodGet, "/repos/"+repo+"/releases/latest", nil, release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// do sends an authenticated request. Request is encoded and response is
+// decoded as JSON when they are not nil
+func (g *GitHubAPI) do(method, path string, request, response interface{}) error {
+	if !g.Enabled() {
+		return ErrGitHubAPIDisabled
+	}
+	authorization, err := g.authorization()
+	if err != nil {
+		return err
+	}
+	return g.send(method, path, authorization, request, response)
+}
+
+func (g *GitHubAPI) send(method, path, authorization string, request, response interface{}) error {
+	g.mutex.Lock()
+	config := g.config
+	g.mutex.Unlock()
+
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(config.URL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("User-Agent", "eveleve/"+AppVersion)
+	req.Header.Set("Authorization", authorization)
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := *g.client
+	client.Timeout = config.Timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to request GitHub API: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var payload struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&payload)
+		if payload.Message == "" {
+			payload.Message = http.StatusText(resp.StatusCode)
+		}
+		log.Warnf("GitHub API %s %s responded with %d: %s", method, path, resp.StatusCode, payload.Message)
+		return &GitHubAPIError{Status: resp.StatusCode, Message: payload.Message}
+	}
+	if response == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("Failed to decode GitHub API response: %s", err.Error())
+	}
+	return nil
+}
+
+// authorization returns Authorization header value. Installation token
+// of GitHub App is requested when the previous one is about to expire
+func (g *GitHubAPI) authorization() (string, error) {
+	g.mutex.Lock()
+	if g.config.Token != "" {
+		defer g.mutex.Unlock()
+		return "Bearer " + g.config.Token, nil
+	}
+	if g.token != "" && time.Now().Add(time.Minute).Before(g.expires) {
+		defer g.mutex.Unlock()
+		return "Bearer " + g.token, nil
+	}
+	appID, installation, key := g.config.AppID, g.config.InstallationID, g.key
+	g.mutex.Unlock()
+
+	jwt, err := appToken(appID, key, time.Now())
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", installation)
+	if err := g.send(http.MethodPost, path, "Bearer "+jwt, nil, &token); err != nil {
+		return "", fmt.Errorf("Failed to get GitHub App installation token: %s", err.Error())
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	// Configuration could be replaced while the token was requested
+	if g.key == key {
+		g.token = token.Token
+		g.expires = token.ExpiresAt
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// appToken returns JSON Web Token which authenticates as GitHub App
+func appToken(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	if key == nil {
+		return "", fmt.Errorf("GitHub App private key is not loaded")
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	// Issued a minute ago to allow clock drift, GitHub accepts 10 minutes at most
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(time.Minute * 9).Unix(),
+		"iss": fmt.Sprintf("%d", appID),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("Failed to sign GitHub App token: %s", err.Error())
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey accepts PKCS#1 keys downloaded from GitHub App settings
+// and PKCS#8 keys
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not a RSA private key")
+	}
+	return rsaKey, nil
+}
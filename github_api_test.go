@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func testGitHubAPI(t *testing.T, config GitHubAPIConfig) *GitHubAPI {
+	t.Helper()
+	config.Timeout = time.Second * 5
+	api := new(GitHubAPI)
+	if err := api.Init(config); err != nil {
+		t.Fatalf("Failed to initialize GitHub API: %s", err.Error())
+	}
+	return api
+}
+
+func TestGitHubAPI_Token(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Bad credentials"}`))
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /repos/owner/repo/issues":
+			var request map[string]string
+			json.NewDecoder(r.Body).Decode(&request)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"number": 7, "title": request["title"], "state": "open"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+		}
+	}))
+	defer server.Close()
+
+	api := testGitHubAPI(t, GitHubAPIConfig{URL: server.URL, Token: "secret"})
+	issue, err := api.CreateIssue("owner/repo", "Crash on start", "")
+	if err != nil {
+		t.Fatalf("CreateIssue failed: %s", err.Error())
+	}
+	if issue.Number != 7 || issue.Title != "Crash on start" || issue.State != "open" {
+		t.Errorf("CreateIssue = %+v", issue)
+	}
+
+	_, err = api.LatestRelease("owner/repo")
+	if apiErr, ok := err.(*GitHubAPIError); !ok || apiErr.Status != http.StatusNotFound {
+		t.Errorf("LatestRelease error = %v, want not found", err)
+	}
+
+	api.SetConfig(GitHubAPIConfig{URL: server.URL, Token: "wrong"})
+	_, err = api.Issue("owner/repo", 7)
+	if err == nil || !strings.Contains(err.Error(), "401: Bad credentials") {
+		t.Errorf("Issue error = %v, want bad credentials", err)
+	}
+
+	api.SetConfig(GitHubAPIConfig{URL: server.URL})
+	if _, err := api.Issue("owner/repo", 7); err != ErrGitHubAPIDisabled {
+		t.Errorf("Issue error = %v, want %v", err, ErrGitHubAPIDisabled)
+	}
+}
+
+func TestGitHubAPI_App(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err.Error())
+	}
+	filename := filepath.Join(t.TempDir(), "app.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		t.Fatalf("Failed to write key: %s", err.Error())
+	}
+
+	tokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		switch r.URL.Path {
+		case "/app/installations/42/access_tokens":
+			parts := strings.Split(auth, ".")
+			if len(parts) != 3 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) != nil ||
+				!strings.Contains(string(claims), `"iss":"3"`) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tokens++
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"token": "installation", "expires_at": time.Now().Add(time.Hour)})
+		case "/repos/owner/repo/pulls":
+			if auth != "installation" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`[{"number": 3, "title": "Add bus", "user": {"login": "author"}, "head": {"ref": "bus"}, "base": {"ref": "master"}}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	api := testGitHubAPI(t, GitHubAPIConfig{URL: server.URL, AppID: 3, InstallationID: 42, PrivateKey: filename})
+	for i := 0; i < 2; i++ {
+		pulls, err := api.PullRequests("owner/repo")
+		if err != nil {
+			t.Fatalf("PullRequests failed: %s", err.Error())
+		}
+		if len(pulls) != 1 || pulls[0].Number != 3 || pulls[0].Head.Ref != "bus" {
+			t.Errorf("PullRequests = %+v", pulls)
+		}
+	}
+	if tokens != 1 {
+		t.Errorf("Installation token was requested %d times, want 1", tokens)
+	}
+}
+
+func TestGitHubCommands(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method + " " + r.URL.Path {
+		case "POST /repos/savageking-io/eveleve/issues":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number": 8, "title": "Crash on start", "state": "open"}`))
+		case "PATCH /repos/savageking-io/evelengine/issues/5":
+			w.Write([]byte(`{"number": 5, "title": "Old bug", "state": "closed"}`))
+		case "POST /repos/savageking-io/eveleve/issues/8/labels":
+			w.Write([]byte(`[{"name": "bug"}, {"name": "good first issue"}]`))
+		case "GET /repos/savageking-io/eveleve/issues/8":
+			w.Write([]byte(`{"number": 8, "title": "Crash on start", "state": "open", "labels": [{"name": "bug"}, {"name": "good first issue"}]}`))
+		case "GET /repos/savageking-io/eveleve/pulls":
+			w.Write([]byte(`[{"number": 3, "title": "Add bus", "draft": true, "user": {"login": "author"}, "head": {"ref": "bus"}, "base": {"ref": "master"}}]`))
+		case "GET /repos/savageking-io/evelengine/releases/latest":
+			w.Write([]byte(`{"tag_name": "v1.2.0", "name": "Engine 1.2", "body": "Faster"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+		}
+	}))
+	defer server.Close()
+
+	m := &Master{
+		Config:    &Config{Projects: []string{"github.com/savageking-io/eveleve", "github.com/savageking-io/evelengine", "github.com/org/*"}},
+		GitHubAPI: testGitHubAPI(t, GitHubAPIConfig{URL: server.URL, Token: "secret"}),
+	}
+	var replies []string
+	var embeds []*discordgo.MessageEmbed
+	router := new(CommandRouter)
+	router.send = func(channelID, text string, embed *discordgo.MessageEmbed) error {
+		replies = append(replies, text)
+		embeds = append(embeds, embed)
+		return nil
+	}
+	for _, def := range m.githubCommands() {
+		if err := router.Register(def); err != nil {
+			t.Fatalf("Failed to register %s: %s", def.Name, err.Error())
+		}
+	}
+
+	tests := []struct {
+		text    string
+		request string
+		want    string
+	}{
+		{"!issue create eveleve Crash on start", "POST /repos/savageking-io/eveleve/issues", "Issue #8 opened in savageking-io/eveleve: Crash on start"},
+		{"!issue close evelengine#5", "PATCH /repos/savageking-io/evelengine/issues/5", "Issue #5 closed in savageking-io/evelengine: Old bug"},
+		{"!issue label savageking-io/eveleve#8 bug, good first issue", "GET /repos/savageking-io/eveleve/issues/8", "bug, good first issue"},
+		{"!pr list github.com/savageking-io/eveleve", "GET /repos/savageking-io/eveleve/pulls", "[#3]() Add bus (draft) by author, `bus` → `master`"},
+		{"!release latest evelengine", "GET /repos/savageking-io/evelengine/releases/latest", "Latest release of savageking-io/evelengine: Engine 1.2"},
+		{"!release latest org/game", "GET /repos/org/game/releases/latest", "org/game has no releases"},
+		{"!issue close 5", "", "number alone works with a single project"},
+		{"!issue close eveleve#five", "", "'eveleve#five' is not an issue number"},
+		{"!pr list other/repo", "", "project not found"},
+		{"!pr list org/..", "", "project not found"},
+	}
+	for _, tt := range tests {
+		replies, embeds, requests = nil, nil, nil
+		if err := router.Handle(&Command{Text: tt.text}); err != nil {
+			t.Errorf("%s: Handle failed: %s", tt.text, err.Error())
+			continue
+		}
+		if len(replies) != 1 {
+			t.Errorf("%s: %d replies, want 1", tt.text, len(replies))
+			continue
+		}
+		got := replies[0]
+		if embeds[0] != nil {
+			got = embeds[0].Title + "\n" + embeds[0].Description
+			for _, field := range embeds[0].Fields {
+				got += "\n" + field.Value
+			}
+		}
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("%s: reply = %q, want %q", tt.text, got, tt.want)
+		}
+		if tt.request != "" && (len(requests) == 0 || requests[len(requests)-1] != tt.request) {
+			t.Errorf("%s: requests = %q, want %q", tt.text, requests, tt.request)
+		}
+		if tt.request == "" && len(requests) > 0 {
+			t.Errorf("%s: unexpected requests %q", tt.text, requests)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// githubRepositoryName matches "owner/repository" which is safe to put into
+// GitHub API request path
+var githubRepositoryName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*/[A-Za-z0-9._-]+$`)
+
+// maxPullRequests limits pull requests listed in an embed
+const maxPullRequests = 15
+
+// githubCommands returns !issue, !pr and !release command families
+func (m *Master) githubCommands() []*CommandDef {
+	repository := CommandArg{
+		Name:        "repository",
+		Description: "Project URL, owner/repository or repository name",
+		Complete:    m.completeProject,
+	}
+	issue := CommandArg{
+		Name:        "issue",
+		Description: "Issue number, e.g. 42, eveleve#42 or owner/repository#42",
+	}
+	return []*CommandDef{
+		{
+			Name:  "issue",
+			Usage: "Manage GitHub issues",
+			Subcommands: []*CommandDef{
+				{
+					Name:    "create",
+					Usage:   "Open an issue",
+					Args:    []CommandArg{repository, {Name: "title", Type: ArgText, Description: "Issue title"}},
+					Handler: m.commandIssueCreate,
+					Admin:   true,
+				},
+				{
+					Name:    "close",
+					Usage:   "Close an issue",
+					Args:    []CommandArg{issue},
+					Handler: m.commandIssueClose,
+					Admin:   true,
+				},
+				{
+					Name:    "label",
+					Usage:   "Add comma separated labels to an issue",
+					Args:    []CommandArg{issue, {Name: "labels", Type: ArgText, Description: "Labels, e.g. bug, good first issue"}},
+					Handler: m.commandIssueLabel,
+					Admin:   true,
+				},
+			},
+		},
+		{
+			Name:  "pr",
+			Usage: "GitHub pull requests",
+			Subcommands: []*CommandDef{
+				{
+					Name:    "list",
+					Usage:   "List open pull requests",
+					Args:    []CommandArg{repository},
+					Handler: m.commandPullRequestList,
+				},
+			},
+		},
+		{
+			Name:  "release",
+			Usage: "GitHub releases",
+			Subcommands: []*CommandDef{
+				{
+					Name:    "latest",
+					Usage:   "Show the latest release",
+					Args:    []CommandArg{repository},
+					Handler: m.commandReleaseLatest,
+				},
+			},
+		},
+	}
+}
+
+func (m *Master) commandIssueCreate(ctx *CommandContext) error {
+	if !m.GitHubAPI.Enabled() {
+		return ErrGitHubAPIDisabled
+	}
+	repo, err := m.githubRepository(ctx.String("repository"))
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Opened from Discord by <@%s>", ctx.Command.AuthorID)
+	if m.Links != nil {
+		if login, err := m.Links.Login(ctx.Command.AuthorID); err == nil && login != "" {
+			body = fmt.Sprintf("Opened from Discord by @%s", login)
+		}
+	}
+	issue, err := m.GitHubAPI.CreateIssue(repo, ctx.String("title"), body)
+	if err != nil {
+		return err
+	}
+	return ctx.ReplyEmbed(githubIssueEmbed(repo, "opened", issue))
+}
+
+func (m *Master) commandIssueClose(ctx *CommandContext) error {
+	if !m.GitHubAPI.Enabled() {
+		return ErrGitHubAPIDisabled
+	}
+	repo, number, err := m.githubIssue(ctx)
+	if err != nil {
+		return err
+	}
+	issue, err := m.GitHubAPI.CloseIssue(repo, number)
+	if err != nil {
+		return err
+	}
+	return ctx.ReplyEmbed(githubIssueEmbed(repo, "closed", issue))
+}
+
+func (m *Master) commandIssueLabel(ctx *CommandContext) error {
+	if !m.GitHubAPI.Enabled() {
+		return ErrGitHubAPIDisabled
+	}
+	repo, number, err := m.githubIssue(ctx)
+	if err != nil {
+		return err
+	}
+	labels := []string{}
+	for _, label := range strings.Split(ctx.String("labels"), ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	if len(labels) == 0 {
+		return &CommandError{Def: ctx.Def, Message: "no labels given"}
+	}
+	if _, err := m.GitHubAPI.AddLabels(repo, number, labels); err != nil {
+		return err
+	}
+	issue, err := m.GitHubAPI.Issue(repo, number)
+	if err != nil {
+		return err
+	}
+	return ctx.ReplyEmbed(githubIssueEmbed(repo, "labeled", issue))
+}
+
+func (m *Master) commandPullRequestList(ctx *CommandContext) error {
+	if !m.GitHubAPI.Enabled() {
+		return ErrGitHubAPIDisabled
+	}
+	repo, err := m.githubRepository(ctx.String("repository"))
+	if err != nil {
+		return err
+	}
+	pulls, err := m.GitHubAPI.PullRequests(repo)
+	if err != nil {
+		return err
+	}
+	return ctx.ReplyEmbed(githubPullRequestsEmbed(repo, pulls))
+}
+
+func (m *Master) commandReleaseLatest(ctx *CommandContext) error {
+	if !m.GitHubAPI.Enabled() {
+		return ErrGitHubAPIDisabled
+	}
+	repo, err := m.githubRepository(ctx.String("repository"))
+	if err != nil {
+		return err
+	}
+	release, err := m.GitHubAPI.LatestRelease(repo)
+	if apiErr, ok := err.(*GitHubAPIError); ok && apiErr.Status == http.StatusNotFound {
+		return ctx.Reply(repo + " has no releases")
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.ReplyEmbed(githubReleaseEmbed(repo, release))
+}
+
+// githubRepository resolves a project name into "owner/repository".
+// Commands act only on projects which are allowed to send webhooks
+func (m *Master) githubRepository(name string) (string, error) {
+	projects, err := m.Projects()
+	if err != nil {
+		return "", err
+	}
+	urls := []string{}
+	for _, project := range projects {
+		urls = append(urls, project.URL)
+	}
+
+	var repo string
+	project, err := m.FindProject(name)
+	switch err {
+	case nil:
+		repo = strings.TrimPrefix(project.URL, "github.com/")
+	case ErrProjectNotFound:
+		// Projects allowed by patterns are found by owner/repository only
+		repo = strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(name, "https://"), "/"), "github.com/")
+	default:
+		return "", err
+	}
+	// Names made of dots would change the request path
+	if !githubRepositoryName.MatchString(repo) || strings.Trim(repo[strings.Index(repo, "/")+1:], ".") == "" ||
+		!allowProject(parseProjectPatterns(urls), repo) {
+		return "", ErrProjectNotFound
+	}
+	return repo, nil
+}
+
+// githubIssue resolves issue argument: "owner/repository#42",
+// "repository#42" or a number of an issue of the only project
+func (m *Master) githubIssue(ctx *CommandContext) (string, int64, error) {
+	ref := ctx.String("issue")
+	name := ""
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		name, ref = ref[:i], ref[i+1:]
+	}
+	number, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil || number <= 0 {
+		return "", 0, &CommandError{Def: ctx.Def, Message: fmt.Sprintf("'%s' is not an issue number", ctx.String("issue"))}
+	}
+	if name != "" {
+		repo, err := m.githubRepository(name)
+		return repo, number, err
+	}
+
+	projects, err := m.Projects()
+	if err != nil {
+		return "", 0, err
+	}
+	repos := []string{}
+	for _, project := range projects {
+		if p, err := parseProjectPattern(project.URL); err == nil && p.exact() {
+			repos = append(repos, project.URL)
+		}
+	}
+	if len(repos) != 1 {
+		return "", 0, &CommandError{Def: ctx.Def, Message: "number alone works with a single project, use repository#number"}
+	}
+	repo, err := m.githubRepository(repos[0])
+	return repo, number, err
+}
+
+// githubIssueEmbed shows an issue after a command changed it
+func githubIssueEmbed(repo, verb string, issue *GitHubIssue) *discordgo.MessageEmbed {
+	color := colorOpened
+	if issue.State == "closed" {
+		color = colorClosed
+	}
+	msg := &discordgo.MessageEmbed{
+		Title:  truncateText(fmt.Sprintf("Issue #%d %s in %s: %s", issue.Number, verb, repo, issue.Title), maxEmbedTitle),
+		URL:    issue.HTMLURL,
+		Color:  color,
+		Author: githubAuthor(issue.User.Login, issue.User.AvatarURL, issue.User.HTMLURL),
+	}
+	labels := []string{}
+	for _, label := range issue.Labels {
+		labels = append(labels, label.Name)
+	}
+	if len(labels) > 0 {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+			Name:   "Labels",
+			Value:  truncateText(strings.Join(labels, ", "), maxEmbedField),
+			Inline: true,
+		})
+	}
+	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "State", Value: issue.State, Inline: true})
+	return msg
+}
+
+// githubPullRequestsEmbed lists open pull requests
+func githubPullRequestsEmbed(repo string, pulls []GitHubPullRequest) *discordgo.MessageEmbed {
+	msg := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Open pull requests of %s", repo),
+		URL:   fmt.Sprintf("https://github.com/%s/pulls", repo),
+		Color: colorGitHub,
+	}
+	if len(pulls) == 0 {
+		msg.Description = "No open pull requests"
+		return msg
+	}
+
+	lines := []string{}
+	for i, pull := range pulls {
+		if i == maxPullRequests {
+			lines = append(lines, fmt.Sprintf("and %s more", plural(len(pulls)-i, "pull request")))
+			break
+		}
+		draft := ""
+		if pull.Draft {
+			draft = " (draft)"
+		}
+		title := truncateText(pull.Title, 80)
+		lines = append(lines, fmt.Sprintf("[#%d](%s) %s%s by %s, `%s` → `%s`",
+			pull.Number, pull.HTMLURL, title, draft, pull.User.Login, pull.Head.Ref, pull.Base.Ref))
+	}
+	msg.Description = truncateLines(lines, maxEmbedText*4)
+	return msg
+}
+
+// githubReleaseEmbed shows a release returned by GitHub API
+func githubReleaseEmbed(repo string, r *GitHubRelease) *discordgo.MessageEmbed {
+	name := r.TagName
+	if r.Name != "" {
+		name = r.Name
+	}
+	msg := &discordgo.MessageEmbed{
+		Title:       truncateText(fmt.Sprintf("Latest release of %s: %s", repo, name), maxEmbedTitle),
+		URL:         r.HTMLURL,
+		Color:       colorOpened,
+		Author:      githubAuthor(r.Author.Login, r.Author.AvatarURL, r.Author.HTMLURL),
+		Description: truncateText(r.Body, maxEmbedText),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Tag", Value: "`" + r.TagName + "`", Inline: true},
+		},
+	}
+	if !r.PublishedAt.IsZero() {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+			Name:   "Published",
+			Value:  r.PublishedAt.Format("Jan 2, 2006"),
+			Inline: true,
+		})
+	}
+
+	assets := []string{}
+	for _, asset := range r.Assets {
+		assets = append(assets, fmt.Sprintf("[%s](%s)", asset.Name, asset.BrowserDownloadURL))
+	}
+	if len(assets) > 0 {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+			Name:  "Assets",
+			Value: truncateLines(assets, maxEmbedField),
+		})
+	}
+	return msg
+}
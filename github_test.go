@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitHub_Handle(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "github", "issues_opened.json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %s", err.Error())
+	}
+	alert := []byte(`{"action": "create", "alert": {"affected_package_name": "yaml"}, "repository": {"full_name": "savageking-io/eveleve"}}`)
+	sign := func(secret string, body []byte) string {
+		mac := hmac.New(sha1.New, []byte(secret))
+		mac.Write(body)
+		return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	cases := []struct {
+		name      string
+		method    string
+		event     string
+		body      []byte
+		signature string
+		projects  []string
+		// full fills the event queue before the request
+		full   bool
+		status int
+	}{
+		{"accepted", "POST", "issues", data, sign("secret", data), []string{"github.com/savageking-io/eveleve"}, false, 202},
+		{"bad signature", "POST", "issues", data, sign("other", data), []string{"github.com/savageking-io/eveleve"}, false, 401},
+		{"no signature", "POST", "issues", data, "", []string{"github.com/savageking-io/eveleve"}, false, 401},
+		{"malformed", "POST", "issues", []byte("{"), sign("secret", []byte("{")), []string{"github.com/savageking-io/eveleve"}, false, 400},
+		{"no event", "POST", "", data, sign("secret", data), []string{"github.com/savageking-io/eveleve"}, false, 400},
+		{"wrong method", "GET", "issues", data, sign("secret", data), []string{"github.com/savageking-io/eveleve"}, false, 405},
+		{"ping", "POST", "ping", []byte("{}"), sign("secret", []byte("{}")), []string{"github.com/savageking-io/eveleve"}, false, 200},
+		{"unknown project", "POST", "issues", data, sign("secret", data), []string{"github.com/savageking-io/other"}, false, 404},
+		{"vulnerability", "POST", "repository_vulnerability_alert", alert, sign("secret", alert), []string{"github.com/savageking-io/eveleve"}, false, 202},
+		{"vulnerability of denied project", "POST", "repository_vulnerability_alert", alert, sign("secret", alert),
+			[]string{"github.com/savageking-io/*", "!github.com/savageking-io/eveleve"}, false, 404},
+		{"queue full", "POST", "issues", data, sign("secret", data), []string{"github.com/savageking-io/eveleve"}, true, 503},
+	}
+	for _, c := range cases {
+		bus := new(Bus)
+		bus.Init()
+		block := make(chan struct{})
+		bus.Subscribe(SourceGitHub, "test", 1, func(e Event) error {
+			<-block
+			return nil
+		})
+		if c.full {
+			// The first event is taken by the handler, the second one fills the queue
+			bus.Publish(Event{Source: SourceGitHub})
+			bus.Publish(Event{Source: SourceGitHub})
+		}
+
+		g := &GitHub{Bus: bus}
+		g.SetProjects(c.projects)
+		if err := g.SetSecret("secret"); err != nil {
+			t.Fatalf("SetSecret: %s", err.Error())
+		}
+		r := httptest.NewRequest(c.method, "/github", bytes.NewReader(c.body))
+		if c.event != "" {
+			r.Header.Set("X-GitHub-Event", c.event)
+		}
+		if c.signature != "" {
+			r.Header.Set("X-Hub-Signature", c.signature)
+		}
+		w := httptest.NewRecorder()
+		g.Handle(w, r)
+		if w.Code != c.status {
+			t.Errorf("%s: status = %d, want %d: %s", c.name, w.Code, c.status, w.Body.String())
+		}
+		close(block)
+	}
+
+	g := &GitHub{Bus: new(Bus)}
+	g.SetProjects([]string{"github.com/savageking-io/eveleve"})
+	g.SetSecret("secret")
+	r := httptest.NewRequest("POST", "/github", bytes.NewReader(data))
+	r.Header.Set("X-GitHub-Event", "issues")
+	r.Header.Set("X-Hub-Signature", sign("secret", data))
+	w := httptest.NewRecorder()
+	r.Body = http.MaxBytesReader(w, r.Body, 16)
+	g.Handle(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too large: status = %d, want 413", w.Code)
+	}
+}
+
+func TestGitHub_HandleProjectSecret(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "github", "issues_opened.json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %s", err.Error())
+	}
+	sign := func(secret string) string {
+		mac := hmac.New(sha1.New, []byte(secret))
+		mac.Write(data)
+		return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	bus := new(Bus)
+	bus.Init()
+	g := &GitHub{Bus: bus}
+	g.SetProjects([]string{"github.com/savageking-io/*"})
+	if err := g.SetSecret("global"); err != nil {
+		t.Fatalf("SetSecret: %s", err.Error())
+	}
+	if err := g.SetSecrets([]ProjectSecret{
+		{Projects: []string{"github.com/other/*"}, Secret: "other"},
+		{Projects: []string{"github.com/savageking-io/eveleve"}, Secret: "eveleve"},
+	}); err != nil {
+		t.Fatalf("SetSecrets: %s", err.Error())
+	}
+
+	for secret, status := range map[string]int{"eveleve": 202, "global": 401, "other": 401} {
+		r := httptest.NewRequest("POST", "/github", bytes.NewReader(data))
+		r.Header.Set("X-GitHub-Event", "issues")
+		r.Header.Set("X-Hub-Signature", sign(secret))
+		w := httptest.NewRecorder()
+		g.Handle(w, r)
+		if w.Code != status {
+			t.Errorf("signed with %s: status = %d, want %d", secret, w.Code, status)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// History records every GitHub and Travis event into the storage
+type History struct {
+	storage   Storage
+	retention time.Duration
+	lastPrune time.Time
+}
+
+func (h *History) Init(storage Storage, bus *Bus, retention time.Duration) error {
+	log.Infof("Initializing Event History")
+	if storage == nil {
+		return fmt.Errorf("nil storage")
+	}
+	if bus == nil {
+		return fmt.Errorf("nil bus")
+	}
+	h.storage = storage
+	h.retention = retention
+
+	if err := h.prune(); err != nil {
+		return err
+	}
+
+	for _, source := range []EventSource{SourceGitHub, SourceTravis} {
+		if _, err := bus.Subscribe(source, "history", 0, h.record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *History) record(e Event) error {
+	record := NewEventRecord(e)
+	if record == nil {
+		return nil
+	}
+	if err := h.storage.AddEvent(record); err != nil {
+		return fmt.Errorf("Failed to save event: %s", err.Error())
+	}
+
+	if time.Since(h.lastPrune) > time.Hour*24 {
+		return h.prune()
+	}
+	return nil
+}
+
+func (h *History) prune() error {
+	h.lastPrune = time.Now()
+	if h.retention <= 0 {
+		return nil
+	}
+	removed, err := h.storage.PruneEvents(time.Now().Add(-h.retention))
+	if err != nil {
+		return fmt.Errorf("Failed to prune event history: %s", err.Error())
+	}
+	if removed > 0 {
+		log.Infof("Removed %d events older than %s from history", removed, h.retention)
+	}
+	return nil
+}
+
+// NewEventRecord builds history record from a bus event. Nil is
+// returned for events which are not kept in the history
+func NewEventRecord(e Event) *EventRecord {
+	var record *EventRecord
+	switch e.Source {
+	case SourceGitHub:
+		if e.GitHub != nil {
+			record = e.GitHub.Record()
+		}
+	case SourceTravis:
+		if e.Travis != nil {
+			record = e.Travis.Record()
+		}
+	}
+	if record != nil {
+		record.Time = e.Time
+	}
+	return record
+}
+
+// Record describes GitHub event as a history record
+func (e *GitHubEvent) Record() *EventRecord {
+	r := &EventRecord{
+		Source: SourceGitHub.String(),
+		Type:   e.event.String(),
+	}
+
+	switch e.event {
+	case CommitComment:
+		p := e.commitComment
+		r.Action = p.Action
+		r.Project = p.Repository.FullName
+		r.Actor = p.Sender.Login
+		r.URL = p.Comment.HTMLURL
+	case Fork:
+		p := e.fork
+		r.Project = p.Repository.FullName
+		r.Actor = p.Sender.Login
+		r.Title = p.Forkee.FullName
+		r.URL = p.Forkee.HTMLURL
+	case Issue:
+		p := e.issue
+		r.Action = p.Action
+		r.Project = p.Repository.FullName
+		r.Actor = p.Sender.Login
+		r.Number = p.Issue.Number
+		r.Title = p.Issue.Title
+		r.URL = p.Issue.HTMLURL
+		for _, label := range p.Issue.Labels {
+			r.Labels = append(r.Labels, label.Name)
+		}
+	case IssueComment:
+		p := e.issueComment
+		r.Action = p.Action
+		r.Project = p.Repository.FullName
+		r.Actor = p.Sender.Login
+		r.Number = p.Issue.Number
+		r.Title = p.Issue.Title
+		r.URL = p.Comment.HTMLURL
+		for _, label := range p.Issue.Labels {
+			r.Labels = append(r.Labels, label.Name)
+		}
+	case Milestone:
+		p := e.milestone
+		r.Action = p.Action
+		r.Project = p.Repository.FullName
+		r.Actor = p.Sender.Login
+		r.Number = p.Milestone.Number
+		r.Title = p.Milestone.Title
+		r.URL = p.Milestone.HTMLURL
+	case PullRequest:
+		p := e.pullRequest
+		r.Action = p.Action
+		r.Project = p.Repository.FullName
+		r.Branch = p.PullRequest.Base.Ref
+		r.Actor = p.Sender.Login
+		r.Number = p.PullRequest.Number
+		r.Title = p.PullRequest.Title
+		r.URL = p.PullRequest.HTMLURL
+		r.Merged = p.PullRequest.Merged
+		for _, label := range p.PullRequest.Labels {
+			r.Labels = append(r.Labels, label.Name)
+		}
+	case PullRequestReview:
+		p := e.pullRequestReview
+		r.Action = p.Action
+		r.Project = p.Repository.FullName
+		r.Branch = p.PullRequest.Base.Ref
+		r.Actor = p.Sender.Login
+		r.Number = p.PullRequest.Number
+		r.Title = p.PullRequest.Title
+		r.URL = p.Review.HTMLURL
+		r.Result = p.Review.State
+	case PullRequestComment:
+		p := e.pullRequestComment
+		r.Action = p.Action
+		r.Project = p.Repository.FullName
+		r.Branch = p.PullRequest.Base.Ref
+		r.Actor = p.Sender.Login
+		r.Number = p.PullRequest.Number
+		r.Title = p.PullRequest.Title
+		r.URL = p.Comment.HTMLURL
+	case Push:
+		p := e.push
+		r.Project = p.Repository.FullName
+		r.Branch = strings.TrimPrefix(p.Ref, "refs/heads/")
+		r.Actor = p.Sender.Login
+		r.Title = firstLine(p.HeadCommit.Message)
+		r.URL = p.Compare
+		r.Commits = len(p.Commits)
+		for _, c := range p.Commits {
+			author := c.Author.Username
+			if author == "" {
+				author = c.Author.Name
+			}
+			r.Authors = append(r.Authors, author)
+		}
+	case Release:
+		p := e.release
+		r.Action = p.Action
+		r.Project = p.Repository.FullName
+		r.Branch = p.Release.TargetCommitish
+		r.Actor = p.Sender.Login
+		r.Title = p.Release.TagName
+		r.URL = p.Release.HTMLURL
+	case Vulnerability:
+		p := e.vulnerability
+		r.Action = p.Action
+		r.Project = e.repository
+		r.Title = p.Alert.AffectedPackageName
+		r.URL = p.Alert.ExternalReference
+	case Security:
+		p := e.security
+		r.Action = p.Action
+		r.Title = p.SecurityAdvisory.Summary
+		r.Result = p.SecurityAdvisory.Severity
+	default:
+		return nil
+	}
+
+	return r
+}
+
+// Record describes Travis build notification as a history record
+func (p *TravisPacket) Record() *EventRecord {
+	number, _ := strconv.ParseInt(p.Number, 10, 64)
+	return &EventRecord{
+		Source:  SourceTravis.String(),
+		Type:    "build",
+		Action:  p.State,
+		Project: p.Repository.OwnerName + "/" + p.Repository.Name,
+		Branch:  p.Branch,
+		Actor:   p.AuthorName,
+		Number:  number,
+		Title:   firstLine(p.Message),
+		URL:     p.BuildURL,
+		Result:  strings.ToLower(p.StatusMessage),
+	}
+}
+
+func firstLine(text string) string {
+	if i := strings.Index(text, "\n"); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
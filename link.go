@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// User settings of GitHub links. Logins are kept in lower case
+const (
+	settingGitHub        = "github"
+	settingGitHubPending = "github_pending"
+	settingGitHubCode    = "github_code"
+	settingGitHubExpires = "github_code_expires"
+)
+
+// linkCodeTTL limits time to confirm GitHub login
+const linkCodeTTL = time.Hour
+
+var linkCode = regexp.MustCompile(`eveleve-[0-9a-f]{12}`)
+
+// githubMention matches @login in issues, pull requests and comments
+var githubMention = regexp.MustCompile(`(?:^|[^\w/@.])@([A-Za-z0-9][A-Za-z0-9-]{0,38})`)
+
+// GitHubLinks connects GitHub logins to Discord users. Login is confirmed
+// by a comment with a one-time code received from GitHub webhook
+type GitHubLinks struct {
+	discord *Discord
+	storage Storage
+}
+
+func (l *GitHubLinks) Init(discord *Discord, storage Storage, bus *Bus) error {
+	log.Infof("Initializing GitHub Links")
+	if discord == nil {
+		return fmt.Errorf("nil discord")
+	}
+	if storage == nil {
+		return fmt.Errorf("nil storage")
+	}
+	if bus == nil {
+		return fmt.Errorf("nil bus")
+	}
+	l.discord = discord
+	l.storage = storage
+
+	_, err := bus.Subscribe(SourceGitHub, "links", 0, l.verify)
+	return err
+}
+
+// Start returns one-time code which confirms login of the Discord user
+// when posted in a comment
+func (l *GitHubLinks) Start(userID, login string) (string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("Failed to generate code: %s", err.Error())
+	}
+	code := "eveleve-" + hex.EncodeToString(buf)
+
+	settings := map[string]string{
+		settingGitHubPending: strings.ToLower(login),
+		settingGitHubCode:    code,
+		settingGitHubExpires: time.Now().Add(linkCodeTTL).Format(time.RFC3339),
+	}
+	for key, value := range settings {
+		if err := l.storage.SetUserSetting(userID, key, value); err != nil {
+			return "", fmt.Errorf("Failed to save code: %s", err.Error())
+		}
+	}
+	return code, nil
+}
+
+// Login returns GitHub login linked to the Discord user
+func (l *GitHubLinks) Login(userID string) (string, error) {
+	settings, err := l.storage.UserSettings(userID)
+	if err != nil {
+		return "", err
+	}
+	return settings[settingGitHub], nil
+}
+
+// Unlink removes GitHub login and pending code of the Discord user
+func (l *GitHubLinks) Unlink(userID string) error {
+	for _, key := range []string{settingGitHub, settingGitHubPending, settingGitHubCode, settingGitHubExpires} {
+		if err := l.storage.SetUserSetting(userID, key, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Mentions returns Discord mentions of users linked to logins
+func (l *GitHubLinks) Mentions(logins []string) string {
+	mentions := []string{}
+	for _, login := range logins {
+		users, err := l.storage.UsersBySetting(settingGitHub, strings.ToLower(login))
+		if err != nil {
+			log.Errorf("Failed to find Discord user of %s: %s", login, err.Error())
+			continue
+		}
+		for _, user := range users {
+			mention := "<@" + user + ">"
+			if !containsString(mentions, mention) {
+				mentions = append(mentions, mention)
+			}
+		}
+	}
+	return strings.Join(mentions, " ")
+}
+
+// verify links login when comment sent by it has a pending code
+func (l *GitHubLinks) verify(e Event) error {
+	if e.GitHub == nil {
+		return nil
+	}
+	var login, body string
+	switch e.GitHub.event {
+	case CommitComment:
+		login, body = e.GitHub.commitComment.Sender.Login, e.GitHub.commitComment.Comment.Body
+	case IssueComment:
+		login, body = e.GitHub.issueComment.Sender.Login, e.GitHub.issueComment.Comment.Body
+	case PullRequestComment:
+		login, body = e.GitHub.pullRequestComment.Sender.Login, e.GitHub.pullRequestComment.Comment.Body
+	default:
+		return nil
+	}
+	login = strings.ToLower(login)
+
+	for _, code := range linkCode.FindAllString(body, -1) {
+		users, err := l.storage.UsersBySetting(settingGitHubCode, code)
+		if err != nil {
+			return fmt.Errorf("Failed to find code: %s", err.Error())
+		}
+		for _, user := range users {
+			if err := l.confirm(user, login, e.Time); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *GitHubLinks) confirm(userID, login string, now time.Time) error {
+	settings, err := l.storage.UserSettings(userID)
+	if err != nil {
+		return err
+	}
+	if settings[settingGitHubPending] != login {
+		log.Warnf("GitHub user %s posted code of Discord user %s waiting for %s", login, userID, settings[settingGitHubPending])
+		return nil
+	}
+	expires, err := time.Parse(time.RFC3339, settings[settingGitHubExpires])
+	if err != nil || now.After(expires) {
+		log.Infof("GitHub user %s posted expired code of Discord user %s", login, userID)
+		return nil
+	}
+
+	// Login belongs to a single Discord user
+	previous, err := l.storage.UsersBySetting(settingGitHub, login)
+	if err != nil {
+		return err
+	}
+	for _, user := range previous {
+		if err := l.storage.SetUserSetting(user, settingGitHub, ""); err != nil {
+			return err
+		}
+	}
+	if err := l.Unlink(userID); err != nil {
+		return err
+	}
+	if err := l.storage.SetUserSetting(userID, settingGitHub, login); err != nil {
+		return fmt.Errorf("Failed to link GitHub user %s: %s", login, err.Error())
+	}
+	log.Infof("Discord user %s is linked to GitHub user %s", userID, login)
+	l.discord.sendLog(fmt.Sprintf("<@%s> is linked to GitHub user %s", userID, login))
+	return nil
+}
+
+// githubMentions returns logins to notify about the event: assignees,
+// requested reviewers and users mentioned in texts. Sender is left out
+func githubMentions(e *GitHubEvent) []string {
+	logins := []string{}
+	var sender, text string
+	switch e.event {
+	case Issue:
+		p := &e.issue
+		sender = p.Sender.Login
+		switch p.Action {
+		case "assigned":
+			if p.Assignee != nil {
+				logins = append(logins, p.Assignee.Login)
+			}
+		case "opened":
+			text = p.Issue.Body
+		}
+	case IssueComment:
+		sender = e.issueComment.Sender.Login
+		if e.issueComment.Action == "created" {
+			text = e.issueComment.Comment.Body
+		}
+	case PullRequest:
+		p := &e.pullRequest
+		sender = p.Sender.Login
+		switch p.Action {
+		case "assigned":
+			if p.Assignee != nil {
+				logins = append(logins, p.Assignee.Login)
+			}
+		case "review_requested":
+			if p.RequestedReviewer != nil {
+				logins = append(logins, p.RequestedReviewer.Login)
+			}
+		case "opened":
+			text = p.PullRequest.Body
+		}
+	case PullRequestReview:
+		sender = e.pullRequestReview.Sender.Login
+		if e.pullRequestReview.Action == "submitted" {
+			text = e.pullRequestReview.Review.Body
+		}
+	case PullRequestComment:
+		sender = e.pullRequestComment.Sender.Login
+		if e.pullRequestComment.Action == "created" {
+			text = e.pullRequestComment.Comment.Body
+		}
+	}
+
+	for _, match := range githubMention.FindAllStringSubmatch(text, -1) {
+		logins = append(logins, match[1])
+	}
+	result := []string{}
+	for _, login := range logins {
+		if !strings.EqualFold(login, sender) && !containsString(result, login) {
+			result = append(result, login)
+		}
+	}
+	return result
+}
+
+// linkCommands returns !link command family
+func (m *Master) linkCommands() *CommandDef {
+	return &CommandDef{
+		Name:  "link",
+		Usage: "Link your Discord account to GitHub to be mentioned in notifications",
+		Subcommands: []*CommandDef{
+			{
+				Name:    "github",
+				Usage:   "Start linking GitHub account, shows code to post on GitHub",
+				Args:    []CommandArg{{Name: "login", Description: "GitHub login"}},
+				Handler: m.commandLinkGitHub,
+			},
+			{
+				Name:    "show",
+				Usage:   "Show linked GitHub account",
+				Handler: m.commandLinkShow,
+			},
+			{
+				Name:    "remove",
+				Usage:   "Unlink GitHub account",
+				Handler: m.commandLinkRemove,
+			},
+		},
+	}
+}
+
+var githubLogin = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,38}$`)
+
+func (m *Master) commandLinkGitHub(ctx *CommandContext) error {
+	if m.Links == nil {
+		return fmt.Errorf("GitHub links are not available")
+	}
+	login := strings.TrimPrefix(ctx.String("login"), "@")
+	if !githubLogin.MatchString(login) {
+		return &CommandError{Def: ctx.Def, Message: fmt.Sprintf("'%s' is not a GitHub login", login)}
+	}
+	code, err := m.Links.Start(ctx.Command.AuthorID, login)
+	if err != nil {
+		return err
+	}
+	return ctx.Reply(fmt.Sprintf("Post a comment with `%s` as %s on an issue, pull request or commit of a project "+
+		"sending webhooks to this bot within %s. The comment can be removed afterwards", code, login, linkCodeTTL))
+}
+
+func (m *Master) commandLinkShow(ctx *CommandContext) error {
+	if m.Links == nil {
+		return fmt.Errorf("GitHub links are not available")
+	}
+	login, err := m.Links.Login(ctx.Command.AuthorID)
+	if err != nil {
+		return err
+	}
+	if login == "" {
+		return ctx.Reply("No GitHub account is linked, use `!link github <login>`")
+	}
+	return ctx.Reply("Linked to GitHub user " + login)
+}
+
+func (m *Master) commandLinkRemove(ctx *CommandContext) error {
+	if m.Links == nil {
+		return fmt.Errorf("GitHub links are not available")
+	}
+	if err := m.Links.Unlink(ctx.Command.AuthorID); err != nil {
+		return err
+	}
+	return ctx.Reply("GitHub account is unlinked")
+}
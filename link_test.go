@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGitHubLinks(t *testing.T) {
+	storage, cleanup := testStorage(t)
+	defer cleanup()
+	links := &GitHubLinks{discord: new(Discord), storage: storage}
+
+	code, err := links.Start("100", "SavageKing")
+	if err != nil {
+		t.Fatalf("Start: %s", err.Error())
+	}
+	comment := func(login, body string) Event {
+		e := parseGitHubEvent(t, IssueComment, `{"action": "created", "sender": {"login": "`+login+`"}, "comment": {"body": "`+body+`"}}`)
+		return Event{Source: SourceGitHub, GitHub: e, Time: time.Now()}
+	}
+
+	// Code posted by another GitHub user doesn't link
+	if err := links.verify(comment("vozgua", "Linking "+code)); err != nil {
+		t.Fatalf("verify: %s", err.Error())
+	}
+	if login, _ := links.Login("100"); login != "" {
+		t.Fatalf("linked to %s by another user", login)
+	}
+
+	if err := links.verify(comment("savageking", "Linking "+code)); err != nil {
+		t.Fatalf("verify: %s", err.Error())
+	}
+	if login, _ := links.Login("100"); login != "savageking" {
+		t.Fatalf("login = %q, want savageking", login)
+	}
+	if mentions := links.Mentions([]string{"SavageKing", "vozgua"}); mentions != "<@100>" {
+		t.Errorf("mentions = %q", mentions)
+	}
+
+	// Code is used once, login moves to the latest Discord user
+	code, _ = links.Start("200", "savageking")
+	links.verify(comment("savageking", code))
+	if mentions := links.Mentions([]string{"savageking"}); mentions != "<@200>" {
+		t.Errorf("mentions = %q, want <@200>", mentions)
+	}
+
+	code, _ = links.Start("300", "vozgua")
+	links.verify(Event{Source: SourceGitHub, GitHub: comment("vozgua", code).GitHub, Time: time.Now().Add(linkCodeTTL * 2)})
+	if login, _ := links.Login("300"); login != "" {
+		t.Errorf("linked with expired code")
+	}
+}
+
+func TestGitHubMentions(t *testing.T) {
+	cases := []struct {
+		kind    GitHubEventType
+		payload string
+		logins  []string
+	}{
+		{Issue, `{"action": "assigned", "sender": {"login": "savageking"}, "assignee": {"login": "vozgua"}}`, []string{"vozgua"}},
+		{Issue, `{"action": "opened", "sender": {"login": "savageking"}, "issue": {"body": "@vozgua and @octocat, see foo@example.com and @savageking"}}`, []string{"vozgua", "octocat"}},
+		{PullRequest, `{"action": "review_requested", "sender": {"login": "savageking"}, "requested_reviewer": {"login": "vozgua"}}`, []string{"vozgua"}},
+		{PullRequest, `{"action": "synchronize", "sender": {"login": "savageking"}, "pull_request": {"body": "@vozgua"}}`, []string{}},
+		{PullRequestComment, `{"action": "created", "sender": {"login": "savageking"}, "comment": {"body": "LGTM @vozgua"}}`, []string{"vozgua"}},
+	}
+	for _, c := range cases {
+		if logins := githubMentions(parseGitHubEvent(t, c.kind, c.payload)); !reflect.DeepEqual(logins, c.logins) {
+			t.Errorf("%s %s: mentions = %v, want %v", c.kind, c.payload, logins, c.logins)
+		}
+	}
+}
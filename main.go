@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"os"
@@ -22,14 +23,39 @@ func main() {
 	app.Description = "Manage your Indie Gamedev Community"
 	app.Copyright = "Copyright 2020 Mike Savage King"
 
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Aliases: []string{"c"},
+			Usage:   "Path to configuration file",
+			Value:   DefaultConfigFile,
+			EnvVars: []string{"EVELEVE_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    "log-level",
+			Usage:   "Log level: panic, fatal, error, warn, info, debug or trace",
+			Value:   "trace",
+			EnvVars: []string{"EVELEVE_LOG_LEVEL"},
+		},
+	}
+
+	app.Before = func(c *cli.Context) error {
+		level, err := log.ParseLevel(c.String("log-level"))
+		if err != nil {
+			return err
+		}
+		log.SetLevel(level)
+		return nil
+	}
+
 	app.Commands = []*cli.Command{
 		{
 			Name:  "master",
 			Usage: "Run EvelEve in Master mode",
 			Flags: []cli.Flag{},
 			Action: func(c *cli.Context) error {
-				log.SetLevel(log.TraceLevel)
 				var m Master
+				m.ConfigFile = c.String("config")
 				if err := m.Init(); err != nil {
 					log.Errorf("Failed to initialize master server: %s", err.Error())
 					return err
@@ -37,6 +63,102 @@ func main() {
 				return m.Run()
 			},
 		},
+		{
+			Name:  "validate",
+			Usage: "Check configuration file and exit",
+			Action: func(c *cli.Context) error {
+				// Only problems are interesting unless asked otherwise
+				if !c.IsSet("log-level") {
+					log.SetLevel(log.WarnLevel)
+				}
+				conf := new(Config)
+				if err := conf.InitStrict(c.String("config")); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				if err := conf.Validate(); err != nil {
+					if errs, ok := err.(ConfigErrors); ok {
+						for _, e := range errs {
+							fmt.Fprintln(os.Stderr, e)
+						}
+					}
+					return cli.Exit(fmt.Sprintf("%s is invalid", c.String("config")), 1)
+				}
+				fmt.Printf("%s is valid\n", c.String("config"))
+				return nil
+			},
+		},
+		{
+			Name:  "export",
+			Usage: "Write backup of the bot storage. The bot must be stopped",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "Backup file, standard output is used by default",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				storage, err := openStorage(c.String("config"))
+				if err != nil {
+					return err
+				}
+				defer storage.Close()
+
+				out := os.Stdout
+				if c.String("output") != "" {
+					out, err = os.Create(c.String("output"))
+					if err != nil {
+						return err
+					}
+					defer out.Close()
+				}
+				return storage.Export(out)
+			},
+		},
+		{
+			Name:      "import",
+			Usage:     "Load backup into the bot storage. The bot must be stopped",
+			ArgsUsage: "<backup file>",
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return cli.Exit("backup file is required", 1)
+				}
+				in, err := os.Open(c.Args().First())
+				if err != nil {
+					return err
+				}
+				defer in.Close()
+
+				storage, err := openStorage(c.String("config"))
+				if err != nil {
+					return err
+				}
+				defer storage.Close()
+				return storage.Import(in)
+			},
+		},
+		{
+			Name:  "default-config",
+			Usage: "Print annotated configuration template",
+			Action: func(c *cli.Context) error {
+				fmt.Print(DefaultConfig)
+				return nil
+			},
+		},
+	}
+	if err := app.Run(os.Args); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+}
+
+func openStorage(filename string) (Storage, error) {
+	conf := new(Config)
+	if err := conf.Init(filename); err != nil {
+		return nil, err
+	}
+	storage := new(BoltStorage)
+	if err := storage.Init(conf.Storage.Path); err != nil {
+		return nil, err
 	}
-	app.Run(os.Args)
+	return storage, nil
 }
@@ -1,63 +1,162 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// DefaultConfigFile is used when no other configuration file is specified
+const DefaultConfigFile = "/etc/eveleve/config.yaml"
+
 type Master struct {
+	ConfigFile    string
 	Config        *Config
+	Bus           *Bus
+	HTTP          *Server
 	GitHub        *GitHub
 	Travis        *Travis
 	Discord       *Discord
 	Status        *Status
-	Listener      *net.TCPListener
 	Notifications *Notification
-	Shutdown      bool
+	Storage       Storage
+	History       *History
+	Startup       *Startup
+	API           *API
+	Commands      *CommandRouter
+	Slash         *SlashCommands
+	Permissions   *Permissions
+	Board         *PullRequestBoard
+	Digests       *Digests
+	Links         *GitHubLinks
+	Deliveries    *Deliveries
+	GitHubAPI     *GitHubAPI
+
+	reloadMutex sync.Mutex
 }
 
 func (m *Master) Init() error {
 	log.Infof("Starting EvelEve in Master mode")
 	log.Infof("App version: %s", AppVersion)
 
-	if err := m.InitConfig(); err != nil {
-		m.Config = nil
-		log.Errorf("%s", err.Error())
+	if err := m.InitBus(); err != nil {
+		return err
 	}
 
-	if err := m.InitGitHub(); err != nil {
-		log.Errorf("%s", err.Error())
-	}
+	m.Startup = new(Startup)
+	m.Startup.Add(&Subsystem{Name: "config", Required: true, Init: m.InitConfig})
+	m.Startup.Add(&Subsystem{Name: "storage", Depends: []string{"config"}, Init: m.InitStorage})
+	m.Startup.Add(&Subsystem{Name: "deliveries", Depends: []string{"storage"}, Init: m.InitDeliveries})
+	m.Startup.Add(&Subsystem{Name: "history", Depends: []string{"storage"}, Init: m.InitHistory})
+	m.Startup.Add(&Subsystem{Name: "projects", Depends: []string{"storage"}, Init: m.InitProjects})
+	m.Startup.Add(&Subsystem{Name: "http", Depends: []string{"config"}, Init: m.InitHTTP})
+	m.Startup.Add(&Subsystem{Name: "github", Depends: []string{"http"}, Init: m.InitGitHub})
+	m.Startup.Add(&Subsystem{Name: "github_api", Depends: []string{"config"}, Init: m.InitGitHubAPI})
+	m.Startup.Add(&Subsystem{Name: "travis", Depends: []string{"http"}, Init: m.InitTravis})
+	m.Startup.Add(&Subsystem{Name: "discord", Required: true, Depends: []string{"config"}, Init: m.InitDiscord})
+	m.Startup.Add(&Subsystem{Name: "status", Depends: []string{"discord"}, Init: m.InitStatus})
+	m.Startup.Add(&Subsystem{Name: "links", Depends: []string{"discord", "storage"}, Init: m.InitLinks})
+	m.Startup.Add(&Subsystem{Name: "board", Depends: []string{"discord", "storage"}, Init: m.InitBoard})
+	m.Startup.Add(&Subsystem{Name: "notifications", Depends: []string{"discord"}, Init: m.InitNotifications})
+	m.Startup.Add(&Subsystem{Name: "digests", Depends: []string{"discord", "storage"}, Init: m.InitDigests})
+	m.Startup.Add(&Subsystem{Name: "commands", Depends: []string{"discord"}, Init: m.InitCommands})
+	m.Startup.Add(&Subsystem{Name: "slash", Depends: []string{"commands"}, Init: m.InitSlash})
+	m.Startup.Add(&Subsystem{Name: "api", Depends: []string{"config"}, Init: m.InitAPI})
 
-	if err := m.InitTravis(); err != nil {
-		log.Errorf("%s", err.Error())
+	err := m.Startup.Run()
+	summary := m.Startup.Summary()
+	log.Infof("%s", summary)
+	if m.Discord != nil {
+		m.Discord.sendLog("```\n" + summary + "\n```")
 	}
 
-	if err := m.InitDiscord(); err != nil {
-		log.Errorf("%s", err.Error())
+	if err != nil {
+		m.Shutdown()
+		return err
 	}
 
-	if err := m.InitNotifications(); err != nil {
-		log.Errorf("%s", err.Error())
+	if m.Discord != nil {
+		m.Discord.sendLog("EvelEve Bot Online")
 	}
+	return nil
+}
 
-	if err := m.InitAPI(); err != nil {
-		log.Errorf("%s", err.Error())
+func (m *Master) InitBus() error {
+	m.Bus = new(Bus)
+	if err := m.Bus.Init(); err != nil {
+		m.Bus = nil
+		return fmt.Errorf("Failed to initialize event bus: %s", err.Error())
 	}
-
 	return nil
-
 }
 
 func (m *Master) InitConfig() error {
+	if m.ConfigFile == "" {
+		m.ConfigFile = DefaultConfigFile
+	}
 	m.Config = new(Config)
-	if err := m.Config.Init("/etc/eveleve/config.yaml"); err != nil {
+	if err := m.Config.Init(m.ConfigFile); err != nil {
 		m.Config = nil
 		return fmt.Errorf("Failed to initialize configuration subsystem: %s", err.Error())
 	}
+	if err := m.Config.Validate(); err != nil {
+		m.Config = nil
+		return fmt.Errorf("Invalid configuration: %s", err.Error())
+	}
+	return nil
+}
+
+func (m *Master) InitStorage() error {
+	storage := new(BoltStorage)
+	if err := storage.Init(m.Config.Storage.Path); err != nil {
+		return fmt.Errorf("Failed to initialize storage: %s", err.Error())
+	}
+	m.Storage = storage
+	m.syncProjects(m.Config.Projects)
+	return nil
+}
+
+// InitDeliveries starts dropping duplicate webhook deliveries
+func (m *Master) InitDeliveries() error {
+	m.Deliveries = new(Deliveries)
+	if err := m.Deliveries.Init(m.Storage, m.Config.Storage.Deliveries); err != nil {
+		m.Deliveries = nil
+		return fmt.Errorf("Failed to initialize delivery tracking: %s", err.Error())
+	}
+	return nil
+}
+
+func (m *Master) InitHistory() error {
+	m.History = new(History)
+	if err := m.History.Init(m.Storage, m.Bus, m.Config.Storage.Retention); err != nil {
+		m.History = nil
+		return fmt.Errorf("Failed to initialize event history: %s", err.Error())
+	}
+	return nil
+}
+
+// InitProjects starts tracking state of every project
+func (m *Master) InitProjects() error {
+	for _, source := range []EventSource{SourceGitHub, SourceTravis} {
+		if _, err := m.Bus.Subscribe(source, "projects", 0, m.trackProject); err != nil {
+			return fmt.Errorf("Failed to subscribe to %s events: %s", source, err.Error())
+		}
+	}
+	return nil
+}
+
+func (m *Master) InitHTTP() error {
+	m.HTTP = new(Server)
+	if err := m.HTTP.Init(m.Config.HTTP, m.Config.TLS); err != nil {
+		m.HTTP = nil
+		return fmt.Errorf("Failed to initialize HTTP server: %s", err.Error())
+	}
 	return nil
 }
 
@@ -66,11 +165,22 @@ func (m *Master) InitGitHub() error {
 		return fmt.Errorf("Skipping GitHub initialization due to an empty configuration")
 	}
 	m.GitHub = new(GitHub)
-	if err := m.GitHub.Init(m.Config.GitHub, m.Config.TLS); err != nil {
+	m.GitHub.Deliveries = m.Deliveries
+	if err := m.GitHub.Init(m.Config.GitHub, m.HTTP, m.Bus); err != nil {
 		m.GitHub = nil
 		return fmt.Errorf("Failed to initialize GitHub subsystem: %s", err.Error())
 	}
-	m.GitHub.SetProjects(m.Config.Projects)
+	m.applyProjects(m.Config)
+	return nil
+}
+
+// InitGitHubAPI prepares client used by commands which act on GitHub
+func (m *Master) InitGitHubAPI() error {
+	m.GitHubAPI = new(GitHubAPI)
+	if err := m.GitHubAPI.Init(m.Config.GitHub.API); err != nil {
+		m.GitHubAPI = nil
+		return fmt.Errorf("Failed to initialize GitHub API client: %s", err.Error())
+	}
 	return nil
 }
 
@@ -79,7 +189,8 @@ func (m *Master) InitTravis() error {
 		return fmt.Errorf("Skipping Travis initialziation due to an empty configuration")
 	}
 	m.Travis = new(Travis)
-	if err := m.Travis.Init(&m.Config.Travis); err != nil {
+	m.Travis.Deliveries = m.Deliveries
+	if err := m.Travis.Init(&m.Config.Travis, m.HTTP, m.Bus); err != nil {
 		m.Travis = nil
 		return fmt.Errorf("Failed to initialize Travis subsystem: %s", err.Error())
 	}
@@ -91,25 +202,25 @@ func (m *Master) InitDiscord() error {
 		return fmt.Errorf("Skipping Discord initialization due to empty configuration")
 	}
 	m.Discord = new(Discord)
-	if err := m.Discord.Init(m.Config.Discord); err != nil {
+	if err := m.Discord.Init(m.Config.Discord, m.Bus); err != nil {
 		m.Discord = nil
-		return fmt.Errorf("%s", err.Error())
+		return fmt.Errorf("Failed to initialize Discord subsystem: %s", err.Error())
 	}
 
-	if m.Discord != nil {
-		m.Discord.sendLog("EvelEve Bot Online. All Systems Nominal")
-
-		if m.GitHub != nil {
-			m.GitHub.addNotificationSubsystem(m.Discord)
-		}
+	if m.GitHub != nil {
+		m.GitHub.addNotificationSubsystem(m.Discord)
 	}
 
+	return nil
+}
+
+func (m *Master) InitStatus() error {
 	log.Infof("Initializing Status Subsystem")
 	m.Status = new(Status)
-	if err := m.Status.Init(m.Discord); err != nil {
-		log.Errorf("Failed to initialize Status Subsystem: %s", err.Error())
+	if err := m.Status.Init(m.Discord, m.Bus, m.Storage); err != nil {
+		m.Status = nil
+		return fmt.Errorf("Failed to initialize Status Subsystem: %s", err.Error())
 	}
-
 	return nil
 }
 
@@ -118,55 +229,225 @@ func (m *Master) InitNotifications() error {
 		return fmt.Errorf("Skipping notifications initialziation: nil discord")
 	}
 	m.Notifications = new(Notification)
-	return m.Notifications.Init(m.Discord)
+	if err := m.Notifications.Init(m.Discord, m.Bus); err != nil {
+		m.Notifications = nil
+		return fmt.Errorf("Failed to initialize notifications: %s", err.Error())
+	}
+	if m.Config != nil {
+		m.Notifications.SetTemplates(m.Config.Notifications)
+		m.Notifications.SetRoutes(m.Config.Routes)
+		m.Notifications.SetPushWindow(m.Config.Push.Window)
+		m.Notifications.SetPushFilters(m.Config.Push.Filters)
+	}
+	if m.Board != nil {
+		m.Notifications.SetBoard(m.Board)
+	}
+	if m.Links != nil {
+		m.Notifications.SetLinks(m.Links)
+	}
+	return nil
+}
+
+// InitBoard starts tracking pull requests on the board
+func (m *Master) InitBoard() error {
+	m.Board = new(PullRequestBoard)
+	if err := m.Board.Init(m.Discord, m.Storage, m.Bus); err != nil {
+		m.Board = nil
+		return fmt.Errorf("Failed to initialize pull request board: %s", err.Error())
+	}
+	if m.Links != nil {
+		m.Board.SetLinks(m.Links)
+	}
+	return nil
+}
+
+// InitLinks starts confirming GitHub logins of Discord users
+func (m *Master) InitLinks() error {
+	m.Links = new(GitHubLinks)
+	if err := m.Links.Init(m.Discord, m.Storage, m.Bus); err != nil {
+		m.Links = nil
+		return fmt.Errorf("Failed to initialize GitHub links: %s", err.Error())
+	}
+	return nil
+}
+
+// InitDigests schedules digests of the event history
+func (m *Master) InitDigests() error {
+	m.Digests = new(Digests)
+	if err := m.Digests.Init(m.Discord, m.Storage); err != nil {
+		m.Digests = nil
+		return fmt.Errorf("Failed to initialize digests: %s", err.Error())
+	}
+	m.Digests.SetDigests(m.Config.Digests)
+	return nil
+}
+
+func (m *Master) InitCommands() error {
+	m.Permissions = new(Permissions)
+	if err := m.Permissions.Init(m.Config.Permissions, m.Discord); err != nil {
+		m.Permissions = nil
+		return fmt.Errorf("Failed to initialize permissions: %s", err.Error())
+	}
+	m.Commands = new(CommandRouter)
+	if err := m.Commands.Init(m.Discord, m.Bus, m.Permissions); err != nil {
+		m.Commands = nil
+		return fmt.Errorf("Failed to initialize commands: %s", err.Error())
+	}
+	for _, def := range m.commands() {
+		if err := m.Commands.Register(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Master) InitSlash() error {
+	m.Slash = new(SlashCommands)
+	if err := m.Slash.Init(m.Discord, m.Commands, m.Bus, m.Config.Discord.Guilds); err != nil {
+		m.Slash = nil
+		return fmt.Errorf("Failed to initialize slash commands: %s", err.Error())
+	}
+	return nil
 }
 
 func (m *Master) InitAPI() error {
+	if m.Config.API.Port == 0 {
+		log.Infof("Admin API is disabled")
+		return nil
+	}
+	m.API = new(API)
+	if err := m.API.Init(m.Config.API, m.Config.HTTP, m); err != nil {
+		m.API = nil
+		return fmt.Errorf("Failed to initialize admin API: %s", err.Error())
+	}
 	return nil
 }
 
 func (m *Master) Run() error {
+	if m.Status != nil {
+		log.Infof("Running Status Subsystem")
+		go m.Status.Run()
+	}
+	if m.HTTP != nil {
+		go m.HTTP.Run()
+	}
+	if m.API != nil {
+		go m.API.Run()
+	}
 
-	log.Infof("Running Status Subsystem")
-	go m.Status.Run()
-	go m.Travis.Run()
-
-	for {
-		if m.Discord == nil || m.GitHub == nil || m.Config == nil {
-			time.Sleep(time.Millisecond * 100)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		log.Infof("Received %s signal", sig)
+		if sig == syscall.SIGHUP {
+			m.reload()
 			continue
 		}
-		select {
-		case cmd := <-m.Discord.Commands:
-			log.Tracef("New Discord Command: %+v", cmd)
-			handleCommand(cmd)
-		case gevent := <-m.GitHub.Events:
-			log.Tracef("New GitHub Event: %+v", gevent)
-			m.Notifications.GitHub(&gevent)
-		case tevent := <-m.Travis.Events:
-			log.Tracef("New Travis Event: %+v", tevent)
-			m.Notifications.Travis(&tevent)
-		default:
-			time.Sleep(time.Millisecond * 100)
+		break
+	}
+	signal.Stop(signals)
+
+	return m.Shutdown()
+}
+
+// Shutdown stops webhook listeners, waits until events that are already
+// queued reach Discord and disconnects the bot. Every stage is limited
+// by a timeout from the shutdown configuration
+func (m *Master) Shutdown() error {
+	log.Infof("Shutting down EvelEve")
+	conf := new(Config)
+	conf.setDefaults()
+	if m.Config != nil {
+		conf = m.Config
+	}
+
+	var failed bool
+	stage := func(name string, timeout time.Duration, fn func(ctx context.Context) error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			log.Errorf("Shutdown stage '%s' failed: %s", name, err.Error())
+			failed = true
+		}
+	}
+
+	stage("webhooks", conf.Shutdown.HTTPTimeout, func(ctx context.Context) error {
+		if m.HTTP != nil {
+			return m.HTTP.Stop(ctx)
 		}
-		if m.Shutdown {
-			break
+		return nil
+	})
+
+	stage("api", conf.Shutdown.HTTPTimeout, func(ctx context.Context) error {
+		if m.API != nil {
+			return m.API.Stop(ctx)
 		}
+		return nil
+	})
+
+	if m.Status != nil {
+		m.Status.Stop()
+	}
+	if m.Digests != nil {
+		m.Digests.Stop()
 	}
 
-	return nil
-}
+	stage("drain", conf.Shutdown.DrainTimeout, m.Bus.Close)
 
-func handleCommand(command Command) error {
-	switch command.Cmd {
-	case "!projects":
+	if m.Notifications != nil {
+		m.Notifications.Flush()
+	}
 
+	stage("discord", conf.Shutdown.DiscordTimeout, func(ctx context.Context) error {
+		if m.Discord == nil {
+			return nil
+		}
+		done := make(chan error, 1)
+		go func() {
+			m.Discord.sendLog("EvelEve Bot going offline")
+			done <- m.Discord.Close()
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	if m.Storage != nil {
+		if err := m.Storage.Close(); err != nil {
+			log.Errorf("Failed to close storage: %s", err.Error())
+			failed = true
+		}
 	}
 
+	if failed {
+		return fmt.Errorf("shutdown was not clean")
+	}
+	log.Infof("EvelEve stopped")
 	return nil
 }
 
-func handleEvent(event GitHubEvent) error {
+// commands returns bot administration commands
+func (m *Master) commands() []*CommandDef {
+	commands := []*CommandDef{
+		m.projectCommands(),
+		m.routeCommands(),
+		m.digestCommands(),
+		m.linkCommands(),
+		{
+			Name:    "reload",
+			Usage:   "Reload configuration file",
+			Handler: m.commandReload,
+			Admin:   true,
+		},
+	}
+	return append(commands, m.githubCommands()...)
+}
 
+func (m *Master) commandReload(ctx *CommandContext) error {
+	// Result is posted to the log channel by reload
+	m.reload()
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/go-playground/webhooks.v5/github"
+	"sync"
+	"time"
 )
 
 type NotificationField struct {
@@ -13,8 +15,12 @@ type NotificationField struct {
 	Inline bool   `yaml:"inline"`
 }
 
+// NotificationConfig is an embed template of an event type. Every text
+// is a Go template executed with TemplateData, empty texts keep values
+// of the built-in embed
 type NotificationConfig struct {
 	Title       string              `yaml:"title"`
+	URL         string              `yaml:"url"`
 	Color       int                 `yaml:"color"`
 	Description string              `yaml:"description"`
 	Fields      []NotificationField `yaml:"fields"`
@@ -55,213 +61,263 @@ type NotificationConfig struct {
 
 // Notification subsystem
 type Notification struct {
-	discord *Discord
+	discord   *Discord
+	board     *PullRequestBoard
+	links     *GitHubLinks
+	mutex     sync.RWMutex
+	templates map[string]*notificationTemplate
+	routes    []RoutingRule
+	filters   []PushFilter
+	pushes    pushBatcher
 }
 
-func (n *Notification) Init(discord *Discord) error {
+func (n *Notification) Init(discord *Discord, bus *Bus) error {
 	log.Infof("Initializing Notification Subsystem")
 	if discord == nil {
 		return fmt.Errorf("nil discord")
 	}
+	if bus == nil {
+		return fmt.Errorf("nil bus")
+	}
 	n.discord = discord
+	n.pushes.flush = n.githubPushes
+
+	if _, err := bus.Subscribe(SourceGitHub, "notifications", 0, func(e Event) error {
+		log.Tracef("New GitHub Event: %+v", e.GitHub)
+		return n.GitHub(e.GitHub)
+	}); err != nil {
+		return err
+	}
+	if _, err := bus.Subscribe(SourceTravis, "notifications", 0, func(e Event) error {
+		log.Tracef("New Travis Event: %+v", e.Travis)
+		return n.Travis(e.Travis)
+	}); err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func (n *Notification) Travis(packet *TravisPacket) error {
-	if packet == nil {
-		return fmt.Errorf("nil travis packet")
+// SetTemplates replaces embed templates configured per event type.
+// Templates which fail to compile are skipped, configuration validation
+// reports them before they get here
+func (n *Notification) SetTemplates(templates map[string]NotificationConfig) {
+	compiled := make(map[string]*notificationTemplate)
+	for key, conf := range templates {
+		t, err := compileTemplate(key, conf)
+		if err != nil {
+			log.Errorf("Failed to compile notification template %s: %s", key, err.Error())
+			continue
+		}
+		compiled[key] = t
 	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.templates = compiled
+}
 
-	log.Debugf("Handling travis notification")
-	msg := new(discordgo.MessageEmbed)
+// SetRoutes replaces rules which choose channels for notifications
+func (n *Notification) SetRoutes(routes []RoutingRule) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.routes = routes
+}
 
-	log.Tracef("Travis Packet Status: %d", packet.Status)
-	log.Tracef("Travis Packet State: %s", packet.State)
-	log.Tracef("Travis Packet Status Message: %s", packet.StatusMessage)
-	msg.Title = "Travis CI: " + packet.StatusMessage
-	if packet.Status == 1 {
-		msg.Color = 0xff0900
-	} else {
-		if packet.State == "started" {
-			msg.Color = 0xedfd00
+// notify applies template of the event type to the built-in embed and
+// posts result into every channel routed for the event record. Mentions
+// are sent as message text
+func (n *Notification) notify(record *EventRecord, payload interface{}, msg *discordgo.MessageEmbed, mentions string) error {
+	n.mutex.RLock()
+	t := findTemplate(n.templates, record)
+	channels := routeChannels(n.routes, record, n.discord.eventChannel())
+	n.mutex.RUnlock()
+
+	if t != nil {
+		rendered, err := t.render(TemplateData{Event: record, Payload: payload, Default: msg})
+		if err != nil {
+			log.Warnf("Failed to render %s template, using built-in embed: %s", t.key, err.Error())
 		} else {
-			msg.Color = 0x009b3a
+			msg = rendered
 		}
 	}
 
-	msg.Author = &discordgo.MessageEmbedAuthor{
-		URL:     packet.BuildURL,
-		Name:    packet.AuthorName,
-		IconURL: "https://travis-ci.com/images/logos/TravisCI-Mascot-blue.png",
+	var result error
+	for _, channel := range channels {
+		var err error
+		if mentions != "" {
+			_, err = n.discord.sendComplex(channel, mentions, msg)
+		} else {
+			_, err = n.discord.sendEmbed(channel, msg)
+		}
+		if err != nil {
+			log.Errorf("Failed to send notification to %s: %s", channel, err.Error())
+			result = err
+		}
 	}
+	return result
+}
 
-	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
-		Name:  "Started By",
-		Value: packet.Type,
-	})
-	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
-		Name:  "Message",
-		Value: packet.Message,
-	})
-	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
-		Name:  "Repository",
-		Value: packet.Repository.OwnerName + "/" + packet.Repository.Name,
-	})
-	if packet.Repository.URL != "" {
-		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
-			Name:  "Repository URL",
-			Value: packet.Repository.URL,
-		})
-	}
+// SetPushWindow changes how long pushes to the same branch are collected
+// into a single notification. Zero window sends every push separately
+func (n *Notification) SetPushWindow(window time.Duration) {
+	n.pushes.SetWindow(window)
+}
 
-	_, err := n.discord.sendEmbed(n.discord.EventChannel, msg)
-	if err != nil {
-		log.Errorf("Failed to send Travis Notification: %s", err.Error())
-		return err
-	}
-	return nil
+// SetPushFilters replaces filters of push notifications
+func (n *Notification) SetPushFilters(filters []PushFilter) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.filters = filters
 }
 
-func (n *Notification) GitHub(e *GitHubEvent) error {
-	switch e.event {
-	case CommitComment:
-		return n.githubCommitComment(e)
-	case Push:
-		return n.githubPush(e)
-	case Fork:
-	case Issue:
-		return n.githubIssue(e)
-	}
+// Flush sends pushes which are waiting for the end of their window
+func (n *Notification) Flush() {
+	n.pushes.Flush()
+}
 
-	return nil
+// SetLinks makes notifications mention Discord users linked to GitHub
+// logins
+func (n *Notification) SetLinks(links *GitHubLinks) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.links = links
 }
 
-func (n *Notification) githubCommitComment(e *GitHubEvent) error {
-	return nil
+// SetBoard passes pull request events to the board instead of posting
+// them into the event channel
+func (n *Notification) SetBoard(board *PullRequestBoard) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.board = board
 }
 
-func (n *Notification) ParseGitHub(e *GitHubEvent) error {
-	switch e.event {
-	case Issue:
+func (n *Notification) Travis(packet *TravisPacket) error {
+	if packet == nil {
+		return fmt.Errorf("nil travis packet")
 	}
 
+	log.Debugf("Handling travis notification")
+	if err := n.notify(packet.Record(), packet, travisEmbed(packet), ""); err != nil {
+		return fmt.Errorf("Failed to send Travis notification: %s", err.Error())
+	}
 	return nil
 }
 
-func (n *Notification) parseIssue(p *github.IssuesPayload) (map[string]string, error) {
-	if p == nil {
-		return nil, fmt.Errorf("nil issue")
+func (n *Notification) GitHub(e *GitHubEvent) error {
+	if e == nil {
+		return fmt.Errorf("nil github event")
 	}
-	data := make(map[string]string)
-
-	data["{issue.action}"] = p.Action
-	data["{issue.assignees}"] = ""
-	for _, assignee := range p.Issue.Assignees {
-		data["{issue.assignees}"] += assignee.Login + " "
+	n.mutex.RLock()
+	board := n.board
+	links := n.links
+	filters := n.filters
+	n.mutex.RUnlock()
+	if board != nil && board.Handles(e.event) {
+		return nil
 	}
-	data["{issue.labels}"] = ""
-	for _, label := range p.Issue.Labels {
-		data["{issue.labels}"] += label.Name + " "
+	if e.event == Push {
+		// Other subscribers get the same event, filtered push is a copy
+		push := filterPush(filters, &e.push)
+		if push == nil {
+			log.Debugf("Push to %s of %s is filtered out", e.push.Ref, e.push.Repository.FullName)
+			return nil
+		}
+		filtered := *e
+		filtered.push = *push
+		e = &filtered
+		if !n.pushes.add(e) {
+			n.githubPushes([]*GitHubEvent{e})
+		}
+		return nil
 	}
-	data["{issue.milestone.title}"] = p.Issue.Milestone.Title
-	data["{issue.milestone.number}"] = fmt.Sprintf("%d", p.Issue.Milestone.Number)
-	data["{issue.author.name}"] = p.Issue.User.Login
-	data["{issue.author.icon}"] = p.Issue.User.AvatarURL
-	data["{issue.author.url}"] = p.Issue.User.URL
-
-	return data, nil
-}
-
-func (n *Notification) githubIssue(e *GitHubEvent) error {
-	msg := new(discordgo.MessageEmbed)
-	msg.Color = 0x2b1c39
 
-	switch e.commitComment.Action {
-	case "opened":
-		msg.Title = fmt.Sprintf("New Issue %d has been created", e.issue.Issue.Number)
-	case "edited":
-		msg.Title = fmt.Sprintf("Issue %d has been updated", e.issue.Issue.Number)
-	case "deleted":
-		msg.Title = fmt.Sprintf("Issue %d has been deleted", e.issue.Issue.Number)
-	case "closed":
-		msg.Title = fmt.Sprintf("Issue %d has been closed", e.issue.Issue.Number)
-	default:
+	msg, err := githubEmbed(e)
+	if err == ErrUnsupportedEvent {
+		log.Infof("GitHub %s event with action '%s' is not supported, notification skipped", e.event, e.Record().Action)
 		return nil
 	}
-
-	msg.Description = e.commitComment.Action + "**" + e.issue.Issue.Title + "**\n"
-	body := e.issue.Issue.Body
-	if len(body) > 365 {
-		body = body[:365] + "..."
+	if err != nil {
+		return err
 	}
-	msg.Description += body
-
-	labels := ""
-
-	for _, label := range e.issue.Issue.Labels {
-		labels += label.Name + " "
+	mentions := ""
+	if links != nil {
+		mentions = links.Mentions(githubMentions(e))
 	}
-	if labels != "" {
-		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
-			Name:  "Labels",
-			Value: labels,
-		})
+	if err := n.notify(e.Record(), e.Payload(), msg, mentions); err != nil {
+		return fmt.Errorf("Failed to send GitHub %s notification: %s", e.event, err.Error())
 	}
+	return nil
+}
 
-	assignees := ""
-	for _, assignee := range e.issue.Issue.Assignees {
-		assignees += assignee.Login + " "
+// githubPushes sends a single notification about one or more pushes to
+// the same branch. Templates get the last push as payload
+func (n *Notification) githubPushes(events []*GitHubEvent) {
+	payloads := []*github.PushPayload{}
+	record := events[len(events)-1].Record()
+	record.Commits = 0
+	record.Authors = nil
+	for _, e := range events {
+		payloads = append(payloads, &e.push)
+		r := e.Record()
+		record.Commits += r.Commits
+		for _, author := range r.Authors {
+			if !containsString(record.Authors, author) {
+				record.Authors = append(record.Authors, author)
+			}
+		}
 	}
-	if assignees != "" {
-		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
-			Name:  "Assignees",
-			Value: assignees,
-		})
+
+	msg, err := pushEmbed(payloads)
+	if err == ErrUnsupportedEvent {
+		log.Infof("Pushes to %s have no new commits, notification skipped", record.Branch)
+		return
 	}
-	if e.issue.Issue.Milestone != nil {
-		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
-			Name:  "Milestone",
-			Value: e.issue.Issue.Milestone.Title,
-		})
+	if err != nil {
+		log.Errorf("Failed to render pushes to %s: %s", record.Branch, err.Error())
+		return
 	}
-	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
-		Name:  "State",
-		Value: e.issue.Issue.State,
-	})
-
-	msg.Author = &discordgo.MessageEmbedAuthor{
-		Name:    e.issue.Issue.User.Login,
-		IconURL: e.issue.Issue.User.AvatarURL,
-		URL:     e.issue.Issue.User.URL,
+	if err := n.notify(record, events[len(events)-1].Payload(), msg, ""); err != nil {
+		log.Errorf("Failed to send GitHub push notification: %s", err.Error())
 	}
-
-	n.discord.sendEmbed(n.discord.EventChannel, msg)
-
-	return nil
 }
 
-func (n *Notification) githubPush(e *GitHubEvent) error {
+// travisEmbed describes Travis CI build
+func travisEmbed(packet *TravisPacket) *discordgo.MessageEmbed {
 	msg := new(discordgo.MessageEmbed)
-	msg.Color = 0x2b1c39
-	msg.Title = e.push.Sender.Login + " sent new commits to " + e.push.Repository.FullName
+	msg.Title = "Travis CI: " + packet.StatusMessage
+	if packet.Status == 1 {
+		msg.Color = 0xff0900
+	} else {
+		if packet.State == "started" {
+			msg.Color = 0xedfd00
+		} else {
+			msg.Color = 0x009b3a
+		}
+	}
+
 	msg.Author = &discordgo.MessageEmbedAuthor{
-		URL:     e.push.Sender.HTMLURL,
-		Name:    e.push.Sender.Login,
-		IconURL: e.push.Sender.AvatarURL,
+		URL:     packet.BuildURL,
+		Name:    packet.AuthorName,
+		IconURL: "https://travis-ci.com/images/logos/TravisCI-Mascot-blue.png",
 	}
-	for _, c := range e.push.Commits {
+
+	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+		Name:  "Started By",
+		Value: packet.Type,
+	})
+	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+		Name:  "Message",
+		Value: packet.Message,
+	})
+	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+		Name:  "Repository",
+		Value: packet.Repository.OwnerName + "/" + packet.Repository.Name,
+	})
+	if packet.Repository.URL != "" {
 		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
-			Name:  c.Message,
-			Value: c.ID + " by " + c.Committer.Username,
+			Name:  "Repository URL",
+			Value: packet.Repository.URL,
 		})
 	}
-	msg.Provider = &discordgo.MessageEmbedProvider{
-		URL:  "https://github.com",
-		Name: "GitHub",
-	}
-
-	n.discord.sendEmbed(n.discord.EventChannel, msg)
-
-	return nil
+	return msg
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxPushWindows limits how long a busy branch delays its notification,
+// in windows since the first push of a batch
+const maxPushWindows = 5
+
+// pushBatcher merges pushes to the same branch until the branch is quiet
+// for a window, so a busy branch produces a single notification
+type pushBatcher struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	batches map[string]*pushBatch
+	// flush receives pushes of a batch in the order they came
+	flush func(events []*GitHubEvent)
+}
+
+type pushBatch struct {
+	events  []*GitHubEvent
+	timer   *time.Timer
+	started time.Time
+}
+
+// SetWindow changes batching window. Zero window disables batching,
+// batches which are already collected are sent when their window ends
+func (b *pushBatcher) SetWindow(window time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.window = window
+}
+
+// add puts push into a batch of its branch. False is returned when
+// batching is disabled and push should be sent right away
+func (b *pushBatcher) add(e *GitHubEvent) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.window <= 0 {
+		return false
+	}
+	if b.batches == nil {
+		b.batches = make(map[string]*pushBatch)
+	}
+
+	key := e.push.Repository.FullName + "/" + e.push.Ref
+	batch, ok := b.batches[key]
+	if !ok {
+		batch = &pushBatch{started: time.Now()}
+		batch.timer = time.AfterFunc(b.window, func() { b.send(key) })
+		b.batches[key] = batch
+	} else if batch.timer.Stop() {
+		// Stopped timer means the batch is being sent with this push
+		batch.timer.Reset(batch.delay(b.window, time.Now()))
+	}
+	batch.events = append(batch.events, e)
+	return true
+}
+
+// delay returns how long batch waits for more pushes after a push made
+// at now. Every push restarts the window, but not beyond the limit
+func (p *pushBatch) delay(window time.Duration, now time.Time) time.Duration {
+	delay := window
+	if left := p.started.Add(window * maxPushWindows).Sub(now); left < delay {
+		delay = left
+	}
+	return delay
+}
+
+func (b *pushBatcher) send(key string) {
+	b.mutex.Lock()
+	batch, ok := b.batches[key]
+	delete(b.batches, key)
+	b.mutex.Unlock()
+
+	if ok && len(batch.events) > 0 {
+		b.flush(batch.events)
+	}
+}
+
+// Flush sends every collected batch without waiting for its window
+func (b *pushBatcher) Flush() {
+	b.mutex.Lock()
+	batches := b.batches
+	b.batches = nil
+	b.mutex.Unlock()
+
+	for _, batch := range batches {
+		batch.timer.Stop()
+		b.flush(batch.events)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPushBatcher(t *testing.T) {
+	push := func(repo, ref string) *GitHubEvent {
+		e := &GitHubEvent{event: Push}
+		e.push.Repository.FullName = repo
+		e.push.Ref = ref
+		return e
+	}
+
+	sent := make(chan []*GitHubEvent, 4)
+	b := pushBatcher{flush: func(events []*GitHubEvent) { sent <- events }}
+	if b.add(push("owner/repo", "refs/heads/master")) {
+		t.Fatalf("push batched with zero window")
+	}
+
+	// Window never ends during the test, batches are flushed
+	b.SetWindow(time.Hour)
+	for _, e := range []*GitHubEvent{
+		push("owner/repo", "refs/heads/master"),
+		push("owner/repo", "refs/heads/master"),
+		push("owner/repo", "refs/heads/develop"),
+	} {
+		if !b.add(e) {
+			t.Fatalf("push not batched")
+		}
+	}
+	select {
+	case <-sent:
+		t.Fatalf("batch sent before its window ended")
+	default:
+	}
+	b.Flush()
+	sizes := map[string]int{}
+	for i := 0; i < 2; i++ {
+		select {
+		case events := <-sent:
+			sizes[events[0].push.Ref] = len(events)
+		default:
+			t.Fatalf("batch not flushed")
+		}
+	}
+	if sizes["refs/heads/master"] != 2 || sizes["refs/heads/develop"] != 1 {
+		t.Errorf("batches = %v", sizes)
+	}
+
+	b.SetWindow(time.Millisecond)
+	b.add(push("owner/repo", "refs/heads/master"))
+	select {
+	case events := <-sent:
+		if len(events) != 1 {
+			t.Errorf("sent %d pushes, want 1", len(events))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("batch not sent when its window ended")
+	}
+}
+
+func TestPushBatch_Delay(t *testing.T) {
+	started := time.Date(2020, 5, 11, 21, 0, 0, 0, time.UTC)
+	batch := &pushBatch{started: started}
+	tests := []struct {
+		since time.Duration
+		want  time.Duration
+	}{
+		{0, time.Minute},
+		{3 * time.Minute, time.Minute},
+		{4*time.Minute + 30*time.Second, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if delay := batch.delay(time.Minute, started.Add(tt.since)); delay != tt.want {
+			t.Errorf("push %s after the first one: delay = %s, want %s", tt.since, delay, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+
+	"gopkg.in/go-playground/webhooks.v5/github"
+)
+
+// appliesTo reports whether filter is used for pushes of the project
+func (f *PushFilter) appliesTo(project string) bool {
+	return len(f.Projects) == 0 || matchAny(f.Projects, project) || matchAny(f.Projects, "github.com/"+project)
+}
+
+// acceptsBranch reports whether pushes to the branch are announced
+func (f *PushFilter) acceptsBranch(branch string) bool {
+	if len(f.Branches) > 0 && !matchAny(f.Branches, branch) {
+		return false
+	}
+	return !matchAny(f.IgnoreBranches, branch)
+}
+
+// acceptsCommit reports whether commit is announced. Commits without
+// file lists are not filtered by paths
+func (f *PushFilter) acceptsCommit(authors []string, message string, files []string) bool {
+	for _, author := range authors {
+		if author != "" && containsString(f.IgnoreAuthors, author) {
+			return false
+		}
+	}
+	for _, marker := range f.SkipMarkers {
+		if strings.Contains(message, marker) {
+			return false
+		}
+	}
+	if len(files) == 0 {
+		return true
+	}
+	if len(f.Paths) > 0 {
+		found := false
+		for _, file := range files {
+			if matchAny(f.Paths, file) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.IgnorePaths) > 0 {
+		for _, file := range files {
+			if !matchAny(f.IgnorePaths, file) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// filterPush returns copy of the push with commits passing every filter
+// of its project. Nil is returned when push must not be announced
+func filterPush(filters []PushFilter, p *github.PushPayload) *github.PushPayload {
+	result := *p
+	branch := strings.TrimPrefix(p.Ref, "refs/heads/")
+	for i := range filters {
+		f := &filters[i]
+		if !f.appliesTo(p.Repository.FullName) {
+			continue
+		}
+		if !f.acceptsBranch(branch) || containsString(f.IgnoreAuthors, p.Sender.Login) {
+			return nil
+		}
+		// Pushes creating or removing a branch have no commits
+		if len(result.Commits) == 0 {
+			continue
+		}
+
+		commits := result.Commits[:0:0]
+		for _, c := range result.Commits {
+			authors := []string{c.Author.Username, c.Author.Name, c.Author.Email}
+			files := append(append(append([]string{}, c.Added...), c.Modified...), c.Removed...)
+			if f.acceptsCommit(authors, c.Message, files) {
+				commits = append(commits, c)
+			}
+		}
+		if len(commits) == 0 {
+			return nil
+		}
+		result.Commits = commits
+	}
+	return &result
+}
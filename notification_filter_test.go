@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/go-playground/webhooks.v5/github"
+)
+
+func TestFilterPush(t *testing.T) {
+	payload := `{
+		"ref": "refs/heads/master",
+		"repository": {"full_name": "savageking-io/eveleve"},
+		"sender": {"login": "savageking"},
+		"commits": [
+			{"id": "1", "message": "Add digests", "author": {"username": "savageking"}, "added": ["digest.go"], "modified": ["README.md"]},
+			{"id": "2", "message": "Bump lodash", "author": {"username": "dependabot[bot]"}, "modified": ["package.json"]},
+			{"id": "3", "message": "Fix typo [skip discord]", "author": {"username": "savageking"}, "modified": ["master.go"]},
+			{"id": "4", "message": "Update CI", "author": {"username": "savageking"}, "modified": [".travis.yml", ".github/workflows/ci.yml"]}
+		]
+	}`
+	push := new(github.PushPayload)
+	if err := json.Unmarshal([]byte(payload), push); err != nil {
+		t.Fatalf("Failed to parse push payload: %s", err.Error())
+	}
+
+	filter := PushFilter{
+		Projects:       []string{"savageking-io/*"},
+		IgnoreBranches: []string{"wip/*"},
+		IgnoreAuthors:  []string{"dependabot[bot]"},
+		SkipMarkers:    []string{"[skip discord]"},
+		IgnorePaths:    []string{".travis.yml", ".github/**"},
+	}
+
+	result := filterPush([]PushFilter{filter}, push)
+	if result == nil {
+		t.Fatalf("push filtered out")
+	}
+	if len(result.Commits) != 1 || result.Commits[0].ID != "1" {
+		t.Errorf("commits = %+v, want only 1", result.Commits)
+	}
+	if len(push.Commits) != 4 {
+		t.Errorf("original push changed")
+	}
+
+	if result := filterPush([]PushFilter{{Projects: []string{"other/*"}, IgnoreAuthors: []string{"savageking"}}}, push); result == nil || len(result.Commits) != 4 {
+		t.Errorf("filter of another project applied")
+	}
+	if filterPush([]PushFilter{{Paths: []string{"**/*.go"}, SkipMarkers: []string{"digests"}}}, push) == nil {
+		t.Errorf("push with matching commit filtered out")
+	}
+	if filterPush([]PushFilter{{Paths: []string{"docs/**"}}}, push) != nil {
+		t.Errorf("push without matching paths announced")
+	}
+	if filterPush([]PushFilter{{Branches: []string{"release/*"}}}, push) != nil {
+		t.Errorf("push to not listed branch announced")
+	}
+	if filterPush([]PushFilter{{IgnoreAuthors: []string{"savageking"}}}, push) != nil {
+		t.Errorf("push of ignored sender announced")
+	}
+
+	push.Ref = "refs/heads/wip/digests"
+	if filterPush([]PushFilter{filter}, push) != nil {
+		t.Errorf("push to ignored branch announced")
+	}
+}
@@ -0,0 +1,684 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"gopkg.in/go-playground/webhooks.v5/github"
+)
+
+// ErrUnsupportedEvent is returned when GitHub event or its action is not
+// rendered into a notification
+var ErrUnsupportedEvent = fmt.Errorf("unsupported event")
+
+const (
+	colorGitHub  = 0x2b1c39
+	colorOpened  = 0x2cbe4e
+	colorClosed  = 0xcb2431
+	colorMerged  = 0x6f42c1
+	colorComment = 0x0366d6
+	colorWarning = 0xdbab09
+	colorDraft   = 0x959da5
+
+	// maxEmbedText keeps descriptions well below Discord embed limits
+	maxEmbedText = 1000
+	// maxEmbedField is the length limit of an embed field value
+	maxEmbedField = 1024
+	// maxEmbedFieldName is the length limit of an embed field name
+	maxEmbedFieldName = 256
+	// maxEmbedTitle is the length limit of an embed title
+	maxEmbedTitle = 256
+	// maxEmbedFields is the amount of fields allowed in an embed
+	maxEmbedFields = 25
+	// maxEmbedLength limits total length of all texts of an embed
+	maxEmbedLength = 6000
+)
+
+// issueActions lists issue actions which are posted, with title verb
+// and colour of each
+var issueActions = map[string]struct {
+	verb  string
+	color int
+}{
+	"opened":      {"opened", colorOpened},
+	"edited":      {"edited", 0x0366d6},
+	"closed":      {"closed", colorClosed},
+	"reopened":    {"reopened", 0x85e89d},
+	"labeled":     {"labeled", 0xfbca04},
+	"assigned":    {"assigned", 0x6f42c1},
+	"milestoned":  {"added to milestone", 0x1d76db},
+	"transferred": {"transferred", 0x959da5},
+	"pinned":      {"pinned", 0xf9826c},
+}
+
+// githubEmbed renders GitHub event into a Discord embed
+func githubEmbed(e *GitHubEvent) (*discordgo.MessageEmbed, error) {
+	switch e.event {
+	case Push:
+		return pushEmbed([]*github.PushPayload{&e.push})
+	case CommitComment:
+		return commitCommentEmbed(&e.commitComment)
+	case Fork:
+		return forkEmbed(&e.fork)
+	case Issue:
+		return issueEmbed(&e.issue)
+	case IssueComment:
+		return issueCommentEmbed(&e.issueComment)
+	case Milestone:
+		return milestoneEmbed(&e.milestone)
+	case PullRequest:
+		return pullRequestEmbed(&e.pullRequest)
+	case PullRequestReview:
+		return pullRequestReviewEmbed(&e.pullRequestReview)
+	case PullRequestComment:
+		return pullRequestCommentEmbed(&e.pullRequestComment)
+	case Release:
+		return releaseEmbed(&e.release)
+	case Vulnerability:
+		return vulnerabilityEmbed(&e.vulnerability)
+	case Security:
+		return securityAdvisoryEmbed(&e.security)
+	}
+	return nil, ErrUnsupportedEvent
+}
+
+// pushEmbed summarizes one or more pushes to the same branch. Commits
+// which don't fit into embed limits are replaced with a link to the
+// comparison of the first and the last push
+func pushEmbed(pushes []*github.PushPayload) (*discordgo.MessageEmbed, error) {
+	if len(pushes) == 0 {
+		return nil, ErrUnsupportedEvent
+	}
+	first, last := pushes[0], pushes[len(pushes)-1]
+	branch := strings.TrimPrefix(last.Ref, "refs/heads/")
+	kind := "branch"
+	if strings.HasPrefix(last.Ref, "refs/tags/") {
+		branch, kind = strings.TrimPrefix(last.Ref, "refs/tags/"), "tag"
+	}
+
+	type commit struct {
+		name, value string
+	}
+	commits := []commit{}
+	forced, created := false, false
+	senders := []string{}
+	for _, p := range pushes {
+		forced = forced || p.Forced
+		created = created || p.Created
+		if !containsString(senders, p.Sender.Login) {
+			senders = append(senders, p.Sender.Login)
+		}
+		for _, c := range p.Commits {
+			author := c.Author.Username
+			if author == "" {
+				author = c.Author.Name
+			}
+			// Discord rejects embeds with empty field names
+			name := firstLine(c.Message)
+			if name == "" {
+				name = shortSHA(c.ID)
+			}
+			commits = append(commits, commit{
+				name:  truncateText(name, maxEmbedFieldName),
+				value: fmt.Sprintf("[`%s`](%s) by %s", shortSHA(c.ID), c.URL, author),
+			})
+		}
+	}
+
+	treeURL := fmt.Sprintf("%s/tree/%s", last.Repository.HTMLURL, branch)
+	verb := "pushed"
+	if forced {
+		verb = "force-pushed"
+	}
+	noun := "commits"
+	if len(commits) == 1 {
+		noun = "commit"
+	}
+	title := fmt.Sprintf("%s %s %d %s to %s of %s", strings.Join(senders, ", "), verb,
+		len(commits), noun, branch, last.Repository.FullName)
+	url := last.Compare
+	switch {
+	case last.Deleted:
+		title = fmt.Sprintf("%s deleted %s %s of %s", strings.Join(senders, ", "), kind, branch, last.Repository.FullName)
+		url = last.Repository.HTMLURL
+		commits = nil
+	case len(commits) == 0 && created:
+		title = fmt.Sprintf("%s created %s %s of %s", strings.Join(senders, ", "), kind, branch, last.Repository.FullName)
+		url = treeURL
+	case len(commits) == 0:
+		// Nothing new was pushed
+		return nil, ErrUnsupportedEvent
+	}
+	msg := &discordgo.MessageEmbed{
+		Title: truncateText(title, maxEmbedTitle),
+		URL:   url,
+		Color: colorGitHub,
+		Author: &discordgo.MessageEmbedAuthor{
+			URL:     last.Sender.HTMLURL,
+			Name:    last.Sender.Login,
+			IconURL: last.Sender.AvatarURL,
+		},
+		Provider: &discordgo.MessageEmbedProvider{
+			URL:  "https://github.com",
+			Name: "GitHub",
+		},
+	}
+	if len(pushes) > 1 {
+		if len(commits) > 0 {
+			msg.URL = fmt.Sprintf("%s/compare/%s...%s", last.Repository.HTMLURL, shortSHA(first.Before), shortSHA(last.After))
+			// Branch created by the first push has nothing to compare with
+			if strings.Trim(first.Before, "0") == "" {
+				msg.URL = treeURL
+			}
+		}
+		msg.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d pushes", len(pushes))}
+	}
+	if forced {
+		msg.Color = colorWarning
+	}
+
+	// Room for the "and N more commits" field
+	more := &discordgo.MessageEmbedField{Name: "…", Value: fmt.Sprintf("[and %d more commits](%s)", len(commits), msg.URL)}
+	reserve := len(more.Name) + len(more.Value) + 10
+	length := embedLength(msg)
+	for i, c := range commits {
+		fits := length+len(c.name)+len(c.value) <= maxEmbedLength
+		if i < len(commits)-1 {
+			fits = fits && len(msg.Fields) < maxEmbedFields-1 &&
+				length+len(c.name)+len(c.value)+reserve <= maxEmbedLength
+		}
+		if !fits {
+			more.Value = fmt.Sprintf("[and %d more commits](%s)", len(commits)-i, msg.URL)
+			msg.Fields = append(msg.Fields, more)
+			break
+		}
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: c.name, Value: c.value})
+		length += len(c.name) + len(c.value)
+	}
+	return msg, nil
+}
+
+// embedLength counts characters limited by Discord in a single embed
+func embedLength(msg *discordgo.MessageEmbed) int {
+	length := len(msg.Title) + len(msg.Description)
+	for _, field := range msg.Fields {
+		length += len(field.Name) + len(field.Value)
+	}
+	if msg.Footer != nil {
+		length += len(msg.Footer.Text)
+	}
+	if msg.Author != nil {
+		length += len(msg.Author.Name)
+	}
+	return length
+}
+
+func commitCommentEmbed(p *github.CommitCommentPayload) (*discordgo.MessageEmbed, error) {
+	if p.Action != "" && p.Action != "created" {
+		return nil, ErrUnsupportedEvent
+	}
+	msg := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("New comment on commit %s in %s", shortSHA(p.Comment.CommitID), p.Repository.FullName),
+		URL:         p.Comment.HTMLURL,
+		Color:       colorComment,
+		Description: truncateText(p.Comment.Body, maxEmbedText),
+		Author:      githubAuthor(p.Comment.User.Login, p.Comment.User.AvatarURL, p.Comment.User.HTMLURL),
+	}
+	if p.Comment.Path != nil && *p.Comment.Path != "" {
+		file := *p.Comment.Path
+		if p.Comment.Line != nil {
+			file += ":" + strconv.FormatInt(*p.Comment.Line, 10)
+		}
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "File", Value: "`" + file + "`"})
+	}
+	return msg, nil
+}
+
+func forkEmbed(p *github.ForkPayload) (*discordgo.MessageEmbed, error) {
+	return &discordgo.MessageEmbed{
+		Title:  fmt.Sprintf("%s forked %s", p.Sender.Login, p.Repository.FullName),
+		URL:    p.Forkee.HTMLURL,
+		Color:  colorGitHub,
+		Author: githubAuthor(p.Sender.Login, p.Sender.AvatarURL, p.Sender.HTMLURL),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Fork", Value: p.Forkee.FullName, Inline: true},
+			{Name: "Forks", Value: strconv.FormatInt(p.Repository.ForksCount, 10), Inline: true},
+		},
+	}, nil
+}
+
+func issueEmbed(p *github.IssuesPayload) (*discordgo.MessageEmbed, error) {
+	action, ok := issueActions[p.Action]
+	if !ok {
+		return nil, ErrUnsupportedEvent
+	}
+	issue := &p.Issue
+	msg := &discordgo.MessageEmbed{
+		Title:  truncateText(fmt.Sprintf("Issue #%d %s in %s: %s", issue.Number, action.verb, p.Repository.FullName, issue.Title), maxEmbedTitle),
+		URL:    issue.HTMLURL,
+		Color:  action.color,
+		Author: githubAuthor(p.Sender.Login, p.Sender.AvatarURL, p.Sender.HTMLURL),
+	}
+
+	switch p.Action {
+	case "opened":
+		msg.Description = truncateText(issue.Body, maxEmbedText)
+	case "edited":
+		if p.Changes != nil && p.Changes.Title != nil {
+			msg.Description = fmt.Sprintf("Title changed from **%s**", p.Changes.Title.From)
+		} else if p.Changes != nil && p.Changes.Body != nil {
+			msg.Description = truncateText(issue.Body, maxEmbedText)
+		}
+	case "labeled":
+		if p.Label != nil {
+			msg.Description = fmt.Sprintf("Label **%s** added", p.Label.Name)
+		}
+	case "assigned":
+		if p.Assignee != nil {
+			msg.Description = fmt.Sprintf("Assigned to **%s**", p.Assignee.Login)
+		}
+	case "milestoned":
+		if issue.Milestone != nil {
+			msg.Description = fmt.Sprintf("Added to milestone **%s**", issue.Milestone.Title)
+		}
+	case "closed":
+		msg.Description = fmt.Sprintf("Closed with %d comments", issue.Comments)
+	}
+
+	labels := []string{}
+	for _, label := range issue.Labels {
+		labels = append(labels, label.Name)
+	}
+	if len(labels) > 0 {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+			Name:   "Labels",
+			Value:  truncateText(strings.Join(labels, ", "), maxEmbedField),
+			Inline: true,
+		})
+	}
+	assignees := []string{}
+	for _, assignee := range issue.Assignees {
+		assignees = append(assignees, assignee.Login)
+	}
+	if len(assignees) > 0 {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+			Name:   "Assignees",
+			Value:  truncateText(strings.Join(assignees, ", "), maxEmbedField),
+			Inline: true,
+		})
+	}
+	if issue.Milestone != nil {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Milestone", Value: issue.Milestone.Title, Inline: true})
+	}
+	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "State", Value: issue.State, Inline: true})
+	return msg, nil
+}
+
+func issueCommentEmbed(p *github.IssueCommentPayload) (*discordgo.MessageEmbed, error) {
+	if p.Action != "created" {
+		return nil, ErrUnsupportedEvent
+	}
+	kind := "issue"
+	if p.Issue.PullRequest != nil {
+		kind = "pull request"
+	}
+	return &discordgo.MessageEmbed{
+		Title:       truncateText(fmt.Sprintf("New comment on %s #%d: %s", kind, p.Issue.Number, p.Issue.Title), maxEmbedTitle),
+		URL:         p.Comment.HTMLURL,
+		Color:       colorComment,
+		Description: truncateText(p.Comment.Body, maxEmbedText),
+		Author:      githubAuthor(p.Comment.User.Login, p.Comment.User.AvatarURL, p.Comment.User.HTMLURL),
+	}, nil
+}
+
+func milestoneEmbed(p *github.MilestonePayload) (*discordgo.MessageEmbed, error) {
+	var color int
+	switch p.Action {
+	case "created", "opened":
+		color = colorOpened
+	case "closed":
+		color = colorMerged
+	case "deleted":
+		color = colorClosed
+	default:
+		return nil, ErrUnsupportedEvent
+	}
+
+	m := &p.Milestone
+	msg := &discordgo.MessageEmbed{
+		Title:  truncateText(fmt.Sprintf("Milestone %s %s in %s", m.Title, p.Action, p.Repository.FullName), maxEmbedTitle),
+		URL:    m.HTMLURL,
+		Color:  color,
+		Author: githubAuthor(p.Sender.Login, p.Sender.AvatarURL, p.Sender.HTMLURL),
+	}
+	if m.Description != nil {
+		msg.Description = truncateText(*m.Description, maxEmbedText)
+	}
+	msg.Fields = append(msg.Fields,
+		&discordgo.MessageEmbedField{Name: "Open Issues", Value: strconv.FormatInt(m.OpenIssues, 10), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Closed Issues", Value: strconv.FormatInt(m.ClosedIssues, 10), Inline: true},
+	)
+	if m.DueOn != nil {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Due", Value: m.DueOn.Format("2006-01-02"), Inline: true})
+	}
+	return msg, nil
+}
+
+func pullRequestEmbed(p *github.PullRequestPayload) (*discordgo.MessageEmbed, error) {
+	pr := &p.PullRequest
+	var title string
+	color := colorOpened
+	switch p.Action {
+	case "opened":
+		title = "New pull request"
+		if pr.Draft {
+			title = "New draft pull request"
+			color = colorDraft
+		}
+	case "reopened":
+		title = "Pull request reopened"
+	case "closed":
+		title = "Pull request closed"
+		color = colorClosed
+		if pr.Merged {
+			title = "Pull request merged"
+			color = colorMerged
+		}
+	case "ready_for_review":
+		title = "Pull request is ready for review"
+	case "review_requested":
+		title = "Review requested"
+		color = colorWarning
+	default:
+		return nil, ErrUnsupportedEvent
+	}
+
+	msg := &discordgo.MessageEmbed{
+		Title:  truncateText(fmt.Sprintf("%s #%d in %s: %s", title, pr.Number, p.Repository.FullName, pr.Title), maxEmbedTitle),
+		URL:    pr.HTMLURL,
+		Color:  color,
+		Author: githubAuthor(p.Sender.Login, p.Sender.AvatarURL, p.Sender.HTMLURL),
+	}
+	if p.Action == "opened" {
+		msg.Description = truncateText(pr.Body, maxEmbedText)
+	}
+	msg.Fields = append(msg.Fields,
+		&discordgo.MessageEmbedField{Name: "Branch", Value: fmt.Sprintf("`%s` → `%s`", pr.Head.Ref, pr.Base.Ref), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Commits", Value: strconv.FormatInt(pr.Commits, 10), Inline: true},
+		&discordgo.MessageEmbedField{
+			Name:   "Changes",
+			Value:  fmt.Sprintf("+%d / -%d in %d files", pr.Additions, pr.Deletions, pr.ChangedFiles),
+			Inline: true,
+		},
+	)
+	if p.Action == "review_requested" {
+		reviewer := ""
+		if p.RequestedReviewer != nil {
+			reviewer = p.RequestedReviewer.Login
+		} else if p.RequestedTeam.Name != "" {
+			reviewer = "team " + p.RequestedTeam.Name
+		}
+		if reviewer != "" {
+			msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Reviewer", Value: reviewer})
+		}
+	}
+	if pr.Merged && pr.MergedBy != nil {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Merged By", Value: pr.MergedBy.Login})
+	}
+	return msg, nil
+}
+
+func pullRequestReviewEmbed(p *github.PullRequestReviewPayload) (*discordgo.MessageEmbed, error) {
+	if p.Action != "submitted" {
+		return nil, ErrUnsupportedEvent
+	}
+	var verdict string
+	var color int
+	switch strings.ToLower(p.Review.State) {
+	case "approved":
+		verdict, color = "approved", colorOpened
+	case "changes_requested":
+		verdict, color = "requested changes to", colorClosed
+	case "commented":
+		verdict, color = "reviewed", colorComment
+	default:
+		return nil, ErrUnsupportedEvent
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: truncateText(fmt.Sprintf("%s %s pull request #%d in %s: %s", p.Review.User.Login, verdict,
+			p.PullRequest.Number, p.Repository.FullName, p.PullRequest.Title), maxEmbedTitle),
+		URL:         p.Review.HTMLURL,
+		Color:       color,
+		Description: truncateText(p.Review.Body, maxEmbedText),
+		Author:      githubAuthor(p.Review.User.Login, p.Review.User.AvatarURL, p.Review.User.HTMLURL),
+	}, nil
+}
+
+func pullRequestCommentEmbed(p *github.PullRequestReviewCommentPayload) (*discordgo.MessageEmbed, error) {
+	if p.Action != "created" {
+		return nil, ErrUnsupportedEvent
+	}
+	msg := &discordgo.MessageEmbed{
+		Title: truncateText(fmt.Sprintf("New review comment on pull request #%d in %s: %s",
+			p.PullRequest.Number, p.Repository.FullName, p.PullRequest.Title), maxEmbedTitle),
+		URL:         p.Comment.HTMLURL,
+		Color:       colorComment,
+		Description: truncateText(p.Comment.Body, maxEmbedText),
+		Author:      githubAuthor(p.Comment.User.Login, p.Comment.User.AvatarURL, p.Comment.User.HTMLURL),
+	}
+	if p.Comment.Path != "" {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "File", Value: "`" + p.Comment.Path + "`"})
+	}
+	return msg, nil
+}
+
+func releaseEmbed(p *github.ReleasePayload) (*discordgo.MessageEmbed, error) {
+	r := &p.Release
+	if p.Action != "published" || r.Draft {
+		return nil, ErrUnsupportedEvent
+	}
+
+	name := r.TagName
+	if r.Name != nil && *r.Name != "" {
+		name = *r.Name
+	}
+	kind := "Release"
+	color := colorOpened
+	if r.Prerelease {
+		kind = "Pre-release"
+		color = colorWarning
+	}
+	msg := &discordgo.MessageEmbed{
+		Title:  truncateText(fmt.Sprintf("%s %s of %s", kind, name, p.Repository.FullName), maxEmbedTitle),
+		URL:    r.HTMLURL,
+		Color:  color,
+		Author: githubAuthor(r.Author.Login, r.Author.AvatarURL, r.Author.HTMLURL),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Tag", Value: "`" + r.TagName + "`", Inline: true},
+			{Name: "Target", Value: "`" + r.TargetCommitish + "`", Inline: true},
+		},
+	}
+	if r.Body != nil {
+		msg.Description = truncateText(*r.Body, maxEmbedText)
+	}
+
+	assets := []string{}
+	for _, asset := range r.Assets {
+		assets = append(assets, fmt.Sprintf("[%s](%s)", asset.Name, asset.BrowserDownloadURL))
+	}
+	if len(assets) > 0 {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+			Name:  "Assets",
+			Value: truncateLines(assets, maxEmbedField),
+		})
+	}
+	return msg, nil
+}
+
+func vulnerabilityEmbed(p *github.RepositoryVulnerabilityAlertPayload) (*discordgo.MessageEmbed, error) {
+	a := &p.Alert
+	var title string
+	color := colorClosed
+	switch p.Action {
+	case "create":
+		title = "New vulnerability alert"
+	case "dismiss":
+		title = "Vulnerability alert dismissed"
+		color = colorDraft
+	case "resolve":
+		title = "Vulnerability alert resolved"
+		color = colorOpened
+	default:
+		return nil, ErrUnsupportedEvent
+	}
+
+	msg := &discordgo.MessageEmbed{
+		Title:       truncateText(fmt.Sprintf("%s: %s", title, a.AffectedPackageName), maxEmbedTitle),
+		URL:         a.ExternalReference,
+		Color:       color,
+		Description: truncateText(a.Summary, maxEmbedText),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Affected Versions", Value: orNone(a.AffectedRange), Inline: true},
+			{Name: "Fixed In", Value: orNone(a.FixedIn), Inline: true},
+		},
+	}
+	if a.ExternalIdentifier != "" {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Identifier", Value: a.ExternalIdentifier, Inline: true})
+	}
+	if p.Action == "dismiss" && a.Dismisser.Login != "" {
+		msg.Author = githubAuthor(a.Dismisser.Login, a.Dismisser.AvatarURL, a.Dismisser.HTMLURL)
+	}
+	return msg, nil
+}
+
+func securityAdvisoryEmbed(p *github.SecurityAdvisoryPayload) (*discordgo.MessageEmbed, error) {
+	a := &p.SecurityAdvisory
+	var title string
+	switch p.Action {
+	case "published":
+		title = "Security advisory"
+	case "updated":
+		title = "Security advisory updated"
+	case "withdrawn":
+		title = "Security advisory withdrawn"
+	default:
+		return nil, ErrUnsupportedEvent
+	}
+
+	// Severity of the advisory is not decoded by the webhooks library,
+	// the highest severity of vulnerabilities is used instead
+	severity := strings.ToLower(a.Severity)
+	packages := []string{}
+	for _, v := range a.Vulnerabilities {
+		if severityRank(v.Severity) > severityRank(severity) {
+			severity = strings.ToLower(v.Severity)
+		}
+		line := fmt.Sprintf("%s (%s) %s", v.Package.Name, v.Package.Ecosystem, v.VulnerableVersionRange)
+		if v.FirstPatchedVersion != nil {
+			line += ", fixed in " + v.FirstPatchedVersion.Identifier
+		}
+		packages = append(packages, line)
+	}
+
+	msg := &discordgo.MessageEmbed{
+		Title:       truncateText(fmt.Sprintf("%s %s: %s", title, a.GHSAID, a.Summary), maxEmbedTitle),
+		URL:         "https://github.com/advisories/" + a.GHSAID,
+		Color:       severityColor(severity),
+		Description: truncateText(a.Description, maxEmbedText),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Severity", Value: orNone(severity), Inline: true},
+		},
+	}
+	if p.Action == "withdrawn" {
+		msg.Color = colorDraft
+	}
+	identifiers := []string{}
+	for _, id := range a.Identifiers {
+		identifiers = append(identifiers, id.Value)
+	}
+	if len(identifiers) > 0 {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Identifiers", Value: strings.Join(identifiers, ", "), Inline: true})
+	}
+	if len(packages) > 0 {
+		msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{Name: "Packages", Value: truncateLines(packages, maxEmbedField)})
+	}
+	return msg, nil
+}
+
+// severityRank orders advisory severities from low to critical
+func severityRank(severity string) int {
+	switch strings.ToLower(severity) {
+	case "low":
+		return 1
+	case "moderate", "medium":
+		return 2
+	case "high":
+		return 3
+	case "critical":
+		return 4
+	}
+	return 0
+}
+
+func severityColor(severity string) int {
+	switch severityRank(severity) {
+	case 1:
+		return colorDraft
+	case 2:
+		return colorWarning
+	case 3:
+		return 0xe36209
+	case 4:
+		return colorClosed
+	}
+	return colorGitHub
+}
+
+func githubAuthor(login, avatar, url string) *discordgo.MessageEmbedAuthor {
+	return &discordgo.MessageEmbedAuthor{
+		Name:    login,
+		IconURL: avatar,
+		URL:     url,
+	}
+}
+
+// truncateText cuts text to the limit, marking it with an ellipsis
+func truncateText(text string, limit int) string {
+	text = strings.TrimSpace(text)
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-3]) + "..."
+}
+
+// truncateLines joins lines which fit into the limit and tells how many
+// were left out
+func truncateLines(lines []string, limit int) string {
+	result := ""
+	for i, line := range lines {
+		more := fmt.Sprintf("\nand %d more", len(lines)-i)
+		if len(result)+len(line)+1+len(more) > limit {
+			return result + strings.TrimPrefix(more, "\n")
+		}
+		result += line + "\n"
+	}
+	return strings.TrimSuffix(result, "\n")
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
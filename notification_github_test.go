@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/go-playground/webhooks.v5/github"
+)
+
+// parseGitHubEvent builds event from a JSON payload
+func parseGitHubEvent(t *testing.T, kind GitHubEventType, payload string) *GitHubEvent {
+	e := &GitHubEvent{event: kind}
+	var target interface{}
+	switch kind {
+	case CommitComment:
+		target = &e.commitComment
+	case Fork:
+		target = &e.fork
+	case Issue:
+		target = &e.issue
+	case IssueComment:
+		target = &e.issueComment
+	case Milestone:
+		target = &e.milestone
+	case PullRequest:
+		target = &e.pullRequest
+	case PullRequestReview:
+		target = &e.pullRequestReview
+	case PullRequestComment:
+		target = &e.pullRequestComment
+	case Push:
+		target = &e.push
+	case Vulnerability:
+		target = &e.vulnerability
+	case Release:
+		target = &e.release
+	case Security:
+		target = &e.security
+	}
+	if err := json.Unmarshal([]byte(payload), target); err != nil {
+		t.Fatalf("Failed to parse %s payload: %s", kind, err.Error())
+	}
+	return e
+}
+
+// loadGitHubFixture passes recorded payload from testdata/github through
+// the webhook parser. Event name is the part of file name before "_"
+func loadGitHubFixture(t *testing.T, name string) *GitHubEvent {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "github", name+".json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %s", name, err.Error())
+	}
+	event := strings.SplitN(name, "_", 2)[0]
+	r := httptest.NewRequest("POST", "/github", bytes.NewReader(data))
+	r.Header.Set("X-GitHub-Event", event)
+
+	hook, err := github.New()
+	if err != nil {
+		t.Fatalf("Failed to create webhook parser: %s", err.Error())
+	}
+	payload, err := hook.Parse(r, github.Event(event))
+	if err != nil {
+		t.Fatalf("Failed to parse fixture %s: %s", name, err.Error())
+	}
+	switch p := payload.(type) {
+	case github.IssuesPayload:
+		return &GitHubEvent{event: Issue, issue: p}
+	}
+	t.Fatalf("Fixture %s has unexpected payload %T", name, payload)
+	return nil
+}
+
+func TestIssueEmbed(t *testing.T) {
+	cases := []struct {
+		fixture     string
+		title       string
+		color       int
+		description string
+		field       string
+		err         error
+	}{
+		{"issues_opened", "Issue #12 opened in savageking-io/eveleve: Bot crashes on empty message", 0x2cbe4e, "Sending an empty message", "", nil},
+		{"issues_edited", "Issue #12 edited", 0x0366d6, "Title changed from **Bot crashes**", "", nil},
+		{"issues_closed", "Issue #12 closed", 0xcb2431, "Closed with 2 comments", "", nil},
+		{"issues_reopened", "Issue #12 reopened", 0x85e89d, "", "", nil},
+		{"issues_labeled", "Issue #12 labeled", 0xfbca04, "Label **bug** added", "Labels", nil},
+		{"issues_assigned", "Issue #12 assigned", 0x6f42c1, "Assigned to **savageking**", "Assignees", nil},
+		{"issues_milestoned", "Issue #12 added to milestone", 0x1d76db, "Added to milestone **v1.0**", "Milestone", nil},
+		{"issues_transferred", "Issue #12 transferred", 0x959da5, "", "", nil},
+		{"issues_pinned", "Issue #12 pinned", 0xf9826c, "", "", nil},
+		{"issues_locked", "", 0, "", "", ErrUnsupportedEvent},
+	}
+
+	colors := make(map[int]string)
+	for _, c := range cases {
+		t.Run(c.fixture, func(t *testing.T) {
+			msg, err := githubEmbed(loadGitHubFixture(t, c.fixture))
+			if err != c.err {
+				t.Fatalf("Expected error %v, got %v", c.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(msg.Title, c.title) {
+				t.Errorf("Wrong title: %s", msg.Title)
+			}
+			if msg.Color != c.color {
+				t.Errorf("Wrong color: %x", msg.Color)
+			}
+			if other, ok := colors[msg.Color]; ok {
+				t.Errorf("Color %x is used by %s too", msg.Color, other)
+			}
+			colors[msg.Color] = c.fixture
+			if msg.URL != "https://github.com/savageking-io/eveleve/issues/12" {
+				t.Errorf("Wrong URL: %s", msg.URL)
+			}
+			if !strings.HasPrefix(msg.Description, c.description) {
+				t.Errorf("Wrong description: %s", msg.Description)
+			}
+			if msg.Author == nil || msg.Author.Name != "savageking" {
+				t.Errorf("Wrong author: %+v", msg.Author)
+			}
+			fields := make(map[string]string)
+			for _, field := range msg.Fields {
+				fields[field.Name] = field.Value
+			}
+			if _, ok := fields[c.field]; c.field != "" && !ok {
+				t.Errorf("Field %s is missing: %v", c.field, fields)
+			}
+			if fields["State"] == "" {
+				t.Errorf("State is missing: %v", fields)
+			}
+		})
+	}
+}
+
+func TestPullRequestEmbed(t *testing.T) {
+	e := parseGitHubEvent(t, PullRequest, `{
+		"action": "closed",
+		"pull_request": {
+			"number": 7, "title": "Add bus", "html_url": "https://github.com/savageking-io/eveleve/pull/7",
+			"merged": true, "merged_by": {"login": "savageking"},
+			"commits": 3, "additions": 120, "deletions": 14, "changed_files": 5,
+			"head": {"ref": "bus"}, "base": {"ref": "master"}
+		},
+		"repository": {"full_name": "savageking-io/eveleve"},
+		"sender": {"login": "savageking"}
+	}`)
+	msg, err := githubEmbed(e)
+	if err != nil {
+		t.Fatalf("Failed to render pull request: %s", err.Error())
+	}
+	if !strings.HasPrefix(msg.Title, "Pull request merged #7") || msg.Color != colorMerged {
+		t.Errorf("Wrong title or color: %s %x", msg.Title, msg.Color)
+	}
+	if msg.URL != "https://github.com/savageking-io/eveleve/pull/7" {
+		t.Errorf("Wrong URL: %s", msg.URL)
+	}
+	fields := make(map[string]string)
+	for _, field := range msg.Fields {
+		fields[field.Name] = field.Value
+	}
+	if fields["Changes"] != "+120 / -14 in 5 files" || fields["Commits"] != "3" || fields["Merged By"] != "savageking" {
+		t.Errorf("Wrong fields: %v", fields)
+	}
+	if fields["Branch"] != "`bus` → `master`" {
+		t.Errorf("Wrong branch: %s", fields["Branch"])
+	}
+
+	e.pullRequest.Action = "synchronize"
+	if _, err := githubEmbed(e); err != ErrUnsupportedEvent {
+		t.Errorf("Expected unsupported event, got %v", err)
+	}
+}
+
+func TestPullRequestReviewEmbed(t *testing.T) {
+	cases := []struct {
+		state string
+		color int
+		title string
+		err   error
+	}{
+		{"approved", colorOpened, "reviewer approved pull request #7", nil},
+		{"changes_requested", colorClosed, "reviewer requested changes to pull request #7", nil},
+		{"commented", colorComment, "reviewer reviewed pull request #7", nil},
+		{"dismissed", 0, "", ErrUnsupportedEvent},
+	}
+	for _, c := range cases {
+		e := parseGitHubEvent(t, PullRequestReview, `{
+			"action": "submitted",
+			"review": {"state": "`+c.state+`", "body": "Looks fine", "user": {"login": "reviewer"}},
+			"pull_request": {"number": 7, "title": "Add bus"},
+			"repository": {"full_name": "savageking-io/eveleve"}
+		}`)
+		msg, err := githubEmbed(e)
+		if err != c.err {
+			t.Errorf("%s: expected error %v, got %v", c.state, c.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !strings.HasPrefix(msg.Title, c.title) || msg.Color != c.color {
+			t.Errorf("%s: wrong title or color: %s %x", c.state, msg.Title, msg.Color)
+		}
+		if msg.Description != "Looks fine" {
+			t.Errorf("%s: wrong description: %s", c.state, msg.Description)
+		}
+	}
+}
+
+func TestReleaseEmbed(t *testing.T) {
+	e := parseGitHubEvent(t, Release, `{
+		"action": "published",
+		"release": {
+			"tag_name": "v1.2.0", "name": "Bus", "target_commitish": "master", "prerelease": true,
+			"html_url": "https://github.com/savageking-io/eveleve/releases/v1.2.0",
+			"body": "`+strings.Repeat("a", 1500)+`",
+			"assets": [{"name": "eveleve-linux", "browser_download_url": "https://example.com/eveleve-linux"}],
+			"author": {"login": "savageking"}
+		},
+		"repository": {"full_name": "savageking-io/eveleve"}
+	}`)
+	msg, err := githubEmbed(e)
+	if err != nil {
+		t.Fatalf("Failed to render release: %s", err.Error())
+	}
+	if msg.Title != "Pre-release Bus of savageking-io/eveleve" {
+		t.Errorf("Wrong title: %s", msg.Title)
+	}
+	if len(msg.Description) != maxEmbedText || !strings.HasSuffix(msg.Description, "...") {
+		t.Errorf("Release notes are not truncated: %d", len(msg.Description))
+	}
+	last := msg.Fields[len(msg.Fields)-1]
+	if last.Name != "Assets" || last.Value != "[eveleve-linux](https://example.com/eveleve-linux)" {
+		t.Errorf("Wrong assets: %+v", last)
+	}
+
+	e.release.Release.Draft = true
+	if _, err := githubEmbed(e); err != ErrUnsupportedEvent {
+		t.Errorf("Draft release should not be rendered: %v", err)
+	}
+}
+
+func TestSecurityAdvisoryEmbed(t *testing.T) {
+	e := parseGitHubEvent(t, Security, `{
+		"action": "published",
+		"security_advisory": {
+			"ghsa_id": "GHSA-rf4j-j272-fj86",
+			"summary": "Remote code execution",
+			"identifiers": [{"type": "CVE", "value": "CVE-2018-6188"}],
+			"vulnerabilities": [
+				{"package": {"ecosystem": "go", "name": "a"}, "severity": "moderate", "vulnerable_version_range": "< 1.0"},
+				{"package": {"ecosystem": "go", "name": "b"}, "severity": "critical", "vulnerable_version_range": "< 2.0",
+					"first_patched_version": {"identifier": "2.0"}}
+			]
+		}
+	}`)
+	msg, err := githubEmbed(e)
+	if err != nil {
+		t.Fatalf("Failed to render advisory: %s", err.Error())
+	}
+	if msg.Color != colorClosed || msg.Fields[0].Value != "critical" {
+		t.Errorf("Wrong severity: %s %x", msg.Fields[0].Value, msg.Color)
+	}
+	packages := msg.Fields[len(msg.Fields)-1].Value
+	if packages != "a (go) < 1.0\nb (go) < 2.0, fixed in 2.0" {
+		t.Errorf("Wrong packages: %s", packages)
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	lines := []string{"aaaa", "bbbb", "cccc"}
+	if result := truncateLines(lines, 100); result != "aaaa\nbbbb\ncccc" {
+		t.Errorf("Wrong result: %q", result)
+	}
+	if result := truncateLines(lines, 20); result != "aaaa\nand 2 more" {
+		t.Errorf("Wrong result: %q", result)
+	}
+}
+
+func TestPushEmbed(t *testing.T) {
+	push := func(before, after string, commits int, message string) *github.PushPayload {
+		list := []string{}
+		for i := 0; i < commits; i++ {
+			list = append(list, fmt.Sprintf(`{"id": "0123456789abcdef", "message": %q, "author": {"username": "savageking"}}`, message))
+		}
+		p := new(github.PushPayload)
+		payload := fmt.Sprintf(`{
+			"ref": "refs/heads/master", "before": %q, "after": %q,
+			"repository": {"full_name": "savageking-io/eveleve", "html_url": "https://github.com/savageking-io/eveleve"},
+			"sender": {"login": "savageking"},
+			"commits": [%s]
+		}`, before, after, strings.Join(list, ","))
+		if err := json.Unmarshal([]byte(payload), p); err != nil {
+			t.Fatalf("Failed to parse push payload: %s", err.Error())
+		}
+		return p
+	}
+
+	msg, err := pushEmbed([]*github.PushPayload{push("aaaaaaaa", "bbbbbbbb", 30, "Fix build")})
+	if err != nil {
+		t.Fatalf("pushEmbed: %s", err.Error())
+	}
+	if len(msg.Fields) != maxEmbedFields {
+		t.Errorf("fields = %d, want %d", len(msg.Fields), maxEmbedFields)
+	}
+	if last := msg.Fields[len(msg.Fields)-1].Value; !strings.HasPrefix(last, "[and 6 more commits]") {
+		t.Errorf("last field = %q", last)
+	}
+
+	msg, err = pushEmbed([]*github.PushPayload{
+		push("aaaaaaaa", "bbbbbbbb", 15, strings.Repeat("Long message ", 40)),
+		push("bbbbbbbb", "cccccccc", 15, strings.Repeat("Long message ", 40)),
+	})
+	if err != nil {
+		t.Fatalf("pushEmbed: %s", err.Error())
+	}
+	if length := embedLength(msg); length > maxEmbedLength {
+		t.Errorf("embed length = %d, want at most %d", length, maxEmbedLength)
+	}
+	want := "https://github.com/savageking-io/eveleve/compare/aaaaaaa...ccccccc"
+	if msg.URL != want {
+		t.Errorf("url = %q, want %q", msg.URL, want)
+	}
+	if len(msg.Fields) >= maxEmbedFields-1 {
+		t.Errorf("fields = %d, want length limit to cut commits first", len(msg.Fields))
+	}
+	if last := msg.Fields[len(msg.Fields)-1].Value; !strings.Contains(last, "more commits]("+want+")") {
+		t.Errorf("last field = %q", last)
+	}
+	if !strings.Contains(msg.Title, "30 commits") {
+		t.Errorf("title = %q", msg.Title)
+	}
+
+	msg, err = pushEmbed([]*github.PushPayload{push("aaaaaaaa", "bbbbbbbb", 1, "")})
+	if err != nil {
+		t.Fatalf("pushEmbed: %s", err.Error())
+	}
+	if name := msg.Fields[0].Name; name != "0123456" {
+		t.Errorf("commit without message: field name = %q", name)
+	}
+
+	created := push("00000000", "bbbbbbbb", 0, "")
+	created.Created = true
+	deleted := push("bbbbbbbb", "00000000", 0, "")
+	deleted.Deleted = true
+	for _, tt := range []struct {
+		push  *github.PushPayload
+		title string
+		url   string
+	}{
+		{created, "savageking created branch master of savageking-io/eveleve", "https://github.com/savageking-io/eveleve/tree/master"},
+		{deleted, "savageking deleted branch master of savageking-io/eveleve", "https://github.com/savageking-io/eveleve"},
+	} {
+		msg, err = pushEmbed([]*github.PushPayload{tt.push})
+		if err != nil {
+			t.Fatalf("pushEmbed: %s", err.Error())
+		}
+		if msg.Title != tt.title || msg.URL != tt.url || len(msg.Fields) != 0 {
+			t.Errorf("embed = %q %q with %d fields, want %q %q", msg.Title, msg.URL, len(msg.Fields), tt.title, tt.url)
+		}
+	}
+	if _, err := pushEmbed([]*github.PushPayload{push("aaaaaaaa", "aaaaaaaa", 0, "")}); err != ErrUnsupportedEvent {
+		t.Errorf("push without commits: error = %v, want %v", err, ErrUnsupportedEvent)
+	}
+
+	created = push("0000000000000000000000000000000000000000", "bbbbbbbb", 1, "Add feature")
+	created.Created = true
+	msg, err = pushEmbed([]*github.PushPayload{created, push("bbbbbbbb", "cccccccc", 1, "Fix feature")})
+	if err != nil {
+		t.Fatalf("pushEmbed: %s", err.Error())
+	}
+	if want := "https://github.com/savageking-io/eveleve/tree/master"; msg.URL != want {
+		t.Errorf("pushes to a new branch: url = %q, want %q", msg.URL, want)
+	}
+}
+
+// TestGitHubEmbedLimits posts titles of the longest length allowed by GitHub
+func TestGitHubEmbedLimits(t *testing.T) {
+	long := strings.Repeat("x", 256)
+	labels := []string{}
+	for i := 0; i < 60; i++ {
+		labels = append(labels, fmt.Sprintf(`{"name": "%s"}`, strings.Repeat("l", 49)))
+	}
+	tests := []struct {
+		kind    GitHubEventType
+		payload string
+	}{
+		{Issue, `{"action": "opened", "issue": {"number": 1, "title": "` + long + `", "labels": [` + strings.Join(labels, ",") + `]},
+			"repository": {"full_name": "savageking-io/eveleve"}, "sender": {"login": "author"}}`},
+		{IssueComment, `{"action": "created", "issue": {"number": 1, "title": "` + long + `"}, "comment": {"body": "Me too"}}`},
+		{Milestone, `{"action": "closed", "milestone": {"title": "` + long + `"}, "repository": {"full_name": "savageking-io/eveleve"}}`},
+		{PullRequest, `{"action": "opened", "pull_request": {"number": 7, "title": "` + long + `", "head": {"ref": "bus"}, "base": {"ref": "master"}},
+			"repository": {"full_name": "savageking-io/eveleve"}, "sender": {"login": "author"}}`},
+		{PullRequestReview, `{"action": "submitted", "review": {"state": "approved", "user": {"login": "reviewer"}},
+			"pull_request": {"number": 7, "title": "` + long + `"}, "repository": {"full_name": "savageking-io/eveleve"}}`},
+		{PullRequestComment, `{"action": "created", "comment": {"body": "Typo"}, "pull_request": {"number": 7, "title": "` + long + `"},
+			"repository": {"full_name": "savageking-io/eveleve"}}`},
+		{Release, `{"action": "published", "release": {"tag_name": "v1", "name": "` + long + `", "author": {"login": "author"}},
+			"repository": {"full_name": "savageking-io/eveleve"}}`},
+		{Security, `{"action": "published", "security_advisory": {"ghsa_id": "GHSA-rf4j-j272-fj86", "summary": "` + long + `"}}`},
+	}
+	for _, tt := range tests {
+		msg, err := githubEmbed(parseGitHubEvent(t, tt.kind, tt.payload))
+		if err != nil {
+			t.Errorf("%s: githubEmbed failed: %s", tt.kind, err.Error())
+			continue
+		}
+		if n := len([]rune(msg.Title)); n > maxEmbedTitle {
+			t.Errorf("%s: title is %d characters long", tt.kind, n)
+		}
+		for _, field := range msg.Fields {
+			if n := len([]rune(field.Value)); n > maxEmbedField {
+				t.Errorf("%s: field %s is %d characters long", tt.kind, field.Name, n)
+			}
+		}
+	}
+}
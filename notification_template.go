@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// TemplateData is passed to notification templates
+type TemplateData struct {
+	// Event is a short description of the event, the same as kept in
+	// the history: Type, Action, Project, Branch, Actor, Number, Title,
+	// URL, Commits, Authors, Labels, Result and Merged
+	Event *EventRecord
+	// Payload is the webhook payload: a payload struct of
+	// gopkg.in/go-playground/webhooks.v5/github or TravisPacket
+	Payload interface{}
+	// Default is the built-in embed of the event
+	Default *discordgo.MessageEmbed
+}
+
+// templateFuncs are available in every notification template
+var templateFuncs = template.FuncMap{
+	"truncate":  func(limit int, text string) string { return truncateText(text, limit) },
+	"join":      func(sep string, list []string) string { return strings.Join(list, sep) },
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"firstLine": firstLine,
+}
+
+// notificationTemplate keeps every text of NotificationConfig compiled
+// as a named template
+type notificationTemplate struct {
+	key  string
+	conf NotificationConfig
+	tmpl *template.Template
+}
+
+// texts returns template texts by name
+func (c *NotificationConfig) texts() map[string]string {
+	texts := map[string]string{
+		"title":         c.Title,
+		"url":           c.URL,
+		"description":   c.Description,
+		"footer.text":   c.Footer.Text,
+		"footer.icon":   c.Footer.Icon,
+		"image.url":     c.Image.URL,
+		"thumbnail.url": c.Thumbnail.URL,
+		"author.name":   c.Author.Name,
+		"author.url":    c.Author.URL,
+		"author.icon":   c.Author.Icon,
+		"provider.name": c.Provider.Name,
+		"provider.url":  c.Provider.URL,
+	}
+	for i, field := range c.Fields {
+		texts[fmt.Sprintf("fields[%d].name", i)] = field.Name
+		texts[fmt.Sprintf("fields[%d].value", i)] = field.Value
+	}
+	return texts
+}
+
+// compileTemplate parses every text of the notification config
+func compileTemplate(key string, conf NotificationConfig) (*notificationTemplate, error) {
+	t := &notificationTemplate{
+		key:  key,
+		conf: conf,
+		tmpl: template.New(key).Funcs(templateFuncs).Option("missingkey=zero"),
+	}
+	for name, text := range conf.texts() {
+		if text == "" {
+			continue
+		}
+		if _, err := t.tmpl.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+	}
+	return t, nil
+}
+
+// findTemplate looks up template by event type and action, e.g.
+// "issues.opened", and then by event type only
+func findTemplate(templates map[string]*notificationTemplate, record *EventRecord) *notificationTemplate {
+	if record == nil {
+		return nil
+	}
+	if record.Action != "" {
+		if t, ok := templates[record.Type+"."+record.Action]; ok {
+			return t
+		}
+	}
+	return templates[record.Type]
+}
+
+// execute renders named template. Value is returned as is when the
+// template has no such text
+func (t *notificationTemplate) execute(name, value string, data TemplateData) (string, error) {
+	if t.tmpl.Lookup(name) == nil {
+		return value, nil
+	}
+	buffer := new(bytes.Buffer)
+	if err := t.tmpl.ExecuteTemplate(buffer, name, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buffer.String()), nil
+}
+
+// render builds embed from the built-in one. Configured fields replace
+// built-in fields, fields with empty name or value are left out
+func (t *notificationTemplate) render(data TemplateData) (*discordgo.MessageEmbed, error) {
+	msg := new(discordgo.MessageEmbed)
+	if data.Default != nil {
+		*msg = *data.Default
+	}
+	if t.conf.Color != 0 {
+		msg.Color = t.conf.Color
+	}
+
+	var err error
+	set := func(name string, target *string) {
+		if err != nil {
+			return
+		}
+		*target, err = t.execute(name, *target, data)
+	}
+	set("title", &msg.Title)
+	set("url", &msg.URL)
+	set("description", &msg.Description)
+
+	if t.conf.Footer.Text != "" || t.conf.Footer.Icon != "" {
+		msg.Footer = copyFooter(msg.Footer)
+		set("footer.text", &msg.Footer.Text)
+		set("footer.icon", &msg.Footer.IconURL)
+	}
+	if t.conf.Image.URL != "" {
+		msg.Image = &discordgo.MessageEmbedImage{}
+		set("image.url", &msg.Image.URL)
+	}
+	if t.conf.Thumbnail.URL != "" {
+		msg.Thumbnail = &discordgo.MessageEmbedThumbnail{}
+		set("thumbnail.url", &msg.Thumbnail.URL)
+	}
+	if t.conf.Author.Name != "" || t.conf.Author.URL != "" || t.conf.Author.Icon != "" {
+		msg.Author = copyAuthor(msg.Author)
+		set("author.name", &msg.Author.Name)
+		set("author.url", &msg.Author.URL)
+		set("author.icon", &msg.Author.IconURL)
+	}
+	if t.conf.Provider.Name != "" || t.conf.Provider.URL != "" {
+		msg.Provider = copyProvider(msg.Provider)
+		set("provider.name", &msg.Provider.Name)
+		set("provider.url", &msg.Provider.URL)
+	}
+
+	if len(t.conf.Fields) > 0 {
+		msg.Fields = []*discordgo.MessageEmbedField{}
+		for i, conf := range t.conf.Fields {
+			field := &discordgo.MessageEmbedField{Inline: conf.Inline}
+			set(fmt.Sprintf("fields[%d].name", i), &field.Name)
+			set(fmt.Sprintf("fields[%d].value", i), &field.Value)
+			if field.Name != "" && field.Value != "" {
+				field.Value = truncateText(field.Value, maxEmbedField)
+				msg.Fields = append(msg.Fields, field)
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func copyFooter(footer *discordgo.MessageEmbedFooter) *discordgo.MessageEmbedFooter {
+	result := new(discordgo.MessageEmbedFooter)
+	if footer != nil {
+		*result = *footer
+	}
+	return result
+}
+
+func copyAuthor(author *discordgo.MessageEmbedAuthor) *discordgo.MessageEmbedAuthor {
+	result := new(discordgo.MessageEmbedAuthor)
+	if author != nil {
+		*result = *author
+	}
+	return result
+}
+
+func copyProvider(provider *discordgo.MessageEmbedProvider) *discordgo.MessageEmbedProvider {
+	result := new(discordgo.MessageEmbedProvider)
+	if provider != nil {
+		*result = *provider
+	}
+	return result
+}
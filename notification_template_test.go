@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNotificationTemplate(t *testing.T) {
+	e := loadGitHubFixture(t, "issues_labeled")
+	record := e.Record()
+	def, err := githubEmbed(e)
+	if err != nil {
+		t.Fatalf("Failed to render issue: %s", err.Error())
+	}
+
+	conf := NotificationConfig{
+		Title: "[{{ .Event.Project }}] {{ .Default.Title }}",
+		Color: 0x123456,
+		Fields: []NotificationField{
+			{Name: "Labels", Value: `{{ join ", " .Event.Labels }}`, Inline: true},
+			{Name: "Reporter", Value: "{{ .Payload.Issue.User.Login }}"},
+			{Name: "Empty", Value: "{{ .Event.Branch }}"},
+		},
+	}
+	conf.Footer.Text = "{{ upper .Event.Action }} by {{ .Event.Actor }}"
+
+	templates := make(map[string]*notificationTemplate)
+	for _, key := range []string{"issues", "issues.labeled"} {
+		compiled, err := compileTemplate(key, conf)
+		if err != nil {
+			t.Fatalf("Failed to compile template: %s", err.Error())
+		}
+		templates[key] = compiled
+	}
+	tmpl := findTemplate(templates, record)
+	if tmpl == nil || tmpl.key != "issues.labeled" {
+		t.Fatalf("Template of the action is not preferred: %+v", tmpl)
+	}
+
+	msg, err := tmpl.render(TemplateData{Event: record, Payload: e.Payload(), Default: def})
+	if err != nil {
+		t.Fatalf("Failed to render template: %s", err.Error())
+	}
+	if msg.Title != "[savageking-io/eveleve] "+def.Title {
+		t.Errorf("Wrong title: %s", msg.Title)
+	}
+	if msg.URL != def.URL || msg.Description != def.Description {
+		t.Errorf("Built-in values are not kept: %s %s", msg.URL, msg.Description)
+	}
+	if msg.Color != 0x123456 {
+		t.Errorf("Wrong color: %x", msg.Color)
+	}
+	if msg.Footer == nil || msg.Footer.Text != "LABELED by savageking" {
+		t.Errorf("Wrong footer: %+v", msg.Footer)
+	}
+	if len(msg.Fields) != 2 || msg.Fields[0].Value != "bug" || msg.Fields[1].Value != "reporter" {
+		for _, field := range msg.Fields {
+			t.Logf("%s: %s", field.Name, field.Value)
+		}
+		t.Errorf("Wrong fields")
+	}
+	if def.Footer != nil {
+		t.Errorf("Built-in embed was modified")
+	}
+
+	record.Action = "opened"
+	if tmpl := findTemplate(templates, record); tmpl == nil || tmpl.key != "issues" {
+		t.Errorf("Template of the event type is not used: %+v", tmpl)
+	}
+}
+
+func TestNotificationTemplate_Errors(t *testing.T) {
+	conf := new(Config)
+	conf.Notifications = map[string]NotificationConfig{
+		"push":         {Title: "{{ .Event.Project }"},
+		"issue.opened": {Title: "ok"},
+		"build":        {Title: "{{ .Payload.Missing }}"},
+	}
+	errs := ConfigErrors{}
+	conf.validateNotifications(&errs)
+	if len(errs) != 2 {
+		t.Errorf("Expected 2 errors, got %d: %v", len(errs), errs)
+	}
+
+	tmpl, err := compileTemplate("build", conf.Notifications["build"])
+	if err != nil {
+		t.Fatalf("Failed to compile template: %s", err.Error())
+	}
+	packet := &TravisPacket{StatusMessage: "Passed"}
+	if _, err := tmpl.render(TemplateData{Event: packet.Record(), Payload: packet, Default: travisEmbed(packet)}); err == nil {
+		t.Errorf("Missing payload field was not reported")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PermissionError is returned when command is not allowed or is used
+// too often
+type PermissionError struct {
+	Message string
+	// Cooldown is set when command is allowed but was used recently
+	Cooldown bool
+}
+
+func (e *PermissionError) Error() string {
+	return e.Message
+}
+
+// Permissions decides who can use commands and where. Rules are looked
+// up by full command path, then by parent commands and then fall back
+// to the default rule. Admin commands without own rules are accepted
+// in the log channel only
+type Permissions struct {
+	discord *Discord
+
+	mutex    sync.Mutex
+	conf     PermissionsConfig
+	lastUsed map[string]time.Time
+}
+
+func (p *Permissions) Init(conf PermissionsConfig, discord *Discord) error {
+	if discord == nil {
+		return fmt.Errorf("nil discord")
+	}
+	p.discord = discord
+	p.lastUsed = make(map[string]time.Time)
+	p.SetConfig(conf)
+	return nil
+}
+
+// SetConfig replaces permission rules. Cooldowns of recently used
+// commands are kept
+func (p *Permissions) SetConfig(conf PermissionsConfig) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.conf = conf
+}
+
+// Check returns PermissionError when author of the command can't use
+// it. Denied attempts are reported into the log channel
+func (p *Permissions) Check(def *CommandDef, command *Command) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	rule := p.rule(def)
+	if reason := rule.denied(command); reason != "" {
+		log.Warnf("Command %s denied for %s in %s: %s", def.Path(), command.AuthorID, command.ChannelID, reason)
+		if p.discord != nil {
+			go p.discord.sendLog(fmt.Sprintf("Denied `%s` for user %s in <#%s>: %s",
+				command.Text, command.AuthorID, command.ChannelID, reason))
+		}
+		return &PermissionError{Message: fmt.Sprintf("you are not allowed to use %s%s here", CommandPrefix, def.Path())}
+	}
+
+	if rule.Cooldown > 0 {
+		key := command.AuthorID + "/" + def.Path()
+		if last, ok := p.lastUsed[key]; ok {
+			if left := rule.Cooldown - time.Since(last); left > 0 {
+				return &PermissionError{
+					Message:  fmt.Sprintf("%s%s can be used again in %s", CommandPrefix, def.Path(), left.Round(time.Second)),
+					Cooldown: true,
+				}
+			}
+		}
+		p.lastUsed[key] = time.Now()
+	}
+	return nil
+}
+
+func (p *Permissions) rule(def *CommandDef) CommandPermission {
+	admin := false
+	for d := def; d != nil; d = d.parent {
+		if rule, ok := p.conf.Commands[d.Path()]; ok {
+			return rule
+		}
+		admin = admin || d.Admin
+	}
+	if admin && p.discord != nil {
+		return CommandPermission{Allow: PermissionRule{Channels: []string{p.discord.logChannel()}}}
+	}
+	return p.conf.Default
+}
+
+// denied returns reason why command is denied or an empty string
+func (r *CommandPermission) denied(command *Command) string {
+	if containsString(r.Deny.Users, command.AuthorID) {
+		return "user is denied"
+	}
+	if containsString(r.Deny.Channels, command.ChannelID) {
+		return "channel is denied"
+	}
+	for _, role := range command.Roles {
+		if containsString(r.Deny.Roles, role) {
+			return "role is denied"
+		}
+	}
+
+	if len(r.Allow.Channels) > 0 && !containsString(r.Allow.Channels, command.ChannelID) {
+		return "channel is not allowed"
+	}
+	if len(r.Allow.Users) == 0 && len(r.Allow.Roles) == 0 {
+		return ""
+	}
+	if containsString(r.Allow.Users, command.AuthorID) {
+		return ""
+	}
+	for _, role := range command.Roles {
+		if containsString(r.Allow.Roles, role) {
+			return ""
+		}
+	}
+	return "user has no allowed role"
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
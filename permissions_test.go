@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPermissions_Check(t *testing.T) {
+	const (
+		admin   = "100000000000000001"
+		banned  = "100000000000000002"
+		user    = "100000000000000003"
+		modRole = "200000000000000001"
+		logs    = "300000000000000001"
+		general = "300000000000000002"
+	)
+
+	noop := func(*CommandContext) error { return nil }
+	projects := &CommandDef{
+		Name: "projects",
+		Subcommands: []*CommandDef{
+			{Name: "list", Handler: noop},
+			{Name: "add", Handler: noop, Admin: true},
+		},
+	}
+	if err := validateCommandDef(projects); err != nil {
+		t.Fatalf("Invalid command: %s", err.Error())
+	}
+	list, add := projects.Subcommands[0], projects.Subcommands[1]
+	reload := &CommandDef{Name: "reload", Handler: noop, Admin: true}
+	help := &CommandDef{Name: "help", Handler: noop}
+
+	p := &Permissions{
+		discord:  &Discord{LogChannel: logs},
+		lastUsed: make(map[string]time.Time),
+	}
+	p.SetConfig(PermissionsConfig{
+		Default: CommandPermission{Deny: PermissionRule{Users: []string{banned}}},
+		Commands: map[string]CommandPermission{
+			"projects": {Allow: PermissionRule{Roles: []string{modRole}, Users: []string{admin}}},
+			"help":     {Cooldown: time.Minute},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		def     *CommandDef
+		command Command
+		allowed bool
+	}{
+		{"default allows everyone", reload, Command{AuthorID: user, ChannelID: logs}, true},
+		{"admin command outside log channel", reload, Command{AuthorID: admin, ChannelID: general}, false},
+		{"own rule replaces default", help, Command{AuthorID: banned, ChannelID: general}, true},
+		{"parent rule allows role", list, Command{AuthorID: user, ChannelID: general, Roles: []string{modRole}}, true},
+		{"parent rule allows user", add, Command{AuthorID: admin, ChannelID: general}, true},
+		{"parent rule denies others", add, Command{AuthorID: user, ChannelID: logs}, false},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.def, &tt.command)
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s: Check() = %v, want allowed %v", tt.name, err, tt.allowed)
+		}
+	}
+
+	if err := p.Check(help, &Command{AuthorID: user, ChannelID: general}); err != nil {
+		t.Fatalf("First use is denied: %s", err.Error())
+	}
+	err := p.Check(help, &Command{AuthorID: user, ChannelID: general})
+	if err == nil || !strings.Contains(err.Error(), "can be used again") {
+		t.Errorf("Cooldown is not applied: %v", err)
+	}
+	if perr, ok := err.(*PermissionError); !ok || !perr.Cooldown {
+		t.Errorf("Cooldown error expected, got %#v", err)
+	}
+	if err := p.Check(help, &Command{AuthorID: admin, ChannelID: general}); err != nil {
+		t.Errorf("Cooldown is shared between users: %s", err.Error())
+	}
+}
@@ -1,10 +1,447 @@
 package main
 
 import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ProjectOriginConfig marks projects listed in the configuration file
+	ProjectOriginConfig = "config"
+	// ProjectOriginRuntime marks projects added while the bot is running
+	ProjectOriginRuntime = "runtime"
+	// ProjectOriginPattern marks projects allowed by a glob or regular
+	// expression of the configuration file, saved with their first event
+	ProjectOriginPattern = "pattern"
+)
+
+var (
+	ErrProjectExists     = fmt.Errorf("project already exists")
+	ErrProjectNotFound   = fmt.Errorf("project not found")
+	ErrProjectConfigured = fmt.Errorf("project is listed in the configuration file")
 )
 
 type ProjectData struct {
-	URL   string
-	Added time.Time
+	URL   string    `json:"url"`
+	Added time.Time `json:"added"`
+	// Origin tells where project came from. Records without origin
+	// were saved before runtime projects appeared and come from config
+	Origin string `json:"origin,omitempty"`
+
+	LastPush *EventRecord `json:"last_push,omitempty"`
+	LastCI   *EventRecord `json:"last_ci,omitempty"`
+	// OpenIssues is taken from the latest GitHub event, nil until
+	// the first event. GitHub counts pull requests as issues
+	OpenIssues *int64 `json:"open_issues,omitempty"`
+}
+
+// Runtime reports whether project was added while the bot was running
+func (p *ProjectData) Runtime() bool {
+	return p.Origin == ProjectOriginRuntime
+}
+
+// Projects returns projects which are allowed to send webhooks: projects
+// from configuration file and projects added at runtime
+func (m *Master) Projects() ([]ProjectData, error) {
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+	return m.projects(m.Config)
+}
+
+func (m *Master) projects(conf *Config) ([]ProjectData, error) {
+	result := []ProjectData{}
+	configured := make(map[string]bool)
+	patterns := []*projectPattern{}
+	if conf != nil {
+		for _, url := range conf.Projects {
+			configured[url] = true
+		}
+		patterns = parseProjectPatterns(conf.Projects)
+	}
+
+	if m.Storage == nil {
+		for url := range configured {
+			result = append(result, ProjectData{URL: url, Origin: ProjectOriginConfig})
+		}
+	} else {
+		stored, err := m.Storage.Projects()
+		if err != nil {
+			return nil, err
+		}
+		for _, project := range stored {
+			if configured[project.URL] {
+				// Project could be added at runtime and then listed in config
+				project.Origin = ProjectOriginConfig
+				result = append(result, project)
+				delete(configured, project.URL)
+				continue
+			}
+			if project.Runtime() {
+				result = append(result, project)
+				continue
+			}
+			// Pattern could be removed from config since the project was saved
+			if project.Origin == ProjectOriginPattern && allowProject(patterns, strings.TrimPrefix(project.URL, "github.com/")) {
+				result = append(result, project)
+			}
+		}
+		for url := range configured {
+			result = append(result, ProjectData{URL: url, Origin: ProjectOriginConfig})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].URL < result[j].URL })
+	return result, nil
+}
+
+// AddProject allows project to send webhooks. Project is kept in the
+// storage, so it survives restarts and configuration reloads
+func (m *Master) AddProject(url string) (*ProjectData, error) {
+	if err := validateProject(url); err != nil {
+		return nil, err
+	}
+
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+
+	if m.Storage == nil {
+		return nil, fmt.Errorf("storage is not available")
+	}
+	projects, err := m.projects(m.Config)
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		if project.URL == url {
+			return nil, ErrProjectExists
+		}
+	}
+
+	project, err := m.Storage.Project(url)
+	if err != nil {
+		return nil, err
+	}
+	if project == nil {
+		// Keep date of a project which was removed from config earlier
+		project = &ProjectData{URL: url, Added: time.Now()}
+	}
+	project.Origin = ProjectOriginRuntime
+	if err := m.Storage.SaveProject(*project); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Project %s added", url)
+	m.applyProjects(m.Config)
+	return project, nil
+}
+
+// RemoveProject forbids webhooks from a project added at runtime.
+// Projects from configuration file can only be removed from the file
+func (m *Master) RemoveProject(url string) error {
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+
+	if m.Config != nil {
+		for _, configured := range m.Config.Projects {
+			if configured == url {
+				return ErrProjectConfigured
+			}
+		}
+	}
+	if m.Storage == nil {
+		return ErrProjectNotFound
+	}
+	project, err := m.Storage.Project(url)
+	if err != nil {
+		return err
+	}
+	if project == nil || !project.Runtime() {
+		return ErrProjectNotFound
+	}
+	if err := m.Storage.DeleteProject(url); err != nil {
+		return err
+	}
+
+	log.Infof("Project %s removed", url)
+	m.applyProjects(m.Config)
+	return nil
+}
+
+// FindProject returns project by URL, owner/repository or repository
+// name when it's unique
+func (m *Master) FindProject(name string) (*ProjectData, error) {
+	projects, err := m.Projects()
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "https://"), "/")
+	found := []ProjectData{}
+	for _, project := range projects {
+		if project.URL == name || strings.TrimPrefix(project.URL, "github.com/") == name {
+			return &project, nil
+		}
+		if path.Base(project.URL) == name {
+			found = append(found, project)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, ErrProjectNotFound
+	case 1:
+		return &found[0], nil
+	}
+	return nil, fmt.Errorf("%d projects are named %s, use owner/repository", len(found), name)
+}
+
+// trackProject remembers last push, CI result and open issues of
+// a project from webhook events
+func (m *Master) trackProject(e Event) error {
+	record := NewEventRecord(e)
+	if record == nil || record.Project == "" {
+		return nil
+	}
+
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+
+	project, err := m.Storage.Project("github.com/" + record.Project)
+	if err != nil {
+		return err
+	}
+	if project == nil {
+		if project = m.patternProject(record.Project); project == nil {
+			return nil
+		}
+		log.Infof("Project %s matched by pattern sent its first event", project.URL)
+	}
+	switch {
+	case e.Source == SourceTravis:
+		project.LastCI = record
+	case e.GitHub.event == Push:
+		project.LastPush = record
+	}
+	if e.GitHub != nil {
+		if count, ok := e.GitHub.openIssues(); ok {
+			project.OpenIssues = &count
+		}
+	}
+	return m.Storage.SaveProject(*project)
+}
+
+// patternProject returns a new record of repository "owner/repository"
+// when it's allowed by a pattern of the configuration. Travis CI events
+// are not verified, so the repository can be unknown
+func (m *Master) patternProject(name string) *ProjectData {
+	if m.Config == nil || !allowProject(parseProjectPatterns(m.Config.Projects), name) {
+		return nil
+	}
+	return &ProjectData{URL: "github.com/" + name, Added: time.Now(), Origin: ProjectOriginPattern}
+}
+
+// applyProjects passes list of projects to webhook receivers
+func (m *Master) applyProjects(conf *Config) {
+	if m.GitHub == nil {
+		return
+	}
+	projects, err := m.projects(conf)
+	if err != nil {
+		log.Errorf("Failed to load projects: %s", err.Error())
+		if conf == nil {
+			return
+		}
+		m.GitHub.SetProjects(conf.Projects)
+		return
+	}
+	urls := []string{}
+	for _, project := range projects {
+		urls = append(urls, project.URL)
+	}
+	m.GitHub.SetProjects(urls)
+}
+
+// syncProjects saves configured projects which are not known to the
+// storage yet, so the date when project was added is remembered
+func (m *Master) syncProjects(projects []string) {
+	for _, url := range projects {
+		// Patterns match many projects, they are not saved
+		if p, err := parseProjectPattern(url); err != nil || !p.exact() {
+			continue
+		}
+		project, err := m.Storage.Project(url)
+		if err != nil {
+			log.Errorf("Failed to load project %s: %s", url, err.Error())
+			continue
+		}
+		if project != nil {
+			continue
+		}
+		project = &ProjectData{URL: url, Added: time.Now(), Origin: ProjectOriginConfig}
+		if err := m.Storage.SaveProject(*project); err != nil {
+			log.Errorf("Failed to save project %s: %s", url, err.Error())
+		}
+	}
+}
+
+// projectCommands returns !projects command family
+func (m *Master) projectCommands() *CommandDef {
+	project := CommandArg{
+		Name:        "project",
+		Description: "Project URL, owner/repository or repository name",
+		Complete:    m.completeProject,
+	}
+	return &CommandDef{
+		Name:    "projects",
+		Aliases: []string{"project"},
+		Usage:   "Manage projects which are allowed to send webhooks",
+		Subcommands: []*CommandDef{
+			{
+				Name:    "list",
+				Usage:   "List projects",
+				Args:    []CommandArg{{Name: "filter", Optional: true, Description: "Show projects containing this text"}},
+				Handler: m.commandProjectsList,
+			},
+			{
+				Name:    "add",
+				Usage:   "Allow project to send webhooks",
+				Args:    []CommandArg{{Name: "url", Description: "Project URL, e.g. github.com/owner/repository"}},
+				Handler: m.commandProjectsAdd,
+				Admin:   true,
+			},
+			{
+				Name:    "remove",
+				Usage:   "Remove project added with !projects add",
+				Args:    []CommandArg{project},
+				Handler: m.commandProjectsRemove,
+				Admin:   true,
+			},
+			{
+				Name:    "info",
+				Usage:   "Show last push, CI result and open issues of a project",
+				Args:    []CommandArg{project},
+				Handler: m.commandProjectsInfo,
+			},
+		},
+	}
+}
+
+func (m *Master) commandProjectsList(ctx *CommandContext) error {
+	projects, err := m.Projects()
+	if err != nil {
+		return err
+	}
+	lines := []string{}
+	for _, project := range projects {
+		if !strings.Contains(project.URL, ctx.String("filter")) {
+			continue
+		}
+		line := project.URL
+		if project.Runtime() {
+			line += " (added at runtime)"
+		}
+		if project.Origin == ProjectOriginPattern {
+			line += " (matched by pattern)"
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ctx.Reply("No projects found")
+	}
+	return ctx.Reply(strings.Join(lines, "\n"))
+}
+
+func (m *Master) commandProjectsAdd(ctx *CommandContext) error {
+	url := strings.TrimSuffix(strings.TrimPrefix(ctx.String("url"), "https://"), "/")
+	project, err := m.AddProject(url)
+	if err != nil {
+		return err
+	}
+	return ctx.Reply(fmt.Sprintf("Project %s added. Configure a webhook in the repository settings to receive events", project.URL))
+}
+
+func (m *Master) commandProjectsRemove(ctx *CommandContext) error {
+	project, err := m.FindProject(ctx.String("project"))
+	if err != nil {
+		return err
+	}
+	if err := m.RemoveProject(project.URL); err != nil {
+		return err
+	}
+	return ctx.Reply(fmt.Sprintf("Project %s removed", project.URL))
+}
+
+func (m *Master) commandProjectsInfo(ctx *CommandContext) error {
+	project, err := m.FindProject(ctx.String("project"))
+	if err != nil {
+		return err
+	}
+	return ctx.ReplyEmbed(projectEmbed(project, time.Now()))
+}
+
+// projectEmbed describes project state
+func projectEmbed(project *ProjectData, now time.Time) *discordgo.MessageEmbed {
+	ago := func(t time.Time) string {
+		return now.Sub(t).Truncate(time.Minute).String() + " ago"
+	}
+
+	added := "unknown"
+	if !project.Added.IsZero() {
+		added = fmt.Sprintf("%s (%s)", project.Added.Format("2006-01-02"), ago(project.Added))
+	}
+	origin := "configuration file"
+	if project.Runtime() {
+		origin = "added at runtime"
+	}
+
+	push := "no pushes yet"
+	if r := project.LastPush; r != nil {
+		push = fmt.Sprintf("[%d commits](%s) to `%s` by %s, %s", r.Commits, r.URL, r.Branch, r.Actor, ago(r.Time))
+		if r.Title != "" {
+			push += "\n" + r.Title
+		}
+	}
+
+	ci := "no builds yet"
+	if r := project.LastCI; r != nil {
+		ci = fmt.Sprintf("[#%d %s](%s) on `%s`, %s", r.Number, r.Result, r.URL, r.Branch, ago(r.Time))
+	}
+
+	issues := "unknown"
+	if project.OpenIssues != nil {
+		issues = strconv.FormatInt(*project.OpenIssues, 10)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: project.URL,
+		URL:   "https://" + project.URL,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Added", Value: added, Inline: true},
+			{Name: "Origin", Value: origin, Inline: true},
+			{Name: "Open Issues and PRs", Value: issues, Inline: true},
+			{Name: "Last Push", Value: push},
+			{Name: "Last CI Build", Value: ci},
+		},
+	}
+}
+
+// completeProject suggests projects containing the value
+func (m *Master) completeProject(value string) []string {
+	projects, err := m.Projects()
+	if err != nil {
+		log.Errorf("Failed to load projects: %s", err.Error())
+		return nil
+	}
+	result := []string{}
+	for _, project := range projects {
+		if strings.Contains(strings.ToLower(project.URL), strings.ToLower(value)) {
+			result = append(result, project.URL)
+		}
+	}
+	return result
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// projectPattern is an entry of the project list: exact
+// "github.com/owner/repository", glob like "github.com/owner/*" or
+// regular expression wrapped in slashes like "/^github\.com/owner/eve/".
+// Entries starting with "!" deny matching projects
+type projectPattern struct {
+	entry string
+	deny  bool
+	// glob matches "owner/repository"
+	glob string
+	// re matches "github.com/owner/repository"
+	re *regexp.Regexp
+}
+
+func parseProjectPattern(entry string) (*projectPattern, error) {
+	p := &projectPattern{entry: entry}
+	if strings.HasPrefix(entry, "!") {
+		p.deny = true
+		entry = entry[1:]
+	}
+
+	if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		re, err := regexp.Compile(entry[1 : len(entry)-1])
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid regular expression: %s", entry, err.Error())
+		}
+		p.re = re
+		return p, nil
+	}
+
+	if !strings.HasPrefix(entry, "github.com/") {
+		return nil, fmt.Errorf("'%s' is not a GitHub project", entry)
+	}
+	p.glob = strings.TrimPrefix(entry, "github.com/")
+	parts := strings.Split(p.glob, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("'%s' must look like github.com/owner/repository", entry)
+	}
+	if err := validateGlob(p.glob); err != nil {
+		return nil, fmt.Errorf("'%s' is not a valid pattern: %s", entry, err.Error())
+	}
+	return p, nil
+}
+
+// exact reports whether entry names a single project
+func (p *projectPattern) exact() bool {
+	return !p.deny && p.re == nil && !strings.ContainsAny(p.glob, "*?[")
+}
+
+// matches reports whether project "owner/repository" matches the pattern
+func (p *projectPattern) matches(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString("github.com/" + name)
+	}
+	return matchGlob(p.glob, name)
+}
+
+// parseProjectPatterns skips invalid entries, configuration validation
+// reports them before they get here
+func parseProjectPatterns(entries []string) []*projectPattern {
+	patterns := []*projectPattern{}
+	for _, entry := range entries {
+		p, err := parseProjectPattern(entry)
+		if err != nil {
+			log.Warnf("Ignoring project %s", err.Error())
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// allowProject reports whether project "owner/repository" matches an
+// allowing pattern and no denying one
+func allowProject(patterns []*projectPattern, name string) bool {
+	allowed := false
+	for _, p := range patterns {
+		if !p.matches(name) {
+			continue
+		}
+		if p.deny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+// payloadRepository returns "owner/repository" of a webhook payload
+// without parsing the rest of it. Empty string is returned on errors
+func payloadRepository(body []byte) string {
+	var payload struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return payload.Repository.FullName
+}
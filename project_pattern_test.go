@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestAllowProject(t *testing.T) {
+	g := new(GitHub)
+	// Short and invalid entries are skipped
+	g.SetProjects([]string{
+		"gh",
+		"",
+		"github.com/savageking-io/*",
+		"!github.com/savageking-io/private-*",
+		`/^github\.com/vozgua/evel.*$/`,
+		"github.com/octocat/hello-world",
+		"/[/",
+	})
+	if len(g.Projects) != 4 {
+		t.Errorf("projects = %v", g.Projects)
+	}
+
+	cases := map[string]bool{
+		"savageking-io/eveleve":       true,
+		"savageking-io/private-notes": false,
+		"savageking-io/eveleve/extra": false,
+		"vozgua/evelengine":           true,
+		"vozgua/other":                false,
+		"octocat/hello-world":         true,
+		"octocat/hello-world2":        false,
+		"gh":                          false,
+	}
+	for name, allowed := range cases {
+		if err := g.verifyProject(name); (err == nil) != allowed {
+			t.Errorf("%s: allowed = %t, want %t", name, err == nil, allowed)
+		}
+	}
+}
+
+func TestParseProjectPattern(t *testing.T) {
+	for _, entry := range []string{"gh", "github.com/owner", "github.com/owner/repo/extra", "gitlab.com/owner/repo", "github.com/owner/[", "/(/"} {
+		if _, err := parseProjectPattern(entry); err == nil {
+			t.Errorf("parseProjectPattern(%q) accepted invalid entry", entry)
+		}
+	}
+	for entry, exact := range map[string]bool{
+		"github.com/owner/repo":    true,
+		"github.com/owner/*":       false,
+		"!github.com/owner/repo":   false,
+		"/^github\\.com/owner/.*/": false,
+	} {
+		p, err := parseProjectPattern(entry)
+		if err != nil {
+			t.Errorf("parseProjectPattern(%q): %s", entry, err.Error())
+			continue
+		}
+		if p.exact() != exact {
+			t.Errorf("%q: exact = %t, want %t", entry, p.exact(), exact)
+		}
+	}
+}
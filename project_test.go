@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopkg.in/go-playground/webhooks.v5/github"
+)
+
+func testMaster(t *testing.T) (*Master, func()) {
+	storage, cleanup := testStorage(t)
+	m := &Master{
+		Config:  &Config{Projects: []string{"github.com/savageking-io/eveleve"}},
+		Storage: storage,
+		GitHub:  new(GitHub),
+	}
+	m.syncProjects(m.Config.Projects)
+	m.applyProjects(m.Config)
+	return m, cleanup
+}
+
+func TestMaster_AddProject(t *testing.T) {
+	m, cleanup := testMaster(t)
+	defer cleanup()
+
+	if err := m.GitHub.verifyProject("savageking-io/evelengine"); err == nil {
+		t.Fatalf("Project is accepted before it was added")
+	}
+	if _, err := m.AddProject("github.com/savageking-io/evelengine"); err != nil {
+		t.Fatalf("AddProject failed: %s", err.Error())
+	}
+	if err := m.GitHub.verifyProject("savageking-io/evelengine"); err != nil {
+		t.Errorf("Added project is not accepted by GitHub receiver")
+	}
+
+	// Runtime projects survive configuration reload
+	m.applyProjects(&Config{Projects: []string{"github.com/savageking-io/eveleve"}})
+	if err := m.GitHub.verifyProject("savageking-io/evelengine"); err != nil {
+		t.Errorf("Added project is lost after reload")
+	}
+
+	if err := m.RemoveProject("github.com/savageking-io/eveleve"); err != ErrProjectConfigured {
+		t.Errorf("RemoveProject of configured project = %v, want %v", err, ErrProjectConfigured)
+	}
+	if err := m.RemoveProject("github.com/savageking-io/evelengine"); err != nil {
+		t.Fatalf("RemoveProject failed: %s", err.Error())
+	}
+	if err := m.GitHub.verifyProject("savageking-io/evelengine"); err == nil {
+		t.Errorf("Removed project is still accepted")
+	}
+}
+
+func TestMaster_FindProject(t *testing.T) {
+	m, cleanup := testMaster(t)
+	defer cleanup()
+	m.AddProject("github.com/savageking-io/evelengine")
+	m.AddProject("github.com/other/evelengine")
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"github.com/savageking-io/eveleve", "github.com/savageking-io/eveleve"},
+		{"https://github.com/savageking-io/eveleve/", "github.com/savageking-io/eveleve"},
+		{"savageking-io/evelengine", "github.com/savageking-io/evelengine"},
+		{"eveleve", "github.com/savageking-io/eveleve"},
+		{"evelengine", ""},
+		{"unknown", ""},
+	}
+	for _, tt := range tests {
+		project, err := m.FindProject(tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("FindProject(%s) = %s, want error", tt.name, project.URL)
+			}
+			continue
+		}
+		if err != nil || project.URL != tt.want {
+			t.Errorf("FindProject(%s) = %v, %v, want %s", tt.name, project, err, tt.want)
+		}
+	}
+}
+
+func TestMaster_TrackProject(t *testing.T) {
+	m, cleanup := testMaster(t)
+	defer cleanup()
+
+	var push github.PushPayload
+	err := json.Unmarshal([]byte(`{
+		"ref": "refs/heads/master",
+		"compare": "https://github.com/savageking-io/eveleve/compare/a...b",
+		"commits": [{"message": "first"}, {"message": "second"}],
+		"repository": {"full_name": "savageking-io/eveleve", "open_issues_count": 3},
+		"sender": {"login": "savageking"}
+	}`), &push)
+	if err != nil {
+		t.Fatalf("Failed to parse push payload: %s", err.Error())
+	}
+
+	build := &TravisPacket{Number: "12", Branch: "master", StatusMessage: "Passed", State: "passed"}
+	build.Repository.OwnerName = "savageking-io"
+	build.Repository.Name = "eveleve"
+
+	now := time.Now()
+	events := []Event{
+		{Source: SourceGitHub, Time: now, GitHub: &GitHubEvent{event: Push, push: push}},
+		{Source: SourceTravis, Time: now, Travis: build},
+	}
+	for _, e := range events {
+		if err := m.trackProject(e); err != nil {
+			t.Fatalf("trackProject failed: %s", err.Error())
+		}
+	}
+
+	project, err := m.FindProject("eveleve")
+	if err != nil {
+		t.Fatalf("FindProject failed: %s", err.Error())
+	}
+	if project.LastPush == nil || project.LastPush.Branch != "master" || project.LastPush.Commits != 2 {
+		t.Errorf("Unexpected last push: %+v", project.LastPush)
+	}
+	if project.LastCI == nil || project.LastCI.Number != 12 || project.LastCI.Result != "passed" {
+		t.Errorf("Unexpected last CI build: %+v", project.LastCI)
+	}
+	if project.OpenIssues == nil || *project.OpenIssues != 3 {
+		t.Errorf("Unexpected open issues: %v", project.OpenIssues)
+	}
+}
+
+func TestMaster_TrackPatternProject(t *testing.T) {
+	m, cleanup := testMaster(t)
+	defer cleanup()
+	m.Config.Projects = append(m.Config.Projects, "github.com/org/*", "!github.com/org/secret")
+
+	for _, name := range []string{"game", "secret"} {
+		build := &TravisPacket{Number: "3", State: "passed"}
+		build.Repository.OwnerName = "org"
+		build.Repository.Name = name
+		if err := m.trackProject(Event{Source: SourceTravis, Time: time.Now(), Travis: build}); err != nil {
+			t.Fatalf("trackProject failed: %s", err.Error())
+		}
+	}
+
+	project, err := m.FindProject("game")
+	if err != nil {
+		t.Fatalf("FindProject failed: %s", err.Error())
+	}
+	if project.URL != "github.com/org/game" || project.Origin != ProjectOriginPattern || project.LastCI == nil {
+		t.Errorf("Unexpected project matched by pattern: %+v", project)
+	}
+	if _, err := m.FindProject("org/secret"); err != ErrProjectNotFound {
+		t.Errorf("Denied project was saved: %v", err)
+	}
+
+	// Project is hidden when its pattern is removed
+	m.Config.Projects = m.Config.Projects[:1]
+	if _, err := m.FindProject("game"); err != ErrProjectNotFound {
+		t.Errorf("Project of removed pattern is still listed: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ReloadReport describes configuration changes found during reload
+type ReloadReport struct {
+	Applied         []string
+	RestartRequired []string
+}
+
+func (r *ReloadReport) String() string {
+	if len(r.Applied) == 0 && len(r.RestartRequired) == 0 {
+		return "Configuration reloaded: no changes"
+	}
+	text := "Configuration reloaded"
+	if len(r.Applied) > 0 {
+		text += "\nApplied: " + strings.Join(r.Applied, ", ")
+	}
+	if len(r.RestartRequired) > 0 {
+		text += "\nRestart required: " + strings.Join(r.RestartRequired, ", ")
+	}
+	return text
+}
+
+// Reload re-reads configuration file and applies every setting that
+// can be changed while the bot is running
+func (m *Master) Reload() (*ReloadReport, error) {
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+
+	if m.Config == nil {
+		return nil, fmt.Errorf("no active configuration")
+	}
+
+	conf := new(Config)
+	if err := conf.Init(m.ConfigFile); err != nil {
+		return nil, err
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid configuration: %s", err.Error())
+	}
+
+	report := diffConfig(m.Config, conf)
+	if err := m.applyConfig(conf); err != nil {
+		return nil, err
+	}
+	m.Config = conf
+
+	log.Infof("%s", report.String())
+	return report, nil
+}
+
+// reload is used by SIGHUP handler and admin command to reload
+// configuration and report result into the log channel
+func (m *Master) reload() string {
+	var text string
+	report, err := m.Reload()
+	if err != nil {
+		log.Errorf("Failed to reload configuration: %s", err.Error())
+		text = fmt.Sprintf("Failed to reload configuration: %s", err.Error())
+	} else {
+		text = report.String()
+	}
+	if m.Discord != nil {
+		m.Discord.sendLog(text)
+	}
+	return text
+}
+
+// applyConfig prepares everything which can fail before changing any
+// setting, so a failed reload leaves the running configuration intact
+func (m *Master) applyConfig(conf *Config) error {
+	hook, err := newWebhook(conf.GitHub.Secret)
+	if err != nil {
+		return err
+	}
+	secrets, err := newProjectSecrets(conf.GitHub.Secrets)
+	if err != nil {
+		return err
+	}
+	key, err := appKey(conf.GitHub.API)
+	if err != nil {
+		return err
+	}
+
+	if m.GitHub != nil {
+		m.GitHub.setWebhook(hook)
+		m.GitHub.setProjectSecrets(secrets)
+	}
+	if m.GitHubAPI != nil {
+		m.GitHubAPI.setConfig(conf.GitHub.API, key)
+	}
+	if m.Storage != nil {
+		m.syncProjects(conf.Projects)
+	}
+	m.applyProjects(conf)
+	if m.Travis != nil {
+		m.Travis.SetConfig(&conf.Travis)
+	}
+	if m.Discord != nil {
+		m.Discord.SetChannels(conf.Discord)
+	}
+	if m.Status != nil {
+		m.Status.SetChannel(conf.Discord.StatusChannel)
+	}
+	if m.Notifications != nil {
+		m.Notifications.SetTemplates(conf.Notifications)
+		m.Notifications.SetRoutes(conf.Routes)
+		m.Notifications.SetPushWindow(conf.Push.Window)
+		m.Notifications.SetPushFilters(conf.Push.Filters)
+	}
+	if m.Digests != nil {
+		m.Digests.SetDigests(conf.Digests)
+	}
+	if m.API != nil {
+		m.API.SetToken(conf.API.Token)
+	}
+	if m.Permissions != nil {
+		m.Permissions.SetConfig(conf.Permissions)
+	}
+	return nil
+}
+
+// diffConfig compares two configurations. Settings which can't be
+// applied without restart are copied from the old configuration, so
+// they are reported again until the bot is restarted
+func diffConfig(old, conf *Config) *ReloadReport {
+	report := new(ReloadReport)
+	applied := func(name string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			report.Applied = append(report.Applied, name)
+		}
+	}
+	restart := func(name string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			report.RestartRequired = append(report.RestartRequired, name)
+		}
+	}
+
+	applied("projects", old.Projects, conf.Projects)
+	applied("github.secret", old.GitHub.Secret, conf.GitHub.Secret)
+	applied("github.secrets", old.GitHub.Secrets, conf.GitHub.Secrets)
+	applied("github.api", old.GitHub.API, conf.GitHub.API)
+	applied("travis.api", old.Travis.API, conf.Travis.API)
+	applied("discord.log_channel", old.Discord.LogChannel, conf.Discord.LogChannel)
+	applied("discord.event_channel", old.Discord.EventChannel, conf.Discord.EventChannel)
+	applied("discord.status_channel", old.Discord.StatusChannel, conf.Discord.StatusChannel)
+	applied("discord.board_channel", old.Discord.BoardChannel, conf.Discord.BoardChannel)
+	applied("shutdown", old.Shutdown, conf.Shutdown)
+	applied("notifications", old.Notifications, conf.Notifications)
+	applied("api.token", old.API.Token, conf.API.Token)
+	applied("permissions", old.Permissions, conf.Permissions)
+	applied("routes", old.Routes, conf.Routes)
+	applied("push.window", old.Push.Window, conf.Push.Window)
+	applied("push.filters", old.Push.Filters, conf.Push.Filters)
+	applied("digests", old.Digests, conf.Digests)
+
+	restart("http", old.HTTP, conf.HTTP)
+	restart("tls", old.TLS, conf.TLS)
+	restart("github.uri", old.GitHub.URI, conf.GitHub.URI)
+	restart("github.max_body_size", old.GitHub.MaxBodySize, conf.GitHub.MaxBodySize)
+	restart("travis.uri", old.Travis.URI, conf.Travis.URI)
+	restart("travis.max_body_size", old.Travis.MaxBodySize, conf.Travis.MaxBodySize)
+	restart("discord.token", old.Discord.Token, conf.Discord.Token)
+	restart("discord.guilds", old.Discord.Guilds, conf.Discord.Guilds)
+	restart("storage", old.Storage, conf.Storage)
+	restart("api.address", old.API.Address, conf.API.Address)
+	restart("api.port", old.API.Port, conf.API.Port)
+
+	conf.HTTP = old.HTTP
+	conf.TLS = old.TLS
+	conf.GitHub.URI = old.GitHub.URI
+	conf.GitHub.MaxBodySize = old.GitHub.MaxBodySize
+	conf.Travis.URI = old.Travis.URI
+	conf.Travis.MaxBodySize = old.Travis.MaxBodySize
+	conf.Discord.Token = old.Discord.Token
+	conf.Discord.Guilds = old.Discord.Guilds
+	conf.Storage = old.Storage
+	conf.API.Address = old.API.Address
+	conf.API.Port = old.API.Port
+
+	return report
+}
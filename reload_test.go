@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffConfig(t *testing.T) {
+	old := &Config{
+		Projects: []string{"github.com/savageking-io/eveleve"},
+		Discord: DiscordConfig{
+			Token:         "token",
+			LogChannel:    "1",
+			EventChannel:  "2",
+			StatusChannel: "3",
+		},
+		HTTP: HTTPConfig{Port: 1280},
+	}
+	conf := &Config{
+		Projects: []string{"github.com/savageking-io/eveleve", "github.com/savageking-io/evelengine"},
+		Discord: DiscordConfig{
+			Token:         "new-token",
+			LogChannel:    "1",
+			EventChannel:  "20",
+			StatusChannel: "3",
+		},
+		HTTP: HTTPConfig{Port: 1281},
+	}
+
+	report := diffConfig(old, conf)
+
+	wantApplied := []string{"projects", "discord.event_channel"}
+	if !reflect.DeepEqual(report.Applied, wantApplied) {
+		t.Errorf("Applied = %v, want %v", report.Applied, wantApplied)
+	}
+	wantRestart := []string{"http", "discord.token"}
+	if !reflect.DeepEqual(report.RestartRequired, wantRestart) {
+		t.Errorf("RestartRequired = %v, want %v", report.RestartRequired, wantRestart)
+	}
+	if conf.HTTP.Port != 1280 || conf.Discord.Token != "token" {
+		t.Errorf("Restart required settings were not kept: %+v", conf)
+	}
+	if conf.Discord.EventChannel != "20" {
+		t.Errorf("Live setting was overwritten: %s", conf.Discord.EventChannel)
+	}
+}
+
+func TestMaster_ApplyConfigFailure(t *testing.T) {
+	g := new(GitHub)
+	if err := g.SetSecret("old"); err != nil {
+		t.Fatalf("SetSecret: %s", err.Error())
+	}
+	hook := g.hook
+	m := &Master{GitHub: g}
+
+	filename := filepath.Join(t.TempDir(), "app.pem")
+	if err := ioutil.WriteFile(filename, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("Failed to write key: %s", err.Error())
+	}
+	conf := &Config{GitHub: GitHubConfig{
+		Secret:  "new",
+		Secrets: []ProjectSecret{{Projects: []string{"github.com/savageking-io/*"}, Secret: "project"}},
+		API:     GitHubAPIConfig{AppID: 1, InstallationID: 2, PrivateKey: filename},
+	}}
+	if err := m.applyConfig(conf); err == nil {
+		t.Fatalf("Configuration with invalid GitHub App key was applied")
+	}
+	if g.hook != hook || len(g.secrets) != 0 {
+		t.Errorf("Failed reload changed webhook secrets")
+	}
+}
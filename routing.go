@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// routingEvents returns event names accepted by routing rules
+func routingEvents() []string {
+	events := []string{}
+	for t := CommitComment; t <= Security; t++ {
+		events = append(events, t.String())
+	}
+	return append(events, "build")
+}
+
+// validateGlob checks pattern syntax
+func validateGlob(pattern string) error {
+	_, err := path.Match(pattern, "")
+	return err
+}
+
+// matchGlob reports whether value matches shell pattern. "**" matches
+// any number of path elements, e.g. "docs/**" or "**/*.md". Invalid
+// patterns match nothing
+func matchGlob(pattern, value string) bool {
+	if !strings.Contains(pattern, "**") {
+		matched, err := path.Match(pattern, value)
+		return err == nil && matched
+	}
+	return matchElements(strings.Split(pattern, "/"), strings.Split(value, "/"))
+}
+
+func matchElements(pattern, value []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(value); i++ {
+				if matchElements(pattern[1:], value[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(value) == 0 {
+			return false
+		}
+		matched, err := path.Match(pattern[0], value[0])
+		if err != nil || !matched {
+			return false
+		}
+		pattern, value = pattern[1:], value[1:]
+	}
+	return len(value) == 0
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether event record satisfies every condition of the
+// rule. Events without project, branch or labels don't match rules which
+// require them
+func (r *RoutingRule) matches(record *EventRecord) bool {
+	if len(r.Events) > 0 && !containsString(r.Events, record.Type) {
+		return false
+	}
+	if len(r.Actions) > 0 && !containsString(r.Actions, record.Action) {
+		return false
+	}
+	if len(r.Projects) > 0 && !matchAny(r.Projects, record.Project) &&
+		!matchAny(r.Projects, "github.com/"+record.Project) {
+		return false
+	}
+	if len(r.Branches) > 0 && !matchAny(r.Branches, record.Branch) {
+		return false
+	}
+	if len(r.Labels) > 0 {
+		found := false
+		for _, label := range record.Labels {
+			if matchAny(r.Labels, label) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchRoutes returns rules matching the event record
+func matchRoutes(rules []RoutingRule, record *EventRecord) []RoutingRule {
+	result := []RoutingRule{}
+	for _, rule := range rules {
+		if rule.matches(record) {
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// routeChannels returns channels of every matching rule without
+// duplicates or fallback channel when nothing matches
+func routeChannels(rules []RoutingRule, record *EventRecord, fallback string) []string {
+	channels := []string{}
+	if record != nil {
+		for _, rule := range matchRoutes(rules, record) {
+			for _, channel := range rule.Channels {
+				if !containsString(channels, channel) {
+					channels = append(channels, channel)
+				}
+			}
+		}
+	}
+	if len(channels) == 0 {
+		channels = append(channels, fallback)
+	}
+	return channels
+}
+
+// routeCommands returns !routes command family
+func (m *Master) routeCommands() *CommandDef {
+	return &CommandDef{
+		Name:  "routes",
+		Usage: "Show notification routing rules",
+		Subcommands: []*CommandDef{
+			{
+				Name:    "list",
+				Usage:   "List routing rules",
+				Handler: m.commandRoutesList,
+			},
+			{
+				Name:  "test",
+				Usage: "Show which routing rules match an event",
+				Args: []CommandArg{
+					{Name: "event", Description: "Event name, e.g. push or pull_request", Complete: completeEvent},
+					{
+						Name:        "filters",
+						Type:        ArgText,
+						Optional:    true,
+						Description: "Event details, e.g. project=owner/repository action=opened branch=master label=bug",
+					},
+				},
+				Handler: m.commandRoutesTest,
+			},
+		},
+	}
+}
+
+func (m *Master) routes() []RoutingRule {
+	m.reloadMutex.Lock()
+	defer m.reloadMutex.Unlock()
+	if m.Config == nil {
+		return nil
+	}
+	return m.Config.Routes
+}
+
+func (m *Master) commandRoutesList(ctx *CommandContext) error {
+	rules := m.routes()
+	if len(rules) == 0 {
+		return ctx.Reply("No routing rules, every notification goes to the event channel")
+	}
+	lines := []string{}
+	for i, rule := range rules {
+		lines = append(lines, describeRoute(i, rule))
+	}
+	return ctx.Reply(strings.Join(lines, "\n"))
+}
+
+func (m *Master) commandRoutesTest(ctx *CommandContext) error {
+	event := ctx.String("event")
+	if !containsString(routingEvents(), event) {
+		return &CommandError{Def: ctx.Def, Message: fmt.Sprintf("unknown event '%s'", event)}
+	}
+	record := &EventRecord{Type: event}
+	for _, filter := range strings.Fields(ctx.String("filters")) {
+		parts := strings.SplitN(filter, "=", 2)
+		if len(parts) != 2 {
+			return &CommandError{Def: ctx.Def, Message: fmt.Sprintf("filter '%s' must look like name=value", filter)}
+		}
+		switch parts[0] {
+		case "project":
+			record.Project = strings.TrimPrefix(parts[1], "github.com/")
+		case "action":
+			record.Action = parts[1]
+		case "branch":
+			record.Branch = parts[1]
+		case "label":
+			record.Labels = append(record.Labels, parts[1])
+		default:
+			return &CommandError{Def: ctx.Def, Message: fmt.Sprintf("unknown filter '%s'", parts[0])}
+		}
+	}
+
+	rules := m.routes()
+	lines := []string{}
+	for i, rule := range rules {
+		if rule.matches(record) {
+			lines = append(lines, describeRoute(i, rule))
+		}
+	}
+	if len(lines) == 0 {
+		fallback := "event channel"
+		if m.Discord != nil {
+			fallback = fmt.Sprintf("<#%s>", m.Discord.eventChannel())
+		}
+		return ctx.Reply("No rules match, notification goes to the " + fallback)
+	}
+	return ctx.Reply("Matching rules:\n" + strings.Join(lines, "\n"))
+}
+
+// describeRoute formats rule as a single line
+func describeRoute(i int, rule RoutingRule) string {
+	name := rule.Name
+	if name == "" {
+		name = fmt.Sprintf("#%d", i+1)
+	}
+	conditions := []string{}
+	for _, c := range []struct {
+		name   string
+		values []string
+	}{
+		{"projects", rule.Projects},
+		{"events", rule.Events},
+		{"actions", rule.Actions},
+		{"branches", rule.Branches},
+		{"labels", rule.Labels},
+	} {
+		if len(c.values) > 0 {
+			conditions = append(conditions, c.name+": "+strings.Join(c.values, ", "))
+		}
+	}
+	if len(conditions) == 0 {
+		conditions = append(conditions, "everything")
+	}
+	channels := []string{}
+	for _, channel := range rule.Channels {
+		channels = append(channels, "<#"+channel+">")
+	}
+	return fmt.Sprintf("**%s** %s → %s", name, strings.Join(conditions, "; "), strings.Join(channels, " "))
+}
+
+// completeEvent suggests event names containing the value
+func completeEvent(value string) []string {
+	result := []string{}
+	for _, event := range routingEvents() {
+		if strings.Contains(event, strings.ToLower(value)) {
+			result = append(result, event)
+		}
+	}
+	return result
+}
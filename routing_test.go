@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoutingRule_Matches(t *testing.T) {
+	rules := []RoutingRule{
+		{Name: "security", Events: []string{"security_advisory", "repository_vulnerability_alert"}, Channels: []string{"1"}},
+		{Name: "releases", Events: []string{"release"}, Actions: []string{"published"}, Channels: []string{"2"}},
+		{Name: "eveleve", Projects: []string{"github.com/savageking-io/*"}, Branches: []string{"master", "release/*"}, Channels: []string{"3"}},
+		{Name: "bugs", Events: []string{"issues"}, Labels: []string{"bug*"}, Channels: []string{"3", "4"}},
+	}
+
+	cases := []struct {
+		record   EventRecord
+		channels []string
+	}{
+		{EventRecord{Type: "security_advisory", Action: "published"}, []string{"1"}},
+		{EventRecord{Type: "release", Action: "published", Project: "savageking-io/eveleve", Branch: "master"}, []string{"2", "3"}},
+		{EventRecord{Type: "release", Action: "created", Project: "other/project"}, []string{"0"}},
+		{EventRecord{Type: "push", Project: "savageking-io/eveleve", Branch: "release/1.0"}, []string{"3"}},
+		{EventRecord{Type: "push", Project: "savageking-io/eveleve", Branch: "feature/bus"}, []string{"0"}},
+		{EventRecord{Type: "issues", Project: "savageking-io/eveleve", Labels: []string{"question", "bug-report"}}, []string{"3", "4"}},
+		{EventRecord{Type: "issues", Project: "other/project", Labels: []string{"question"}}, []string{"0"}},
+	}
+	for _, c := range cases {
+		record := c.record
+		if channels := routeChannels(rules, &record, "0"); !reflect.DeepEqual(channels, c.channels) {
+			t.Errorf("%+v routed to %v, want %v", c.record, channels, c.channels)
+		}
+	}
+}
+
+func TestConfig_ValidateRoutes(t *testing.T) {
+	conf := new(Config)
+	conf.Routes = []RoutingRule{
+		{Name: "ok", Events: []string{"build", "push"}, Projects: []string{"savageking-io/*"}, Channels: []string{"123456789012345678"}},
+		{Name: "broken", Events: []string{"pushes"}, Branches: []string{"release/["}, Channels: []string{"#general"}},
+		{Labels: []string{"bug"}},
+	}
+	errs := ConfigErrors{}
+	conf.validateRoutes(&errs)
+	if len(errs) != 4 {
+		t.Errorf("Expected 4 errors, got %d: %v", len(errs), errs)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		value   string
+		matched bool
+	}{
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/fix", false},
+		{"dependabot/**", "dependabot/npm/lodash", true},
+		{".github/**", ".github/workflows/ci.yml", true},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/setup/index.md", true},
+		{"**/*.md", "docs/setup/index.go", false},
+		{"docs/**/index.md", "docs/index.md", true},
+		{"docs/**/index.md", "src/docs/index.md", false},
+		{"[", "[", false},
+	}
+	for _, c := range cases {
+		if matched := matchGlob(c.pattern, c.value); matched != c.matched {
+			t.Errorf("matchGlob(%q, %q) = %t, want %t", c.pattern, c.value, matched, c.matched)
+		}
+	}
+}
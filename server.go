@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultMaxBodySize limits request body when route doesn't specify its own limit
+const DefaultMaxBodySize = 1 << 20
+
+// Route is a named HTTP handler registered on the server
+type Route struct {
+	Name        string
+	Path        string
+	MaxBodySize int64
+	Handler     http.Handler
+}
+
+// Server is a single HTTP(S) listener shared by every webhook receiver.
+// It owns its mux, so integrations only see routes registered on it
+type Server struct {
+	conf     HTTPConfig
+	mux      *http.ServeMux
+	server   *http.Server
+	listener net.Listener
+
+	mutex  sync.RWMutex
+	routes []*Route
+}
+
+// Init starts listening on the configured port, so a busy port is
+// reported during startup. Requests are served after Run is called
+func (s *Server) Init(conf HTTPConfig, tlsc TLSConfig) error {
+	address := fmt.Sprintf("%s:%d", conf.Address, conf.Port)
+	log.Infof("Preparing HTTP server at %s", address)
+	s.conf = conf
+	s.mux = http.NewServeMux()
+	s.server = &http.Server{
+		Handler:      s.mux,
+		ReadTimeout:  conf.ReadTimeout,
+		WriteTimeout: conf.WriteTimeout,
+	}
+
+	if !conf.Plain {
+		cert, err := tls.LoadX509KeyPair(tlsc.Cert, tlsc.Key)
+		if err != nil {
+			return fmt.Errorf("Failed to load TLS certificate: %s", err.Error())
+		}
+		s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.server.Addr = listener.Addr().String()
+	return nil
+}
+
+// Register adds a new route. Route names and paths must be unique
+func (s *Server) Register(route Route) error {
+	if route.Handler == nil {
+		return fmt.Errorf("route %s has no handler", route.Name)
+	}
+	if !strings.HasPrefix(route.Path, "/") {
+		return fmt.Errorf("route %s has invalid path '%s'", route.Name, route.Path)
+	}
+	if route.MaxBodySize <= 0 {
+		route.MaxBodySize = s.conf.MaxBodySize
+	}
+	if route.MaxBodySize <= 0 {
+		route.MaxBodySize = DefaultMaxBodySize
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, r := range s.routes {
+		if r.Name == route.Name {
+			return fmt.Errorf("route %s is already registered", route.Name)
+		}
+		if r.Path == route.Path {
+			return fmt.Errorf("path %s is already used by route %s", route.Path, r.Name)
+		}
+	}
+
+	s.routes = append(s.routes, &route)
+	s.mux.Handle(route.Path, s.wrap(&route))
+	log.Infof("Registered HTTP route %s at %s", route.Name, route.Path)
+	return nil
+}
+
+// Routes returns every registered route
+func (s *Server) Routes() []Route {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	result := []Route{}
+	for _, r := range s.routes {
+		result = append(result, *r)
+	}
+	return result
+}
+
+// Run serves requests until Stop is called
+func (s *Server) Run() error {
+	var err error
+	if s.conf.Plain {
+		log.Infof("Serving plain HTTP at %s", s.server.Addr)
+		err = s.server.Serve(s.listener)
+	} else {
+		log.Infof("Serving HTTPS at %s", s.server.Addr)
+		err = s.server.ServeTLS(s.listener, "", "")
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Errorf("HTTP server failed: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// Stop stops accepting new requests and waits for active ones
+func (s *Server) Stop(ctx context.Context) error {
+	log.Infof("Stopping HTTP server at %s", s.server.Addr)
+	return s.server.Shutdown(ctx)
+}
+
+// wrap limits request body and logs every request
+func (s *Server) wrap(route *Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r.Body = http.MaxBytesReader(w, r.Body, route.MaxBodySize)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		route.Handler.ServeHTTP(rec, r)
+
+		log.Infof("%s %s %s %d %s [%s] %s", s.remoteAddr(r), r.Method, r.URL.Path, rec.status,
+			time.Since(start).Truncate(time.Microsecond), route.Name, r.UserAgent())
+	})
+}
+
+// bodyTooLarge reports whether request body couldn't be read because it's
+// over the limit set by wrap
+func bodyTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "request body too large")
+}
+
+// remoteAddr returns client address. When the server is behind a reverse
+// proxy the address is taken from the X-Forwarded-For header
+func (s *Server) remoteAddr(r *http.Request) string {
+	if s.conf.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	return r.RemoteAddr
+}
+
+// statusRecorder remembers status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
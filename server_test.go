@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServer_Routes(t *testing.T) {
+	server := new(Server)
+	if err := server.Init(HTTPConfig{Address: "127.0.0.1", Plain: true}, TLSConfig{}); err != nil {
+		t.Fatalf("Init failed: %s", err.Error())
+	}
+	go server.Run()
+	defer server.Stop(context.Background())
+
+	echo := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			fmt.Fprintf(w, "%s:%s", name, body)
+		})
+	}
+
+	if err := server.Register(Route{Name: "github", Path: "/github", Handler: echo("github")}); err != nil {
+		t.Fatalf("Register failed: %s", err.Error())
+	}
+	if err := server.Register(Route{Name: "travis", Path: "/travis", MaxBodySize: 4, Handler: echo("travis")}); err != nil {
+		t.Fatalf("Register failed: %s", err.Error())
+	}
+	if err := server.Register(Route{Name: "github", Path: "/other", Handler: echo("other")}); err == nil {
+		t.Errorf("Route with duplicate name was registered")
+	}
+	if err := server.Register(Route{Name: "other", Path: "/travis", Handler: echo("other")}); err == nil {
+		t.Errorf("Route with duplicate path was registered")
+	}
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"/github", "push", http.StatusOK, "github:push"},
+		{"/travis", "ok", http.StatusOK, "travis:ok"},
+		{"/travis", "too large", http.StatusRequestEntityTooLarge, ""},
+		{"/unknown", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Post("http://"+server.server.Addr+tt.path, "text/plain", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Request failed: %s", err.Error())
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("Status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.want != "" && string(body) != tt.want {
+				t.Errorf("Body = %s, want %s", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxSlashChoices is the amount of autocomplete suggestions accepted by Discord
+const maxSlashChoices = 25
+
+// SlashCommands registers commands of the router as Discord application
+// commands. Interactions are passed to the same handlers as ! commands
+type SlashCommands struct {
+	discord *Discord
+	router  *CommandRouter
+	bus     *Bus
+}
+
+// Init registers application commands in every guild from the list.
+// Commands are registered globally when list is empty, which may take
+// up to an hour to reach clients
+func (s *SlashCommands) Init(discord *Discord, router *CommandRouter, bus *Bus, guilds []string) error {
+	if discord == nil {
+		return fmt.Errorf("nil discord")
+	}
+	if router == nil {
+		return fmt.Errorf("nil command router")
+	}
+	if bus == nil {
+		return fmt.Errorf("nil bus")
+	}
+	s.discord = discord
+	s.router = router
+	s.bus = bus
+
+	commands := []*discordgo.ApplicationCommand{}
+	for _, def := range router.Commands() {
+		command, err := slashCommand(def)
+		if err != nil {
+			log.Warnf("Command %s can't be used as a slash command: %s", def.Name, err.Error())
+			continue
+		}
+		commands = append(commands, command)
+	}
+
+	if len(guilds) == 0 {
+		guilds = []string{""}
+	}
+	appID := discord.Session.State.User.ID
+	for _, guild := range guilds {
+		if _, err := discord.Session.ApplicationCommandBulkOverwrite(appID, guild, commands); err != nil {
+			return fmt.Errorf("Failed to register slash commands in guild '%s': %s", guild, err.Error())
+		}
+		log.Infof("Registered %d slash commands in guild '%s'", len(commands), guild)
+	}
+
+	discord.Session.AddHandler(s.interactionCreate)
+	return nil
+}
+
+// slashCommand converts command definition into an application command.
+// Subcommands with own subcommands become subcommand groups
+func slashCommand(def *CommandDef) (*discordgo.ApplicationCommand, error) {
+	options, err := slashOptions(def, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &discordgo.ApplicationCommand{
+		Name:        def.Name,
+		Description: slashDescription(def.Usage, def.Name),
+		Options:     options,
+	}, nil
+}
+
+func slashOptions(def *CommandDef, depth int) ([]*discordgo.ApplicationCommandOption, error) {
+	options := []*discordgo.ApplicationCommandOption{}
+	if len(def.Subcommands) > 0 {
+		if depth >= 2 {
+			return nil, fmt.Errorf("%s is nested too deep", def.Path())
+		}
+		for _, sub := range def.Subcommands {
+			subOptions, err := slashOptions(sub, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			kind := discordgo.ApplicationCommandOptionSubCommand
+			if len(sub.Subcommands) > 0 {
+				kind = discordgo.ApplicationCommandOptionSubCommandGroup
+			}
+			options = append(options, &discordgo.ApplicationCommandOption{
+				Type:        kind,
+				Name:        sub.Name,
+				Description: slashDescription(sub.Usage, sub.Name),
+				Options:     subOptions,
+			})
+		}
+		return options, nil
+	}
+
+	for _, arg := range def.Args {
+		kind := discordgo.ApplicationCommandOptionString
+		if arg.Type == ArgInt {
+			kind = discordgo.ApplicationCommandOptionInteger
+		}
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Type:         kind,
+			Name:         arg.Name,
+			Description:  slashDescription(arg.Description, arg.Name),
+			Required:     !arg.Optional,
+			Autocomplete: arg.Complete != nil,
+		})
+	}
+	return options, nil
+}
+
+// slashDescription returns text which fits Discord limit of 100 characters
+func slashDescription(text, fallback string) string {
+	if text == "" {
+		text = fallback
+	}
+	if len(text) > 100 {
+		text = text[:97] + "..."
+	}
+	return text
+}
+
+// slashArgs extracts subcommand path and argument values from interaction
+// options. Focused option is returned during autocomplete
+func slashArgs(options []*discordgo.ApplicationCommandInteractionDataOption) ([]string, map[string]string, *discordgo.ApplicationCommandInteractionDataOption) {
+	path := []string{}
+	for len(options) == 1 && (options[0].Type == discordgo.ApplicationCommandOptionSubCommand ||
+		options[0].Type == discordgo.ApplicationCommandOptionSubCommandGroup) {
+		path = append(path, options[0].Name)
+		options = options[0].Options
+	}
+
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	values := make(map[string]string)
+	for _, option := range options {
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionInteger:
+			if option.Focused {
+				// Partial numbers are sent as strings during autocomplete
+				values[option.Name] = fmt.Sprint(option.Value)
+			} else {
+				values[option.Name] = strconv.FormatInt(option.IntValue(), 10)
+			}
+		default:
+			values[option.Name] = fmt.Sprint(option.Value)
+		}
+		if option.Focused {
+			focused = option
+		}
+	}
+	return path, values, focused
+}
+
+func (s *SlashCommands) interactionCreate(session *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		s.command(session, i)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		s.autocomplete(session, i)
+	}
+}
+
+// command acknowledges interaction right away, because Discord waits
+// for 3 seconds only, and passes command to the router through the bus
+func (s *SlashCommands) command(session *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Errorf("Failed to acknowledge interaction: %s", err.Error())
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	path, values, _ := slashArgs(data.Options)
+	c := &Command{
+		Text:      "/" + strings.Join(append([]string{data.Name}, path...), " "),
+		Cmd:       data.Name,
+		Params:    path,
+		Options:   values,
+		ChannelID: i.ChannelID,
+		GuildID:   i.GuildID,
+		AuthorID:  interactionUser(i.Interaction).ID,
+	}
+	if i.Member != nil {
+		c.Roles = i.Member.Roles
+	}
+	c.Reply = func(text string, embed *discordgo.MessageEmbed) error {
+		params := &discordgo.WebhookParams{Flags: discordgo.MessageFlagsEphemeral}
+		if embed != nil {
+			params.Content = text
+			params.Embeds = []*discordgo.MessageEmbed{embed}
+			_, err := session.FollowupMessageCreate(i.Interaction, true, params)
+			return err
+		}
+		for _, part := range splitMessage(text) {
+			params.Content = part
+			if _, err := session.FollowupMessageCreate(i.Interaction, true, params); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := s.bus.Publish(Event{Source: SourceDiscord, Command: c}); err != nil {
+		log.Errorf("Failed to publish slash command: %s", err.Error())
+		c.Reply("Bot is busy, try again later", nil)
+	}
+}
+
+func (s *SlashCommands) autocomplete(session *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	path, _, focused := slashArgs(data.Options)
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+
+	def := s.router.Lookup(data.Name)
+	for _, name := range path {
+		if def == nil {
+			break
+		}
+		def = def.subcommand(name)
+	}
+	if def != nil && focused != nil {
+		for _, arg := range def.Args {
+			if arg.Name != focused.Name || arg.Complete == nil {
+				continue
+			}
+			for _, value := range arg.Complete(fmt.Sprint(focused.Value)) {
+				if len(choices) == maxSlashChoices {
+					break
+				}
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+					Name:  slashDescription(value, value),
+					Value: value,
+				})
+			}
+		}
+	}
+
+	err := session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		log.Errorf("Failed to send autocomplete results: %s", err.Error())
+	}
+}
+
+// interactionUser returns user who created interaction in a guild
+// or in direct messages
+func interactionUser(i *discordgo.Interaction) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	if i.User != nil {
+		return i.User
+	}
+	return new(discordgo.User)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSlashCommand(t *testing.T) {
+	noop := func(*CommandContext) error { return nil }
+	def := &CommandDef{
+		Name:  "projects",
+		Usage: "Manage projects",
+		Subcommands: []*CommandDef{
+			{
+				Name:    "info",
+				Args:    []CommandArg{{Name: "project", Complete: func(string) []string { return nil }}},
+				Handler: noop,
+			},
+			{
+				Name: "ci",
+				Subcommands: []*CommandDef{
+					{Name: "restart", Args: []CommandArg{{Name: "build", Type: ArgInt, Optional: true}}, Handler: noop},
+				},
+			},
+		},
+	}
+	if err := validateCommandDef(def); err != nil {
+		t.Fatalf("Invalid command: %s", err.Error())
+	}
+
+	command, err := slashCommand(def)
+	if err != nil {
+		t.Fatalf("slashCommand failed: %s", err.Error())
+	}
+	if command.Name != "projects" || command.Description != "Manage projects" || len(command.Options) != 2 {
+		t.Fatalf("Unexpected command: %+v", command)
+	}
+
+	info := command.Options[0]
+	if info.Type != discordgo.ApplicationCommandOptionSubCommand || info.Description != "info" {
+		t.Errorf("Unexpected subcommand: %+v", info)
+	}
+	if len(info.Options) != 1 || !info.Options[0].Required || !info.Options[0].Autocomplete ||
+		info.Options[0].Type != discordgo.ApplicationCommandOptionString {
+		t.Errorf("Unexpected subcommand options: %+v", info.Options)
+	}
+
+	ci := command.Options[1]
+	if ci.Type != discordgo.ApplicationCommandOptionSubCommandGroup || len(ci.Options) != 1 {
+		t.Fatalf("Unexpected subcommand group: %+v", ci)
+	}
+	build := ci.Options[0].Options[0]
+	if build.Type != discordgo.ApplicationCommandOptionInteger || build.Required || build.Autocomplete {
+		t.Errorf("Unexpected integer option: %+v", build)
+	}
+}
+
+func TestSlashArgs(t *testing.T) {
+	options := []*discordgo.ApplicationCommandInteractionDataOption{
+		{
+			Name: "ci",
+			Type: discordgo.ApplicationCommandOptionSubCommandGroup,
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{
+					Name: "restart",
+					Type: discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandInteractionDataOption{
+						{Name: "build", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(42)},
+						{Name: "project", Type: discordgo.ApplicationCommandOptionString, Value: "github.com/sav", Focused: true},
+					},
+				},
+			},
+		},
+	}
+
+	path, values, focused := slashArgs(options)
+	if !reflect.DeepEqual(path, []string{"ci", "restart"}) {
+		t.Errorf("path = %v", path)
+	}
+	want := map[string]string{"build": "42", "project": "github.com/sav"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+	if focused == nil || focused.Name != "project" {
+		t.Errorf("focused = %+v", focused)
+	}
+}
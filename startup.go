@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Subsystem is a single startup step. Subsystem is started only after
+// every subsystem it depends on has been started successfully
+type Subsystem struct {
+	Name     string
+	Required bool
+	Depends  []string
+	Init     func() error
+}
+
+type SubsystemState uint8
+
+const (
+	SubsystemPending SubsystemState = iota
+	SubsystemStarted SubsystemState = iota
+	SubsystemFailed  SubsystemState = iota
+	SubsystemSkipped SubsystemState = iota
+)
+
+func (s SubsystemState) String() string {
+	switch s {
+	case SubsystemPending:
+		return "pending"
+	case SubsystemStarted:
+		return "started"
+	case SubsystemFailed:
+		return "failed"
+	case SubsystemSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// SubsystemResult is an outcome of a subsystem startup
+type SubsystemResult struct {
+	Name     string
+	Required bool
+	State    SubsystemState
+	Error    error
+	Duration time.Duration
+}
+
+// Startup runs subsystems in dependency order and stops as soon
+// as a required subsystem can't be started
+type Startup struct {
+	subsystems []*Subsystem
+	Results    []*SubsystemResult
+}
+
+func (s *Startup) Add(subsystem *Subsystem) {
+	s.subsystems = append(s.subsystems, subsystem)
+}
+
+// Run starts every subsystem. Error is returned when dependency graph
+// is broken or a required subsystem failed or was skipped
+func (s *Startup) Run() error {
+	order, err := s.order()
+	if err != nil {
+		return err
+	}
+
+	s.Results = s.Results[:0]
+	results := make(map[string]*SubsystemResult)
+	for _, sub := range order {
+		result := &SubsystemResult{Name: sub.Name, Required: sub.Required}
+		results[sub.Name] = result
+		s.Results = append(s.Results, result)
+
+		for _, dep := range sub.Depends {
+			if results[dep].State != SubsystemStarted {
+				result.State = SubsystemSkipped
+				result.Error = fmt.Errorf("dependency %s is not running", dep)
+				break
+			}
+		}
+
+		if result.State == SubsystemPending {
+			start := time.Now()
+			if err := sub.Init(); err != nil {
+				result.State = SubsystemFailed
+				result.Error = err
+			} else {
+				result.State = SubsystemStarted
+			}
+			result.Duration = time.Since(start)
+		}
+
+		if result.State != SubsystemStarted {
+			log.Errorf("Subsystem %s %s: %s", sub.Name, result.State, result.Error.Error())
+			if sub.Required {
+				return fmt.Errorf("required subsystem %s %s: %s", sub.Name, result.State, result.Error.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// order sorts subsystems so that every subsystem follows its
+// dependencies. Registration order is kept where possible
+func (s *Startup) order() ([]*Subsystem, error) {
+	known := make(map[string]*Subsystem)
+	for _, sub := range s.subsystems {
+		if _, ok := known[sub.Name]; ok {
+			return nil, fmt.Errorf("subsystem %s is registered twice", sub.Name)
+		}
+		known[sub.Name] = sub
+	}
+
+	result := []*Subsystem{}
+	visited := make(map[string]bool)
+	inProgress := make(map[string]bool)
+
+	var visit func(sub *Subsystem) error
+	visit = func(sub *Subsystem) error {
+		if visited[sub.Name] {
+			return nil
+		}
+		if inProgress[sub.Name] {
+			return fmt.Errorf("dependency cycle detected at %s", sub.Name)
+		}
+		inProgress[sub.Name] = true
+		for _, dep := range sub.Depends {
+			d, ok := known[dep]
+			if !ok {
+				return fmt.Errorf("subsystem %s depends on unknown subsystem %s", sub.Name, dep)
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		inProgress[sub.Name] = false
+		visited[sub.Name] = true
+		result = append(result, sub)
+		return nil
+	}
+
+	for _, sub := range s.subsystems {
+		if err := visit(sub); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Summary returns human readable startup results
+func (s *Startup) Summary() string {
+	lines := []string{"Startup summary:"}
+	for _, r := range s.Results {
+		kind := "optional"
+		if r.Required {
+			kind = "required"
+		}
+		line := fmt.Sprintf("  %-14s %-8s %-9s", r.Name, r.State, kind)
+		if r.Error != nil {
+			line += " " + r.Error.Error()
+		} else {
+			line += fmt.Sprintf(" %s", r.Duration.Truncate(time.Millisecond))
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Started reports whether subsystem with given name is running
+func (s *Startup) Started(name string) bool {
+	for _, r := range s.Results {
+		if r.Name == name {
+			return r.State == SubsystemStarted
+		}
+	}
+	return false
+}
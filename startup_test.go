@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestStartup_Run(t *testing.T) {
+	started := []string{}
+	init := func(name string, err error) func() error {
+		return func() error {
+			started = append(started, name)
+			return err
+		}
+	}
+
+	s := new(Startup)
+	s.Add(&Subsystem{Name: "status", Depends: []string{"discord"}, Init: init("status", nil)})
+	s.Add(&Subsystem{Name: "config", Required: true, Init: init("config", nil)})
+	s.Add(&Subsystem{Name: "github", Depends: []string{"config"}, Init: init("github", fmt.Errorf("port is busy"))})
+	s.Add(&Subsystem{Name: "discord", Required: true, Depends: []string{"config"}, Init: init("discord", nil)})
+	s.Add(&Subsystem{Name: "projects", Depends: []string{"github"}, Init: init("projects", nil)})
+
+	if err := s.Run(); err != nil {
+		t.Fatalf("Run() failed: %s", err.Error())
+	}
+
+	want := []string{"config", "discord", "status", "github"}
+	if !reflect.DeepEqual(started, want) {
+		t.Errorf("Started %v, want %v", started, want)
+	}
+	if !s.Started("status") || s.Started("github") || s.Started("projects") {
+		t.Errorf("Unexpected subsystem states: %s", s.Summary())
+	}
+	if s.Results[len(s.Results)-1].State != SubsystemSkipped {
+		t.Errorf("Subsystem with failed dependency was not skipped: %s", s.Summary())
+	}
+}
+
+func TestStartup_RequiredFailure(t *testing.T) {
+	s := new(Startup)
+	s.Add(&Subsystem{Name: "config", Required: true, Init: func() error { return fmt.Errorf("not found") }})
+	s.Add(&Subsystem{Name: "discord", Required: true, Depends: []string{"config"}, Init: func() error {
+		t.Errorf("Subsystem started after required subsystem failed")
+		return nil
+	}})
+
+	if err := s.Run(); err == nil {
+		t.Errorf("Run() succeeded when required subsystem failed")
+	}
+}
+
+func TestStartup_BrokenGraph(t *testing.T) {
+	noop := func() error { return nil }
+
+	cycle := new(Startup)
+	cycle.Add(&Subsystem{Name: "a", Depends: []string{"b"}, Init: noop})
+	cycle.Add(&Subsystem{Name: "b", Depends: []string{"a"}, Init: noop})
+	if err := cycle.Run(); err == nil {
+		t.Errorf("Run() succeeded with dependency cycle")
+	}
+
+	unknown := new(Startup)
+	unknown.Add(&Subsystem{Name: "a", Depends: []string{"b"}, Init: noop})
+	if err := unknown.Run(); err == nil {
+		t.Errorf("Run() succeeded with unknown dependency")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/bwmarrin/discordgo"
 	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,35 +18,95 @@ type Status struct {
 	LastUpdate time.Time
 	StartTime  time.Time
 	Discord    *Discord
+	Bus        *Bus
+	Storage    Storage
+
+	mutex        sync.Mutex
+	messageMutex sync.Mutex
+	events       map[EventSource]*sourceActivity
+	stop         chan struct{}
+}
+
+// sourceActivity tracks events received from a single source
+type sourceActivity struct {
+	Count uint64
+	Last  time.Time
 }
 
-func (s *Status) Init(discord *Discord) error {
+// statusMessageKey is used to keep status message between restarts
+const statusMessageKey = "status"
+
+// Init prepares status message. Storage is optional: without it
+// a new status message is posted on every start
+func (s *Status) Init(discord *Discord, bus *Bus, storage Storage) error {
 	if discord == nil {
 		return fmt.Errorf("discord is nil")
 	}
+	if bus == nil {
+		return fmt.Errorf("bus is nil")
+	}
 	s.Discord = discord
+	s.Bus = bus
+	s.Storage = storage
+	s.ChannelID = discord.statusChannel()
 	s.StartTime = time.Now()
+	s.events = make(map[EventSource]*sourceActivity)
+	s.stop = make(chan struct{})
 
-	s.ClearStatusMessages()
+	for _, source := range []EventSource{SourceGitHub, SourceTravis} {
+		if _, err := bus.Subscribe(source, "status", 0, s.trackEvent); err != nil {
+			return err
+		}
+	}
 
 	s.MessageID = ""
+	if s.Storage != nil {
+		ref, err := s.Storage.Message(statusMessageKey)
+		if err != nil {
+			log.Errorf("Failed to load status message: %s", err.Error())
+		} else if ref != nil && ref.ChannelID == s.ChannelID {
+			s.MessageID = ref.MessageID
+		}
+	}
+
+	s.ClearStatusMessages()
 
 	return nil
 }
 
 func (s *Status) Run() error {
+	ticker := time.NewTicker(time.Second * 30)
+	defer ticker.Stop()
 
 	for {
-		if time.Since(s.LastUpdate) > time.Duration(time.Second*30) {
-			s.LastUpdate = time.Now()
-			if err := s.UpdateStatus(); err != nil {
-				log.Errorf("Failed to update status: %s", err.Error())
-			}
+		s.LastUpdate = time.Now()
+		if err := s.UpdateStatus(); err != nil {
+			log.Errorf("Failed to update status: %s", err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return nil
 		}
-
-		time.Sleep(time.Millisecond * 100)
 	}
+}
 
+// Stop terminates periodic status updates
+func (s *Status) Stop() {
+	close(s.stop)
+}
+
+func (s *Status) trackEvent(e Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	activity, ok := s.events[e.Source]
+	if !ok {
+		activity = new(sourceActivity)
+		s.events[e.Source] = activity
+	}
+	activity.Count++
+	activity.Last = e.Time
 	return nil
 }
 
@@ -64,18 +126,63 @@ func (s *Status) UpdateStatus() error {
 		Name:  "Master Server Uptime",
 		Value: s.GetUptime(),
 	})
+	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+		Name:  "Events",
+		Value: s.GetActivity(),
+	})
+	msg.Fields = append(msg.Fields, &discordgo.MessageEmbedField{
+		Name:  "Event Queue",
+		Value: s.GetQueue(),
+	})
 
-	if s.MessageID == "" {
-		newMsg, err := s.Discord.sendEmbed(s.Discord.StatusChannel, msg)
-		if err != nil {
-			return err
+	s.messageMutex.Lock()
+	defer s.messageMutex.Unlock()
+
+	if s.MessageID != "" {
+		_, err := s.Discord.editEmbed(s.ChannelID, s.MessageID, msg)
+		if err == nil {
+			return nil
 		}
-		s.MessageID = newMsg.ID
-		return nil
+		// Message could be removed manually, post a new one
+		log.Warnf("Failed to edit status message %s: %s", s.MessageID, err.Error())
 	}
 
-	_, err := s.Discord.editEmbed(s.Discord.StatusChannel, s.MessageID, msg)
-	return err
+	newMsg, err := s.Discord.sendEmbed(s.ChannelID, msg)
+	if err != nil {
+		return err
+	}
+	s.MessageID = newMsg.ID
+	s.saveMessage()
+	return nil
+}
+
+func (s *Status) saveMessage() {
+	if s.Storage == nil {
+		return
+	}
+	ref := MessageRef{ChannelID: s.ChannelID, MessageID: s.MessageID}
+	if err := s.Storage.SetMessage(statusMessageKey, ref); err != nil {
+		log.Errorf("Failed to save status message: %s", err.Error())
+	}
+}
+
+// SetChannel moves status message into another channel. Message in the
+// previous channel is removed and a new one is posted on next update
+func (s *Status) SetChannel(channelID string) {
+	s.messageMutex.Lock()
+	defer s.messageMutex.Unlock()
+
+	if channelID == s.ChannelID {
+		return
+	}
+	if s.MessageID != "" {
+		if err := s.Discord.deleteMessage(s.ChannelID, s.MessageID); err != nil {
+			log.Errorf("Failed to remove status message: %s", err.Error())
+		}
+	}
+	log.Infof("Status channel changed from %s to %s", s.ChannelID, channelID)
+	s.ChannelID = channelID
+	s.MessageID = ""
 }
 
 func (s *Status) ClearStatusMessages() error {
@@ -83,17 +190,17 @@ func (s *Status) ClearStatusMessages() error {
 		return fmt.Errorf("discord is nil")
 	}
 
-	msg, err := s.Discord.getMessages(s.Discord.StatusChannel)
+	msg, err := s.Discord.getMessages(s.ChannelID)
 	if err != nil {
 		return nil
 	}
 
 	for _, m := range msg {
-		if m == "" {
+		if m == "" || m == s.MessageID {
 			continue
 		}
 
-		s.Discord.deleteMessage(s.Discord.StatusChannel, m)
+		s.Discord.deleteMessage(s.ChannelID, m)
 	}
 
 	return nil
@@ -102,3 +209,35 @@ func (s *Status) ClearStatusMessages() error {
 func (s *Status) GetUptime() string {
 	return time.Since(s.StartTime).String()
 }
+
+func (s *Status) GetActivity() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lines := []string{}
+	for _, source := range []EventSource{SourceGitHub, SourceTravis} {
+		activity, ok := s.events[source]
+		if !ok {
+			lines = append(lines, fmt.Sprintf("%s: no events", source))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d, last %s ago", source, activity.Count,
+			time.Since(activity.Last).Truncate(time.Second)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *Status) GetQueue() string {
+	lines := []string{}
+	for _, stats := range s.Bus.Stats() {
+		line := fmt.Sprintf("%s/%s: %d/%d", stats.Source, stats.Name, stats.Depth, stats.Capacity)
+		if stats.Dropped > 0 {
+			line += fmt.Sprintf(", %d dropped", stats.Dropped)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "no subscribers"
+	}
+	return strings.Join(lines, "\n")
+}
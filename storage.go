@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// Storage keeps bot state between restarts
+type Storage interface {
+	// Projects returns every known project
+	Projects() ([]ProjectData, error)
+	// Project returns project by URL or nil when project is unknown
+	Project(url string) (*ProjectData, error)
+	SaveProject(project ProjectData) error
+	DeleteProject(url string) error
+
+	// Message returns reference to a Discord message saved under the key
+	// or nil when nothing was saved
+	Message(key string) (*MessageRef, error)
+	SetMessage(key string, ref MessageRef) error
+	DeleteMessage(key string) error
+
+	// PullRequests returns every pull request shown on the board
+	PullRequests() ([]PullRequestCard, error)
+	// PullRequest returns pull request by PullRequestCard.Key or nil
+	// when pull request is unknown
+	PullRequest(key string) (*PullRequestCard, error)
+	SavePullRequest(card PullRequestCard) error
+
+	// AddEvent appends record to the event history
+	AddEvent(record *EventRecord) error
+	// Events returns history records newer than since in chronological
+	// order. When limit is positive only the latest records are returned
+	Events(since time.Time, limit int) ([]*EventRecord, error)
+	// PruneEvents removes history records older than before
+	PruneEvents(before time.Time) (int, error)
+
+	// AddDelivery records webhook delivery and reports whether it was
+	// recorded before. Only the latest limit deliveries are kept, they
+	// are not exported
+	AddDelivery(id string, limit int) (bool, error)
+	// RemoveDelivery forgets delivery which wasn't handled, so it's
+	// accepted when delivered again
+	RemoveDelivery(id string) error
+
+	UserSettings(userID string) (map[string]string, error)
+	SetUserSetting(userID, key, value string) error
+	// UsersBySetting returns IDs of users having setting with the value
+	UsersBySetting(key, value string) ([]string, error)
+
+	// Export writes all data as JSON document
+	Export(w io.Writer) error
+	// Import loads JSON document produced by Export. Projects, messages
+	// and user settings with the same keys are replaced, events are appended
+	Import(r io.Reader) error
+
+	Close() error
+}
+
+// MessageRef points to a Discord message which is updated by the bot
+type MessageRef struct {
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+}
+
+// EventRecord is a short description of an event kept in the history
+type EventRecord struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	Type    string    `json:"type"`
+	Action  string    `json:"action,omitempty"`
+	Project string    `json:"project,omitempty"`
+	Branch  string    `json:"branch,omitempty"`
+	Actor   string    `json:"actor,omitempty"`
+	Number  int64     `json:"number,omitempty"`
+	Title   string    `json:"title,omitempty"`
+	URL     string    `json:"url,omitempty"`
+	Commits int       `json:"commits,omitempty"`
+	Authors []string  `json:"authors,omitempty"`
+	Labels  []string  `json:"labels,omitempty"`
+	Result  string    `json:"result,omitempty"`
+	Merged  bool      `json:"merged,omitempty"`
+}
+
+// StorageDump is a format of storage backups
+type StorageDump struct {
+	Version  int                          `json:"version"`
+	Created  time.Time                    `json:"created"`
+	Projects []ProjectData                `json:"projects"`
+	Messages map[string]MessageRef        `json:"messages"`
+	Events   []*EventRecord               `json:"events"`
+	Users    map[string]map[string]string `json:"users"`
+	// PullRequests were added later, older backups don't have them
+	PullRequests []PullRequestCard `json:"pull_requests,omitempty"`
+}
+
+// StorageDumpVersion is incremented on incompatible changes of StorageDump
+const StorageDumpVersion = 1
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketProjects = []byte("projects")
+	bucketMessages = []byte("messages")
+	bucketEvents   = []byte("events")
+	bucketUsers    = []byte("users")
+	bucketPulls    = []byte("pulls")
+	// Deliveries map webhook delivery to its sequence number, delivery
+	// order maps sequence numbers back to remove the oldest deliveries
+	bucketDeliveries    = []byte("deliveries")
+	bucketDeliveryOrder = []byte("delivery_order")
+)
+
+// BoltStorage keeps bot state in a single bbolt database file
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+func (s *BoltStorage) Init(path string) error {
+	log.Infof("Opening storage at %s", path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Failed to create storage directory: %s", err.Error())
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return fmt.Errorf("Failed to open storage: %s", err.Error())
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{bucketProjects, bucketMessages, bucketEvents, bucketUsers, bucketPulls, bucketDeliveries, bucketDeliveryOrder} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("Failed to prepare storage: %s", err.Error())
+	}
+
+	s.db = db
+	return nil
+}
+
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStorage) Projects() ([]ProjectData, error) {
+	result := []ProjectData{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketProjects).ForEach(func(k, v []byte) error {
+			var project ProjectData
+			if err := json.Unmarshal(v, &project); err != nil {
+				return err
+			}
+			result = append(result, project)
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (s *BoltStorage) Project(url string) (*ProjectData, error) {
+	var project *ProjectData
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketProjects).Get([]byte(url))
+		if v == nil {
+			return nil
+		}
+		project = new(ProjectData)
+		return json.Unmarshal(v, project)
+	})
+	return project, err
+}
+
+func (s *BoltStorage) SaveProject(project ProjectData) error {
+	return s.put(bucketProjects, []byte(project.URL), project)
+}
+
+func (s *BoltStorage) DeleteProject(url string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketProjects).Delete([]byte(url))
+	})
+}
+
+func (s *BoltStorage) Message(key string) (*MessageRef, error) {
+	var ref *MessageRef
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketMessages).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		ref = new(MessageRef)
+		return json.Unmarshal(v, ref)
+	})
+	return ref, err
+}
+
+func (s *BoltStorage) SetMessage(key string, ref MessageRef) error {
+	return s.put(bucketMessages, []byte(key), ref)
+}
+
+func (s *BoltStorage) DeleteMessage(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMessages).Delete([]byte(key))
+	})
+}
+
+func (s *BoltStorage) PullRequests() ([]PullRequestCard, error) {
+	result := []PullRequestCard{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPulls).ForEach(func(k, v []byte) error {
+			var card PullRequestCard
+			if err := json.Unmarshal(v, &card); err != nil {
+				return err
+			}
+			result = append(result, card)
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (s *BoltStorage) PullRequest(key string) (*PullRequestCard, error) {
+	var card *PullRequestCard
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketPulls).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		card = new(PullRequestCard)
+		return json.Unmarshal(v, card)
+	})
+	return card, err
+}
+
+func (s *BoltStorage) SavePullRequest(card PullRequestCard) error {
+	return s.put(bucketPulls, []byte(card.Key()), card)
+}
+
+func (s *BoltStorage) AddEvent(record *EventRecord) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketEvents)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(eventKey(record.Time, seq), data)
+	})
+}
+
+func (s *BoltStorage) Events(since time.Time, limit int) ([]*EventRecord, error) {
+	result := []*EventRecord{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketEvents).Cursor()
+		start := eventKey(since, 0)
+		read := func(v []byte) error {
+			record := new(EventRecord)
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+			result = append(result, record)
+			return nil
+		}
+
+		if limit > 0 {
+			// Only the latest records are needed, so they are read backwards
+			for k, v := c.Last(); k != nil && len(result) < limit; k, v = c.Prev() {
+				if !since.IsZero() && string(k) < string(start) {
+					break
+				}
+				if err := read(v); err != nil {
+					return err
+				}
+			}
+			for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+				result[i], result[j] = result[j], result[i]
+			}
+			return nil
+		}
+
+		k, v := c.First()
+		if !since.IsZero() {
+			k, v = c.Seek(start)
+		}
+		for ; k != nil; k, v = c.Next() {
+			if err := read(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (s *BoltStorage) PruneEvents(before time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketEvents).Cursor()
+		limit := eventKey(before, 0)
+		for k, _ := c.First(); k != nil && string(k) < string(limit); k, _ = c.Next() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+func (s *BoltStorage) AddDelivery(id string, limit int) (bool, error) {
+	seen := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		deliveries := tx.Bucket(bucketDeliveries)
+		order := tx.Bucket(bucketDeliveryOrder)
+		if deliveries.Get([]byte(id)) != nil {
+			seen = true
+			return nil
+		}
+
+		seq, err := order.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := deliveries.Put([]byte(id), key); err != nil {
+			return err
+		}
+		if err := order.Put(key, []byte(id)); err != nil {
+			return err
+		}
+
+		c := order.Cursor()
+		for k, v := c.First(); k != nil && binary.BigEndian.Uint64(k)+uint64(limit) <= seq; k, v = c.Next() {
+			if err := deliveries.Delete(v); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return seen, err
+}
+
+func (s *BoltStorage) RemoveDelivery(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		deliveries := tx.Bucket(bucketDeliveries)
+		key := deliveries.Get([]byte(id))
+		if key == nil {
+			return nil
+		}
+		if err := tx.Bucket(bucketDeliveryOrder).Delete(key); err != nil {
+			return err
+		}
+		return deliveries.Delete([]byte(id))
+	})
+}
+
+func (s *BoltStorage) UserSettings(userID string) (map[string]string, error) {
+	settings := make(map[string]string)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketUsers).Get([]byte(userID))
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(v, &settings)
+	})
+	return settings, err
+}
+
+func (s *BoltStorage) SetUserSetting(userID, key, value string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketUsers)
+		settings := make(map[string]string)
+		if v := bucket.Get([]byte(userID)); v != nil {
+			if err := json.Unmarshal(v, &settings); err != nil {
+				return err
+			}
+		}
+		if value == "" {
+			delete(settings, key)
+		} else {
+			settings[key] = value
+		}
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(userID), data)
+	})
+}
+
+func (s *BoltStorage) UsersBySetting(key, value string) ([]string, error) {
+	result := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketUsers).ForEach(func(k, v []byte) error {
+			settings := make(map[string]string)
+			if err := json.Unmarshal(v, &settings); err != nil {
+				return err
+			}
+			if settings[key] == value {
+				result = append(result, string(k))
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (s *BoltStorage) Export(w io.Writer) error {
+	dump := StorageDump{
+		Version:  StorageDumpVersion,
+		Created:  time.Now(),
+		Messages: make(map[string]MessageRef),
+		Users:    make(map[string]map[string]string),
+	}
+
+	var err error
+	if dump.Projects, err = s.Projects(); err != nil {
+		return err
+	}
+	if dump.Events, err = s.Events(time.Time{}, 0); err != nil {
+		return err
+	}
+	if dump.PullRequests, err = s.PullRequests(); err != nil {
+		return err
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(bucketMessages).ForEach(func(k, v []byte) error {
+			var ref MessageRef
+			if err := json.Unmarshal(v, &ref); err != nil {
+				return err
+			}
+			dump.Messages[string(k)] = ref
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketUsers).ForEach(func(k, v []byte) error {
+			settings := make(map[string]string)
+			if err := json.Unmarshal(v, &settings); err != nil {
+				return err
+			}
+			dump.Users[string(k)] = settings
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dump)
+}
+
+func (s *BoltStorage) Import(r io.Reader) error {
+	var dump StorageDump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return fmt.Errorf("Failed to decode backup: %s", err.Error())
+	}
+	if dump.Version != StorageDumpVersion {
+		return fmt.Errorf("Unsupported backup version %d", dump.Version)
+	}
+
+	for _, project := range dump.Projects {
+		if err := s.SaveProject(project); err != nil {
+			return err
+		}
+	}
+	for key, ref := range dump.Messages {
+		if err := s.SetMessage(key, ref); err != nil {
+			return err
+		}
+	}
+	for _, record := range dump.Events {
+		if err := s.AddEvent(record); err != nil {
+			return err
+		}
+	}
+	for _, card := range dump.PullRequests {
+		if err := s.SavePullRequest(card); err != nil {
+			return err
+		}
+	}
+	for userID, settings := range dump.Users {
+		for key, value := range settings {
+			if err := s.SetUserSetting(userID, key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Infof("Imported %d projects, %d messages, %d events, %d pull requests and %d users", len(dump.Projects),
+		len(dump.Messages), len(dump.Events), len(dump.PullRequests), len(dump.Users))
+	return nil
+}
+
+func (s *BoltStorage) put(bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, data)
+	})
+}
+
+// eventKey orders history records by time. Sequence number keeps
+// records received at the same moment apart
+func eventKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
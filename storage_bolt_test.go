@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStorage(t *testing.T) (*BoltStorage, func()) {
+	dir, err := ioutil.TempDir("", "eveleve")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err.Error())
+	}
+	storage := new(BoltStorage)
+	if err := storage.Init(filepath.Join(dir, "eveleve.db")); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Failed to open storage: %s", err.Error())
+	}
+	return storage, func() {
+		storage.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBoltStorage_Projects(t *testing.T) {
+	storage, cleanup := testStorage(t)
+	defer cleanup()
+
+	added := time.Date(2020, 5, 11, 21, 6, 36, 0, time.UTC)
+	if err := storage.SaveProject(ProjectData{URL: "github.com/savageking-io/eveleve", Added: added}); err != nil {
+		t.Fatalf("SaveProject failed: %s", err.Error())
+	}
+
+	project, err := storage.Project("github.com/savageking-io/eveleve")
+	if err != nil || project == nil {
+		t.Fatalf("Project not found: %v", err)
+	}
+	if !project.Added.Equal(added) {
+		t.Errorf("Added = %s, want %s", project.Added, added)
+	}
+
+	if err := storage.DeleteProject(project.URL); err != nil {
+		t.Fatalf("DeleteProject failed: %s", err.Error())
+	}
+	projects, _ := storage.Projects()
+	if len(projects) != 0 {
+		t.Errorf("Projects() = %v after delete", projects)
+	}
+}
+
+func TestBoltStorage_Events(t *testing.T) {
+	storage, cleanup := testStorage(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i, age := range []time.Duration{time.Hour * 48, time.Hour * 2, time.Hour} {
+		storage.AddEvent(&EventRecord{Time: now.Add(-age), Type: "push", Commits: i})
+	}
+
+	events, err := storage.Events(now.Add(-time.Hour*24), 0)
+	if err != nil {
+		t.Fatalf("Events failed: %s", err.Error())
+	}
+	if len(events) != 2 || events[0].Commits != 1 || events[1].Commits != 2 {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+
+	events, _ = storage.Events(time.Time{}, 1)
+	if len(events) != 1 || events[0].Commits != 2 {
+		t.Errorf("Limit returned wrong events: %+v", events)
+	}
+	events, _ = storage.Events(time.Time{}, 2)
+	if len(events) != 2 || events[0].Commits != 1 || events[1].Commits != 2 {
+		t.Errorf("Limit returned wrong events: %+v", events)
+	}
+	events, _ = storage.Events(now.Add(-time.Hour*24), 5)
+	if len(events) != 2 || events[0].Commits != 1 || events[1].Commits != 2 {
+		t.Errorf("Limit and since returned wrong events: %+v", events)
+	}
+
+	removed, err := storage.PruneEvents(now.Add(-time.Hour * 24))
+	if err != nil || removed != 1 {
+		t.Errorf("PruneEvents removed %d events: %v", removed, err)
+	}
+}
+
+func TestBoltStorage_ExportImport(t *testing.T) {
+	storage, cleanup := testStorage(t)
+	defer cleanup()
+
+	storage.SaveProject(ProjectData{URL: "github.com/savageking-io/eveleve", Added: time.Now()})
+	storage.SetMessage("status", MessageRef{ChannelID: "1", MessageID: "2"})
+	storage.AddEvent(&EventRecord{Type: "push"})
+	storage.SetUserSetting("100", "github", "savageking")
+	storage.SavePullRequest(PullRequestCard{Project: "savageking-io/eveleve", Number: 7, Message: MessageRef{ChannelID: "1", MessageID: "3"}})
+
+	backup := new(bytes.Buffer)
+	if err := storage.Export(backup); err != nil {
+		t.Fatalf("Export failed: %s", err.Error())
+	}
+
+	restored, cleanupRestored := testStorage(t)
+	defer cleanupRestored()
+	if err := restored.Import(backup); err != nil {
+		t.Fatalf("Import failed: %s", err.Error())
+	}
+
+	if project, _ := restored.Project("github.com/savageking-io/eveleve"); project == nil {
+		t.Errorf("Project was not restored")
+	}
+	if ref, _ := restored.Message("status"); ref == nil || ref.MessageID != "2" {
+		t.Errorf("Message was not restored: %+v", ref)
+	}
+	if events, _ := restored.Events(time.Time{}, 0); len(events) != 1 {
+		t.Errorf("%d events restored, want 1", len(events))
+	}
+	if settings, _ := restored.UserSettings("100"); settings["github"] != "savageking" {
+		t.Errorf("User settings were not restored: %v", settings)
+	}
+	if card, _ := restored.PullRequest("savageking-io/eveleve#7"); card == nil || card.Message.MessageID != "3" {
+		t.Errorf("Pull request was not restored: %+v", card)
+	}
+}
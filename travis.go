@@ -11,11 +11,15 @@ import (
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"sync"
 )
 
 type Travis struct {
-	conf   *TravisConfig
-	Events chan TravisPacket
+	conf *TravisConfig
+	Bus  *Bus
+	// Deliveries drop repeated notifications about a build state, optional
+	Deliveries *Deliveries
+	mutex      sync.RWMutex
 }
 
 type TravisMatrix struct {
@@ -100,21 +104,40 @@ type ConfigKey struct {
 	} `json:"config"`
 }
 
-func (t *Travis) Init(config *TravisConfig) error {
+func (t *Travis) Init(config *TravisConfig, server *Server, bus *Bus) error {
 	log.Infof("Initializing Travis CI")
 	if config == nil {
 		return fmt.Errorf("nil travis config")
 	}
+	if server == nil {
+		return fmt.Errorf("nil http server")
+	}
+	if bus == nil {
+		return fmt.Errorf("nil bus")
+	}
 	t.conf = config
-	t.Events = make(chan TravisPacket)
+	t.Bus = bus
 
-	return nil
+	return server.Register(Route{
+		Name:        "travis",
+		Path:        t.conf.URI,
+		MaxBodySize: t.conf.MaxBodySize,
+		Handler:     http.HandlerFunc(t.Handle),
+	})
+}
+
+// SetConfig applies new Travis settings. URI and body size limit
+// are only read on startup
+func (t *Travis) SetConfig(config *TravisConfig) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.conf = config
 }
 
-func (t *Travis) Run() error {
-	log.Infof("Starting Travis Listener")
-	http.HandleFunc(t.conf.URI, t.Handle)
-	return http.ListenAndServe(fmt.Sprintf(":%d", t.conf.Port), nil)
+func (t *Travis) config() *TravisConfig {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.conf
 }
 
 func (t *Travis) Handle(w http.ResponseWriter, r *http.Request) {
@@ -144,13 +167,25 @@ func (t *Travis) Handle(w http.ResponseWriter, r *http.Request) {
 		t.RespondWithError(w, fmt.Errorf("failed to unmarshal payload: %s", err.Error()).Error())
 		return
 	}
-	t.Events <- *data
+	// Restarted build keeps its ID, but gets new start and finish times
+	delivery := fmt.Sprintf("%d:%s:%s:%s", data.ID, data.State, data.StartedAt, data.FinishedAt)
+	if t.Deliveries.Seen(SourceTravis, delivery) {
+		t.RespondWithSuccess(w, "duplicate payload")
+		return
+	}
+	if err := t.Bus.Publish(Event{Source: SourceTravis, Travis: data}); err != nil {
+		// Travis CI retries failed webhooks, the retry must not be a duplicate
+		t.Deliveries.Forget(SourceTravis, delivery)
+		log.Errorf("Failed to publish Travis event: %s", err.Error())
+		respondError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
 	t.RespondWithSuccess(w, "payload verified")
 }
 
 func (t *Travis) TravisPublicKey() (*rsa.PublicKey, error) {
 	log.Debug("Requesting Travis's Public Key")
-	response, err := http.Get(t.conf.API)
+	response, err := http.Get(t.config().API)
 
 	if err != nil {
 		log.Errorf("Couldn't retrieve public key: %s", err.Error())
@@ -1,9 +1,22 @@
 package main
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestTravis_ParsePayload(t *testing.T) {
@@ -48,3 +61,111 @@ func TestTravis_ParsePayload(t *testing.T) {
 		})
 	}
 }
+
+// testTravisDeliver returns function which sends signed payload to the
+// handler. Public key is served by a test Travis API server
+func testTravisDeliver(t *testing.T, travis *Travis) (func(payload string) int, func()) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err.Error())
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	var conf ConfigKey
+	conf.Config.Notifications.Webhook.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(conf)
+	}))
+	travis.conf = &TravisConfig{API: api.URL}
+
+	deliver := func(payload string) int {
+		digest := sha1.Sum([]byte(payload))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign payload: %s", err.Error())
+		}
+		r := httptest.NewRequest("POST", "/travis", strings.NewReader(url.Values{"payload": {payload}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Signature", base64.StdEncoding.EncodeToString(signature))
+		w := httptest.NewRecorder()
+		travis.Handle(w, r)
+		return w.Code
+	}
+	return deliver, api.Close
+}
+
+func TestTravis_HandleRetry(t *testing.T) {
+	storage, cleanup := testStorage(t)
+	defer cleanup()
+	deliveries := new(Deliveries)
+	deliveries.Init(storage, 10)
+	bus := new(Bus)
+	bus.Init()
+	release := make(chan struct{})
+	defer close(release)
+	if _, err := bus.Subscribe(SourceTravis, "slow", 1, func(e Event) error {
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %s", err.Error())
+	}
+	travis := &Travis{Bus: bus, Deliveries: deliveries}
+	deliver, closeAPI := testTravisDeliver(t, travis)
+	defer closeAPI()
+
+	payload := `{"id": 685826671, "state": "passed", "repository": {"name": "evelengine", "owner_name": "savageking-io"}}`
+
+	// First event is taken by the handler, second one fills the queue
+	bus.Publish(Event{Source: SourceTravis})
+	deadline := time.Now().Add(time.Second)
+	for bus.QueueDepth() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	bus.Publish(Event{Source: SourceTravis})
+
+	if status := deliver(payload); status != http.StatusServiceUnavailable {
+		t.Errorf("delivery to a full queue: status = %d, want 503", status)
+	}
+	release <- struct{}{}
+	deadline = time.Now().Add(time.Second)
+	for bus.QueueDepth() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if status := deliver(payload); status != http.StatusOK {
+		t.Errorf("retry: status = %d, want 200", status)
+	}
+	if duplicates := deliveries.Duplicates(); duplicates["travis"] != 0 {
+		t.Errorf("retry of failed delivery is a duplicate")
+	}
+}
+
+func TestTravis_HandleRestartedBuild(t *testing.T) {
+	storage, cleanup := testStorage(t)
+	defer cleanup()
+	deliveries := new(Deliveries)
+	deliveries.Init(storage, 10)
+	bus := new(Bus)
+	bus.Init()
+	travis := &Travis{Bus: bus, Deliveries: deliveries}
+	deliver, closeAPI := testTravisDeliver(t, travis)
+	defer closeAPI()
+
+	build := `{"id": 685826671, "state": "%s", "started_at": "%s", "finished_at": "%s", "repository": {"name": "evelengine", "owner_name": "savageking-io"}}`
+	payloads := []string{
+		fmt.Sprintf(build, "started", "2020-05-11T21:06:36Z", ""),
+		fmt.Sprintf(build, "failed", "2020-05-11T21:06:36Z", "2020-05-11T21:07:36Z"),
+		// Redelivery of the same notification
+		fmt.Sprintf(build, "failed", "2020-05-11T21:06:36Z", "2020-05-11T21:07:36Z"),
+		// Build was restarted
+		fmt.Sprintf(build, "started", "2020-05-11T22:00:00Z", ""),
+		fmt.Sprintf(build, "passed", "2020-05-11T22:00:00Z", "2020-05-11T22:01:00Z"),
+	}
+	for _, payload := range payloads {
+		if status := deliver(payload); status != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", payload, status)
+		}
+	}
+	if duplicates := deliveries.Duplicates(); duplicates["travis"] != 1 {
+		t.Errorf("%d duplicates, want 1", duplicates["travis"])
+	}
+}